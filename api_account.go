@@ -19,34 +19,33 @@
 package td_client
 
 import (
+	"context"
 	"time"
 )
 
 // ShowAccountResult stores the result of `ShowAccountResult` API call
 type ShowAccountResult struct {
-	Id              int
-	Plan            int
-	StorageSize     int
-	GuaranteedCores int
-	MaximumCores    int
-	CreatedAt       time.Time
+	Id              int       `td:"id"`
+	Plan            int       `td:"plan"`
+	StorageSize     int       `td:"storage_size"`
+	GuaranteedCores int       `td:"guaranteed_cores"`
+	MaximumCores    int       `td:"maximum_cores"`
+	CreatedAt       time.Time `td:"created_at"`
 }
 
-var showAccountSchema = map[string]interface{}{
-	"account": map[string]interface{}{
-		"id":               0,
-		"plan":             0,
-		"storage_size":     0,
-		"guaranteed_cores": 0,
-		"maximum_cores":    0,
-		"created_at":       time.Time{},
-		"presto_plan":      0.,
-	},
+type showAccountBody struct {
+	Account struct {
+		ShowAccountResult
+		_ struct{} `td:"presto_plan,optional"`
+	} `td:"account"`
 }
 
-// ShowAccount returns the information about the current account
 func (client *TDClient) ShowAccount() (*ShowAccountResult, error) {
-	resp, err := client.get("/v3/account/show", nil)
+	return client.ShowAccountContext(context.Background())
+}
+
+func (client *TDClient) ShowAccountContext(ctx context.Context) (*ShowAccountResult, error) {
+	resp, err := client.get(ctx, "ShowAccount", "/v3/account/show", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -54,17 +53,10 @@ func (client *TDClient) ShowAccount() (*ShowAccountResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Show account failed", nil)
 	}
-	js, err := client.checkedJson(resp, showAccountSchema)
+	js := showAccountBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	a := js["account"].(map[string]interface{}) // TA: reasonably safe
-	return &ShowAccountResult{
-		Id:              a["id"].(int),
-		Plan:            a["plan"].(int),
-		StorageSize:     a["storage_size"].(int),
-		GuaranteedCores: a["guaranteed_cores"].(int),
-		MaximumCores:    a["maximum_cores"].(int),
-		CreatedAt:       a["created_at"].(time.Time),
-	}, nil
+	return &js.Account.ShowAccountResult, nil
 }
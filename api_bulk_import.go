@@ -19,92 +19,53 @@
 package td_client
 
 import (
+	"context"
 	"fmt"
 	"net/url"
-	"strconv"
 )
 
 type BulkImportResult struct {
-	Name       string
-	BulkImport string
-}
-
-var bulkImportResultSchema = map[string]interface{}{
-	"name":        "",
-	"bulk_import": "",
+	Name       string `td:"name"`
+	BulkImport string `td:"bulk_import"`
 }
 
 type BulkImportElement struct {
-	Name         string
-	Database     string
-	Table        string
-	Status       string
-	JobID        string
-	ValidRecords int
-	ErrorRecords int
-	ValidParts   int
-	ErrorParts   int
-	UploadFrozen bool
+	Name         string `td:"name"`
+	Database     string `td:"database,optional"`
+	Table        string `td:"table,optional"`
+	Status       string `td:"status,optional"`
+	JobID        string `td:"job_id,optional"`
+	ValidRecords int    `td:"valid_records,optional"`
+	ErrorRecords int    `td:"error_records,optional"`
+	ValidParts   int    `td:"valid_parts,optional"`
+	ErrorParts   int    `td:"error_parts,optional"`
+	UploadFrozen bool   `td:"upload_frozen"`
 }
 
 type ListBulkImportElements []BulkImportElement
 
-var bulkImportElementSchema = map[string]interface{}{
-	"name":          "",
-	"database":      Optional{"", nil},
-	"table":         Optional{"", nil},
-	"status":        Optional{"", nil},
-	"job_id":        Optional{"", nil},
-	"upload_frozen": false,
-	"valid_records": Optional{0, 0},
-	"error_records": Optional{0, 0},
-	"valid_parts":   Optional{0, 0},
-	"error_parts":   Optional{0, 0},
-}
-
-var listBulkImportElementsSchema = map[string]interface{}{
-	"bulk_imports": []map[string]interface{}{
-		{
-			"name":          "",
-			"database":      Optional{"", nil},
-			"table":         Optional{"", nil},
-			"status":        Optional{"", nil},
-			"job_id":        Optional{"", nil},
-			"upload_frozen": false,
-			"valid_records": Optional{0, 0},
-			"error_records": Optional{0, 0},
-			"valid_parts":   Optional{0, 0},
-			"error_parts":   Optional{0, 0},
-		},
-	},
+type listBulkImportElementsBody struct {
+	BulkImports ListBulkImportElements `td:"bulk_imports"`
 }
 
 type ListBulkImportParts struct {
-	Name       string
-	BulkImport string
-	Parts      []string
-}
-
-var listBulkImportPartsSchema = map[string]interface{}{
-	"name":        "",
-	"bulk_import": "",
-	"parts":       []string{},
+	Name       string   `td:"name"`
+	BulkImport string   `td:"bulk_import"`
+	Parts      []string `td:"parts"`
 }
 
 type PerformBulkImportResult struct {
-	Name       string
-	BulkImport string
-	JobID      string
+	Name       string `td:"name"`
+	BulkImport string `td:"bulk_import"`
+	JobID      string `td:"job_id"`
 }
 
-var performBulkImportResultSchema = map[string]interface{}{
-	"name":        "",
-	"bulk_import": "",
-	"job_id":      int64(0),
+func (client *TDClient) CreateBulkImport(name string, db string, table string, options map[string]string) (*BulkImportResult, error) {
+	return client.CreateBulkImportContext(context.Background(), name, db, table, options)
 }
 
-func (client *TDClient) CreateBulkImport(name string, db string, table string, options map[string]string) (*BulkImportResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/create/%s/%s/%s", url.QueryEscape(name), url.QueryEscape(db), url.QueryEscape(table)), dictToValues(options))
+func (client *TDClient) CreateBulkImportContext(ctx context.Context, name string, db string, table string, options map[string]string) (*BulkImportResult, error) {
+	resp, err := client.post(ctx, "CreateBulkImport", fmt.Sprintf("/v3/bulk_import/create/%s/%s/%s", url.QueryEscape(name), url.QueryEscape(db), url.QueryEscape(table)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -112,18 +73,20 @@ func (client *TDClient) CreateBulkImport(name string, db string, table string, o
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for create bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportResultSchema)
+	result := BulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) DeleteBulkImport(name string, options map[string]string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/delete/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.DeleteBulkImportContext(context.Background(), name, options)
+}
+
+func (client *TDClient) DeleteBulkImportContext(ctx context.Context, name string, options map[string]string) error {
+	resp, err := client.post(ctx, "DeleteBulkImport", fmt.Sprintf("/v3/bulk_import/delete/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return err
 	}
@@ -131,15 +94,15 @@ func (client *TDClient) DeleteBulkImport(name string, options map[string]string)
 	if resp.StatusCode != 200 {
 		return client.buildError(resp, -1, "Failed for delete bulk import", nil)
 	}
-	_, err = client.checkedJson(resp, bulkImportResultSchema)
-	if err != nil {
-		return err
-	}
-	return nil
+	return client.checkedJson(resp, &BulkImportResult{})
 }
 
 func (client *TDClient) ShowBulkImport(name string) (*BulkImportElement, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/bulk_import/show/%s", url.QueryEscape(name)), nil)
+	return client.ShowBulkImportContext(context.Background(), name)
+}
+
+func (client *TDClient) ShowBulkImportContext(ctx context.Context, name string) (*BulkImportElement, error) {
+	resp, err := client.get(ctx, "ShowBulkImport", fmt.Sprintf("/v3/bulk_import/show/%s", url.QueryEscape(name)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -147,27 +110,20 @@ func (client *TDClient) ShowBulkImport(name string) (*BulkImportElement, error)
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for show bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportElementSchema)
+	result := BulkImportElement{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportElement{
-		Name:         js["name"].(string),
-		Database:     js["database"].(string),
-		Table:        js["table"].(string),
-		JobID:        js["job_id"].(string),
-		Status:       js["status"].(string),
-		UploadFrozen: js["upload_frozen"].(bool),
-		ValidRecords: js["valid_records"].(int),
-		ErrorRecords: js["error_records"].(int),
-		ValidParts:   js["valid_parts"].(int),
-		ErrorParts:   js["error_parts"].(int),
-	}, nil
-
+	return &result, nil
 }
 
 func (client *TDClient) ListBulkImports(options map[string]string) (*ListBulkImportElements, error) {
-	resp, err := client.get("/v3/bulk_import/list", dictToValues(options))
+	return client.ListBulkImportsContext(context.Background(), options)
+}
+
+func (client *TDClient) ListBulkImportsContext(ctx context.Context, options map[string]string) (*ListBulkImportElements, error) {
+	resp, err := client.get(ctx, "ListBulkImports", "/v3/bulk_import/list", dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -175,31 +131,20 @@ func (client *TDClient) ListBulkImports(options map[string]string) (*ListBulkImp
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for show list bulk imports", nil)
 	}
-	js, err := client.checkedJson(resp, listBulkImportElementsSchema)
+	js := listBulkImportElementsBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	bulkImports := js["bulk_imports"].([]map[string]interface{})
-	listBulkImportElements := make(ListBulkImportElements, len(bulkImports))
-	for i, v := range bulkImports {
-		listBulkImportElements[i] = BulkImportElement{
-			Name:         v["name"].(string),
-			Database:     v["database"].(string),
-			Table:        v["table"].(string),
-			JobID:        v["job_id"].(string),
-			Status:       v["status"].(string),
-			UploadFrozen: v["upload_frozen"].(bool),
-			ValidRecords: v["valid_records"].(int),
-			ErrorRecords: v["error_records"].(int),
-			ValidParts:   v["valid_parts"].(int),
-			ErrorParts:   v["error_parts"].(int),
-		}
-	}
-	return &listBulkImportElements, nil
+	return &js.BulkImports, nil
 }
 
 func (client *TDClient) ListBulkImportParts(name string, options map[string]string) (*ListBulkImportParts, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/bulk_import/list_parts/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.ListBulkImportPartsContext(context.Background(), name, options)
+}
+
+func (client *TDClient) ListBulkImportPartsContext(ctx context.Context, name string, options map[string]string) (*ListBulkImportParts, error) {
+	resp, err := client.get(ctx, "ListBulkImportParts", fmt.Sprintf("/v3/bulk_import/list_parts/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -207,20 +152,20 @@ func (client *TDClient) ListBulkImportParts(name string, options map[string]stri
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for show list bulk import parts", nil)
 	}
-	js, err := client.checkedJson(resp, listBulkImportPartsSchema)
+	result := ListBulkImportParts{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	parts, _ := js["parts"].([]string)
-	return &ListBulkImportParts{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-		Parts:      parts,
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) UploadBulkImportPart(name string, part_name string, blob Blob) (*BulkImportResult, error) {
-	resp, err := client.put(fmt.Sprintf("/v3/bulk_import/upload_part/%s/%s", url.QueryEscape(name), url.QueryEscape(part_name)), blob)
+	return client.UploadBulkImportPartContext(context.Background(), name, part_name, blob)
+}
+
+func (client *TDClient) UploadBulkImportPartContext(ctx context.Context, name string, part_name string, blob Blob) (*BulkImportResult, error) {
+	resp, err := client.put(ctx, "UploadBulkImportPart", fmt.Sprintf("/v3/bulk_import/upload_part/%s/%s", url.QueryEscape(name), url.QueryEscape(part_name)), blob, true)
 	if err != nil {
 		return nil, err
 	}
@@ -228,18 +173,20 @@ func (client *TDClient) UploadBulkImportPart(name string, part_name string, blob
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for upload bulk import part", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportResultSchema)
+	result := BulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) DeleteBulkImportPart(name string, part_name string, options map[string]string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/delete_part/%s/%s", url.QueryEscape(name), url.QueryEscape(part_name)), dictToValues(options))
+	return client.DeleteBulkImportPartContext(context.Background(), name, part_name, options)
+}
+
+func (client *TDClient) DeleteBulkImportPartContext(ctx context.Context, name string, part_name string, options map[string]string) error {
+	resp, err := client.post(ctx, "DeleteBulkImportPart", fmt.Sprintf("/v3/bulk_import/delete_part/%s/%s", url.QueryEscape(name), url.QueryEscape(part_name)), dictToValues(options))
 	if err != nil {
 		return err
 	}
@@ -247,15 +194,15 @@ func (client *TDClient) DeleteBulkImportPart(name string, part_name string, opti
 	if resp.StatusCode != 200 {
 		return client.buildError(resp, -1, "Failed for delete bulk import part", nil)
 	}
-	_, err = client.checkedJson(resp, bulkImportResultSchema)
-	if err != nil {
-		return err
-	}
-	return nil
+	return client.checkedJson(resp, &BulkImportResult{})
 }
 
 func (client *TDClient) FreezeBulkImport(name string, options map[string]string) (*BulkImportResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/freeze/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.FreezeBulkImportContext(context.Background(), name, options)
+}
+
+func (client *TDClient) FreezeBulkImportContext(ctx context.Context, name string, options map[string]string) (*BulkImportResult, error) {
+	resp, err := client.post(ctx, "FreezeBulkImport", fmt.Sprintf("/v3/bulk_import/freeze/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -263,18 +210,20 @@ func (client *TDClient) FreezeBulkImport(name string, options map[string]string)
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for freeze bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportResultSchema)
+	result := BulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) UnfreezeBulkImport(name string, options map[string]string) (*BulkImportResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/unfreeze/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.UnfreezeBulkImportContext(context.Background(), name, options)
+}
+
+func (client *TDClient) UnfreezeBulkImportContext(ctx context.Context, name string, options map[string]string) (*BulkImportResult, error) {
+	resp, err := client.post(ctx, "UnfreezeBulkImport", fmt.Sprintf("/v3/bulk_import/unfreeze/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -282,18 +231,20 @@ func (client *TDClient) UnfreezeBulkImport(name string, options map[string]strin
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for unfreeze bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportResultSchema)
+	result := BulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) PerformBulkImport(name string, options map[string]string) (*PerformBulkImportResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/perform/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.PerformBulkImportContext(context.Background(), name, options)
+}
+
+func (client *TDClient) PerformBulkImportContext(ctx context.Context, name string, options map[string]string) (*PerformBulkImportResult, error) {
+	resp, err := client.post(ctx, "PerformBulkImport", fmt.Sprintf("/v3/bulk_import/perform/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -301,19 +252,20 @@ func (client *TDClient) PerformBulkImport(name string, options map[string]string
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for perform bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, performBulkImportResultSchema)
+	result := PerformBulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &PerformBulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-		JobID:      strconv.FormatInt(js["job_id"].(int64), 10),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) CommitBulkImport(name string, options map[string]string) (*BulkImportResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/bulk_import/commit/%s", url.QueryEscape(name)), dictToValues(options))
+	return client.CommitBulkImportContext(context.Background(), name, options)
+}
+
+func (client *TDClient) CommitBulkImportContext(ctx context.Context, name string, options map[string]string) (*BulkImportResult, error) {
+	resp, err := client.post(ctx, "CommitBulkImport", fmt.Sprintf("/v3/bulk_import/commit/%s", url.QueryEscape(name)), dictToValues(options))
 	if err != nil {
 		return nil, err
 	}
@@ -321,12 +273,10 @@ func (client *TDClient) CommitBulkImport(name string, options map[string]string)
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Failed for commit bulk import", nil)
 	}
-	js, err := client.checkedJson(resp, bulkImportResultSchema)
+	result := BulkImportResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &BulkImportResult{
-		Name:       js["name"].(string),
-		BulkImport: js["bulk_import"].(string),
-	}, nil
+	return &result, nil
 }
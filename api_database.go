@@ -19,6 +19,7 @@
 package td_client
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -27,34 +28,27 @@ import (
 // ListDataBasesResultElement represents an item of the result of
 // ListDatabases API call
 type ListDataBasesResultElement struct {
-	Name            string
-	Organization    string
-	Count           int
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
-	Permission      string
-	DeleteProtected bool
+	Name            string    `td:"name"`
+	Organization    string    `td:"organization,optional"`
+	Count           int       `td:"count"`
+	CreatedAt       time.Time `td:"created_at"`
+	UpdatedAt       time.Time `td:"updated_at"`
+	Permission      string    `td:"permission"`
+	DeleteProtected bool      `td:"delete_protected"`
 }
 
-// ListDataBasesResult is a collection of ListDataBasesResultElement
 type ListDataBasesResult []ListDataBasesResultElement
 
-var listDatabasesSchema = map[string]interface{}{
-	"databases": []map[string]interface{}{
-		map[string]interface{}{
-			"name":             "",
-			"organization":     Optional{"", ""},
-			"count":            0,
-			"created_at":       time.Time{},
-			"updated_at":       time.Time{},
-			"permission":       "",
-			"delete_protected": false,
-		},
-	},
+type listDatabasesBody struct {
+	Databases ListDataBasesResult `td:"databases"`
 }
 
 func (client *TDClient) ShowDatabase(dbname string) (*ListDataBasesResultElement, error) {
-	result, err := client.ListDatabases()
+	return client.ShowDatabaseContext(context.Background(), dbname)
+}
+
+func (client *TDClient) ShowDatabaseContext(ctx context.Context, dbname string) (*ListDataBasesResultElement, error) {
+	result, err := client.ListDatabasesContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +63,11 @@ func (client *TDClient) ShowDatabase(dbname string) (*ListDataBasesResultElement
 }
 
 func (client *TDClient) ListDatabases() (*ListDataBasesResult, error) {
-	resp, err := client.get("/v3/database/list", nil)
+	return client.ListDatabasesContext(context.Background())
+}
+
+func (client *TDClient) ListDatabasesContext(ctx context.Context) (*ListDataBasesResult, error) {
+	resp, err := client.get(ctx, "ListDatabases", "/v3/database/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -77,28 +75,20 @@ func (client *TDClient) ListDatabases() (*ListDataBasesResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List databases failed", nil)
 	}
-	js, err := client.checkedJson(resp, listDatabasesSchema)
+	js := listDatabasesBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	databases := js["databases"].([]map[string]interface{})
-	retval := make(ListDataBasesResult, len(databases))
-	for i, v := range databases {
-		retval[i] = ListDataBasesResultElement{
-			Name:            v["name"].(string),
-			Organization:    v["organization"].(string),
-			Count:           v["count"].(int),
-			CreatedAt:       v["created_at"].(time.Time),
-			UpdatedAt:       v["updated_at"].(time.Time),
-			Permission:      v["permission"].(string),
-			DeleteProtected: v["delete_protected"].(bool),
-		}
-	}
-	return &retval, nil
+	return &js.Databases, nil
 }
 
 func (client *TDClient) DeleteDatabase(db string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/database/delete/%s", url.QueryEscape(db)), nil)
+	return client.DeleteDatabaseContext(context.Background(), db)
+}
+
+func (client *TDClient) DeleteDatabaseContext(ctx context.Context, db string) error {
+	resp, err := client.post(ctx, "DeleteDatabase", fmt.Sprintf("/v3/database/delete/%s", url.QueryEscape(db)), nil)
 	if err != nil {
 		return err
 	}
@@ -110,7 +100,11 @@ func (client *TDClient) DeleteDatabase(db string) error {
 }
 
 func (client *TDClient) CreateDatabase(db string, options map[string]string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/database/create/%s", url.QueryEscape(db)), dictToValues(options))
+	return client.CreateDatabaseContext(context.Background(), db, options)
+}
+
+func (client *TDClient) CreateDatabaseContext(ctx context.Context, db string, options map[string]string) error {
+	resp, err := client.post(ctx, "CreateDatabase", fmt.Sprintf("/v3/database/create/%s", url.QueryEscape(db)), dictToValues(options))
 	if err != nil {
 		return err
 	}
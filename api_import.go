@@ -20,22 +20,26 @@ package td_client
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"net/url"
 )
 
-var importSchema = map[string]interface{}{
-	"unique_id":    Optional{"", ""},
-	"database":     "",
-	"table":        "",
-	"md5_hex":      "",
-	"elapsed_time": 0.,
+type importBody struct {
+	UniqueId    string  `td:"unique_id,optional"`
+	Database    string  `td:"database"`
+	Table       string  `td:"table"`
+	MD5Hex      string  `td:"md5_hex"`
+	ElapsedTime float64 `td:"elapsed_time"`
 }
 
 // `Import` API call.
 func (client *TDClient) Import(db string, table string, format string, blob Blob, uniqueId string) (float64, error) {
+	return client.ImportContext(context.Background(), db, table, format, blob, uniqueId)
+}
+
+func (client *TDClient) ImportContext(ctx context.Context, db string, table string, format string, blob Blob, uniqueId string) (float64, error) {
 	requestUri := ""
 	if uniqueId != "" {
 		requestUri = fmt.Sprintf(
@@ -53,7 +57,7 @@ func (client *TDClient) Import(db string, table string, format string, blob Blob
 			url.QueryEscape(format),
 		)
 	}
-	resp, err := client.put(requestUri, blob)
+	resp, err := client.put(ctx, "Import", requestUri, blob, uniqueId != "")
 	if err != nil {
 		return 0., err
 	}
@@ -61,23 +65,22 @@ func (client *TDClient) Import(db string, table string, format string, blob Blob
 	if resp.StatusCode/100 != 2 {
 		return 0., client.buildError(resp, -1, "Import failed", nil)
 	}
-	js, err := client.checkedJson(resp, importSchema)
+	js := importBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return 0., err
 	}
 	expectedMD5Sum, err := blob.MD5Sum()
 	if err == nil {
-		md5Hex := js["md5_hex"].(string)
-		if md5Hex != "" {
-			md5Sum, err := hex.DecodeString(md5Hex)
+		if js.MD5Hex != "" {
+			md5Sum, err := hex.DecodeString(js.MD5Hex)
 			if err != nil {
 				return 0., err
 			}
 			if !bytes.Equal(md5Sum, expectedMD5Sum) {
-				return 0., errors.New("Checksum mismatch")
+				return 0., newAPIError(resp, ChecksumMismatchError, "Checksum mismatch", nil)
 			}
 		}
 	}
-	time_ := js["elapsed_time"].(float64)
-	return time_, nil
+	return js.ElapsedTime, nil
 }
@@ -19,30 +19,36 @@
 package td_client
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 type ListJobsResultElement struct {
-	Id         string
-	Type       string
-	Database   string
-	Status     string
-	Query      string
-	Duration   int
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	StartAt    time.Time
-	EndAt      time.Time
-	CpuTime    float64
-	ResultSize int
-	NumRecords int
-	ResultUrl  string
-	Priority   int
-	RetryLimit int
+	Id               string        `td:"job_id"`
+	Type             string        `td:"type,optional,default=?"`
+	Database         string        `td:"database"`
+	Status           string        `td:"status"`
+	Query            string        `td:"query"`
+	Duration         int           `td:"duration,optional"`
+	CreatedAt        time.Time     `td:"created_at"`
+	UpdatedAt        time.Time     `td:"updated_at"`
+	StartAt          time.Time     `td:"start_at,optional"`
+	EndAt            time.Time     `td:"end_at,optional"`
+	CpuTime          float64       `td:"cpu_time,optional"`
+	ResultSize       int           `td:"result_size,optional"`
+	NumRecords       int           `td:"num_records,optional"`
+	ResultUrl        string        `td:"result"`
+	Priority         int           `td:"priority"`
+	RetryLimit       int           `td:"retry_limit"`
+	UserName         string        `td:"user_name,optional"`
+	Url              string        `td:"url,optional"`
+	Organization     string        `td:"organization,optional"`
+	HiveResultSchema []interface{} `td:"hive_result_schema,optional,json"`
 }
 
 type ListJobsResultElements []ListJobsResultElement
@@ -54,109 +60,68 @@ type ListJobsResult struct {
 	To                     int
 }
 
-var listJobsSchema = map[string]interface{}{
-	"jobs": []map[string]interface{}{
-		{
-			"job_id":                      "",
-			"type":                        Optional{"", "?"},
-			"database":                    "",
-			"status":                      "",
-			"query":                       "",
-			"start_at":                    Optional{time.Time{}, time.Time{}},
-			"end_at":                      Optional{time.Time{}, time.Time{}},
-			"created_at":                  time.Time{},
-			"updated_at":                  time.Time{},
-			"duration":                    Optional{0, 0},
-			"cpu_time":                    Optional{0., 0.},
-			"result_size":                 Optional{0, 0},
-			"num_records":                 Optional{0, 0},
-			"user_name":                   "",
-			"result":                      "",
-			"url":                         "",
-			"hive_result_schema":          Optional{"", "?"},
-			"organization":                Optional{"", "?"},
-			"priority":                    0,
-			"retry_limit":                 0,
-			"result_export_target_job_id": Optional{0., 0.},
-			"linked_result_export_job_id": Optional{0., 0.},
-		},
-	},
-	"count": Optional{0, 0},
-	"to":    Optional{0, 0},
-	"from":  Optional{0, 0},
-}
-
-var jobStatusSchema = map[string]interface{}{
-	"status":      "",
-	"job_id":      "",
-	"start_at":    Optional{time.Time{}, time.Time{}},
-	"created_at":  time.Time{},
-	"updated_at":  time.Time{},
-	"end_at":      Optional{time.Time{}, time.Time{}},
-	"duration":    Optional{0, 0},
-	"cpu_time":    Optional{0., 0.},
-	"result_size": Optional{0, 0},
-	"num_records": Optional{0, 0},
+type listJobsBody struct {
+	Jobs []struct {
+		ListJobsResultElement
+		_ struct{} `td:"result_export_target_job_id,optional"`
+		_ struct{} `td:"linked_result_export_job_id,optional"`
+	} `td:"jobs"`
+	Count int `td:"count,optional"`
+	From  int `td:"from,optional"`
+	To    int `td:"to,optional"`
+}
+
+type jobStatusBody struct {
+	Status string   `td:"status"`
+	_      struct{} `td:"job_id,optional"`
+	_      struct{} `td:"start_at,optional"`
+	_      struct{} `td:"created_at,optional"`
+	_      struct{} `td:"updated_at,optional"`
+	_      struct{} `td:"end_at,optional"`
+	_      struct{} `td:"duration,optional"`
+	_      struct{} `td:"cpu_time,optional"`
+	_      struct{} `td:"result_size,optional"`
+	_      struct{} `td:"num_records,optional"`
 }
 
 type ShowJobResultDebugElement struct {
-	CmdOut string
-	StdErr string
+	CmdOut string `td:"cmdout,optional"`
+	StdErr string `td:"stderr,optional"`
 }
 
 // ShowJobResult stores the result of `ShowJobResult` API call.
 type ShowJobResult struct {
-	Id               string
-	Type             string
-	Database         string
-	UserName         string
-	Status           string
-	Query            string
-	Debug            ShowJobResultDebugElement
-	Url              string
-	Duration         int
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	StartAt          time.Time
-	EndAt            time.Time
-	CpuTime          float64
-	ResultSize       int
-	NumRecords       int
-	ResultUrl        string
-	Priority         int
-	RetryLimit       int
-	HiveResultSchema []interface{}
-}
-
-var showJobSchema = map[string]interface{}{
-	"job_id":       "",
-	"type":         Optional{"", "?"},
-	"organization": Optional{"", ""},
-	"user_name":    "",
-	"database":     "",
-	"status":       "",
-	"query":        "",
-	"debug": map[string]interface{}{
-		"cmdout": Optional{"", ""},
-		"stderr": Optional{"", ""},
-	},
-	"url":                         "",
-	"duration":                    Optional{0, 0},
-	"created_at":                  time.Time{},
-	"updated_at":                  time.Time{},
-	"start_at":                    Optional{time.Time{}, time.Time{}},
-	"end_at":                      Optional{time.Time{}, time.Time{}},
-	"cpu_time":                    Optional{0., 0.},
-	"result_size":                 Optional{0, 0},
-	"num_records":                 Optional{0, 0},
-	"result":                      "",
-	"priority":                    0,
-	"retry_limit":                 0,
-	"hive_result_schema":          Optional{EmbeddedJSON([]interface{}{}), nil},
-	"result_export_target_job_id": Optional{0., 0.},
-	"linked_result_export_job_id": Optional{0., 0.},
+	Id               string                    `td:"job_id"`
+	Type             string                    `td:"type,optional,default=?"`
+	Database         string                    `td:"database"`
+	UserName         string                    `td:"user_name"`
+	Status           string                    `td:"status"`
+	Query            string                    `td:"query"`
+	Debug            ShowJobResultDebugElement `td:"debug"`
+	Url              string                    `td:"url"`
+	Duration         int                       `td:"duration,optional"`
+	CreatedAt        time.Time                 `td:"created_at"`
+	UpdatedAt        time.Time                 `td:"updated_at"`
+	StartAt          time.Time                 `td:"start_at,optional"`
+	EndAt            time.Time                 `td:"end_at,optional"`
+	CpuTime          float64                   `td:"cpu_time,optional"`
+	ResultSize       int                       `td:"result_size,optional"`
+	NumRecords       int                       `td:"num_records,optional"`
+	ResultUrl        string                    `td:"result"`
+	Priority         int                       `td:"priority"`
+	RetryLimit       int                       `td:"retry_limit"`
+	HiveResultSchema []interface{}             `td:"hive_result_schema,optional,json"`
+}
+
+type showJobBody struct {
+	ShowJobResult
+	_ struct{} `td:"organization,optional"`
+	_ struct{} `td:"result_export_target_job_id,optional"`
+	_ struct{} `td:"linked_result_export_job_id,optional"`
 }
 
+// Query is the query submitted by SubmitQuery.  Priority and RetryLimit are sent unless negative, so their zero values
+// ask for the normal priority and no retry; use NewQuery and SubmitQueryWithOptions to submit a query with a low priority.
 type Query struct {
 	Type          string
 	Query         string
@@ -164,18 +129,24 @@ type Query struct {
 	Priority      int
 	RetryLimit    int
 	EngineVersion string
+	PoolName      string // Resource pool the job runs in.
+	DomainKey     string // Idempotency key; the server rejects a second job issued with the same key.
 }
 
-var submitJobSchema = map[string]interface{}{
-	"job":      "",
-	"job_id":   "",
-	"database": "",
+type submitJobBody struct {
+	Job      string `td:"job"`
+	JobId    string `td:"job_id"`
+	Database string `td:"database"`
 }
 
+// jobStatuses are the statuses ListJobsOptions.WithStatus accepts.
+var jobStatuses = map[string]bool{"queued": true, "running": true, "success": true, "error": true, "killed": true}
+
 type ListJobsOptions struct {
-	from   string
-	to     string
-	status string
+	from       string
+	to         string
+	status     string
+	slowerThan string
 }
 
 func (options *ListJobsOptions) WithFrom(from int) *ListJobsOptions {
@@ -188,14 +159,28 @@ func (options *ListJobsOptions) WithTo(to int) *ListJobsOptions {
 	return options
 }
 
+// WithStatus limits the jobs to those in the status, which is one of queued, running, success, error and killed.
+// ListJobsWithOptions fails for any other status.
 func (options *ListJobsOptions) WithStatus(status string) *ListJobsOptions {
-	if status == "running" || status == "queued" || status == "success" || status == "error" {
-		options.status = status
-	}
+	options.status = status
+	return options
+}
+
+// WithSlowerThan limits the jobs to those that have run for longer than the duration, truncated to seconds.
+func (options *ListJobsOptions) WithSlowerThan(duration time.Duration) *ListJobsOptions {
+	options.slowerThan = strconv.FormatInt(int64(duration/time.Second), 10)
 	return options
 }
 
 func (client *TDClient) ListJobsWithOptions(options *ListJobsOptions) (*ListJobsResult, error) {
+	return client.ListJobsWithOptionsContext(context.Background(), options)
+}
+
+func (client *TDClient) ListJobsWithOptionsContext(ctx context.Context, options *ListJobsOptions) (*ListJobsResult, error) {
+	return client.listJobs(ctx, "ListJobsWithOptions", options)
+}
+
+func (client *TDClient) listJobs(ctx context.Context, operation string, options *ListJobsOptions) (*ListJobsResult, error) {
 	requestUri := "/v3/job/list"
 	u, err := url.Parse(requestUri)
 	if err != nil {
@@ -210,10 +195,16 @@ func (client *TDClient) ListJobsWithOptions(options *ListJobsOptions) (*ListJobs
 		queryString.Set("to", options.to)
 	}
 	if options.status != "" {
+		if !jobStatuses[options.status] {
+			return nil, fmt.Errorf("unsupported job status: %s", options.status)
+		}
 		queryString.Set("status", options.status)
 	}
+	if options.slowerThan != "" {
+		queryString.Set("slower_than", options.slowerThan)
+	}
 
-	resp, err := client.get(requestUri, queryString)
+	resp, err := client.get(ctx, operation, requestUri, queryString)
 	if err != nil {
 		return nil, err
 	}
@@ -221,44 +212,37 @@ func (client *TDClient) ListJobsWithOptions(options *ListJobsOptions) (*ListJobs
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List jobs failed", nil)
 	}
-	js, err := client.checkedJson(resp, listJobsSchema)
+	js := listJobsBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	jobs := js["jobs"].([]map[string]interface{})
-	listJobsResult := ListJobsResult{}
-	retval := make(ListJobsResultElements, len(jobs))
-	for i, v := range jobs {
-		retval[i] = ListJobsResultElement{
-			Id:         v["job_id"].(string),
-			Type:       v["type"].(string),
-			Database:   v["database"].(string),
-			Status:     v["status"].(string),
-			Query:      v["query"].(string),
-			StartAt:    v["start_at"].(time.Time),
-			EndAt:      v["end_at"].(time.Time),
-			Duration:   v["duration"].(int),
-			CpuTime:    v["cpu_time"].(float64),
-			ResultSize: v["result_size"].(int),
-			NumRecords: v["num_records"].(int),
-			ResultUrl:  v["result"].(string),
-			Priority:   v["priority"].(int),
-			RetryLimit: v["retry_limit"].(int),
-		}
+	retval := make(ListJobsResultElements, len(js.Jobs))
+	for i, v := range js.Jobs {
+		retval[i] = v.ListJobsResultElement
 	}
-	listJobsResult.ListJobsResultElements = retval
-	listJobsResult.Count = js["count"].(int)
-	listJobsResult.From = js["from"].(int)
-	listJobsResult.To = js["to"].(int)
-	return &listJobsResult, nil
+	return &ListJobsResult{
+		ListJobsResultElements: retval,
+		Count:                  js.Count,
+		From:                   js.From,
+		To:                     js.To,
+	}, nil
 }
 
 func (client *TDClient) ListJobs() (*ListJobsResult, error) {
-	return client.ListJobsWithOptions(&ListJobsOptions{})
+	return client.ListJobsContext(context.Background())
+}
+
+func (client *TDClient) ListJobsContext(ctx context.Context) (*ListJobsResult, error) {
+	return client.listJobs(ctx, "ListJobs", &ListJobsOptions{})
 }
 
 func (client *TDClient) ShowJob(jobId string) (*ShowJobResult, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/job/show/%s", url.QueryEscape(jobId)), nil)
+	return client.ShowJobContext(context.Background(), jobId)
+}
+
+func (client *TDClient) ShowJobContext(ctx context.Context, jobId string) (*ShowJobResult, error) {
+	resp, err := client.get(ctx, "ShowJob", fmt.Sprintf("/v3/job/show/%s", url.QueryEscape(jobId)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -266,41 +250,20 @@ func (client *TDClient) ShowJob(jobId string) (*ShowJobResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Show job failed", nil)
 	}
-	js, err := client.checkedJson(resp, showJobSchema)
+	js := showJobBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	typeStr := js["type"].(string)
-	hiveResultSchema, _ := js["hive_result_schema"].([]interface{})
-	return &ShowJobResult{
-		Id:       js["job_id"].(string),
-		Type:     typeStr,
-		Database: js["database"].(string),
-		UserName: js["user_name"].(string),
-		Status:   js["status"].(string),
-		Query:    js["query"].(string),
-		Debug: ShowJobResultDebugElement{
-			CmdOut: js["debug"].(map[string]interface{})["cmdout"].(string),
-			StdErr: js["debug"].(map[string]interface{})["stderr"].(string),
-		},
-		Url:              js["url"].(string),
-		CreatedAt:        js["created_at"].(time.Time),
-		UpdatedAt:        js["updated_at"].(time.Time),
-		StartAt:          js["start_at"].(time.Time),
-		EndAt:            js["end_at"].(time.Time),
-		Duration:         js["duration"].(int),
-		CpuTime:          js["cpu_time"].(float64),
-		ResultSize:       js["result_size"].(int),
-		NumRecords:       js["num_records"].(int),
-		ResultUrl:        js["result"].(string),
-		Priority:         js["priority"].(int),
-		RetryLimit:       js["retry_limit"].(int),
-		HiveResultSchema: hiveResultSchema,
-	}, nil
+	return &js.ShowJobResult, nil
 }
 
 func (client *TDClient) JobStatus(jobId string) (string, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/job/status/%s", url.QueryEscape(jobId)), nil)
+	return client.JobStatusContext(context.Background(), jobId)
+}
+
+func (client *TDClient) JobStatusContext(ctx context.Context, jobId string) (string, error) {
+	resp, err := client.get(ctx, "JobStatus", fmt.Sprintf("/v3/job/status/%s", url.QueryEscape(jobId)), nil)
 	if err != nil {
 		return "", err
 	}
@@ -308,15 +271,24 @@ func (client *TDClient) JobStatus(jobId string) (string, error) {
 	if resp.StatusCode != 200 {
 		return "", client.buildError(resp, -1, "Get job status failed", nil)
 	}
-	js, err := client.checkedJson(resp, jobStatusSchema)
+	js := jobStatusBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return "", err
 	}
-	return js["status"].(string), nil
+	return js.Status, nil
 }
 
 func (client *TDClient) JobResult(jobId string, format string, reader func(io.Reader) error) error {
-	resp, err := client.get(fmt.Sprintf("/v3/job/result/%s", url.QueryEscape(jobId)), url.Values{"format": {format}})
+	return client.JobResultContext(context.Background(), jobId, format, reader)
+}
+
+func (client *TDClient) JobResultContext(ctx context.Context, jobId string, format string, reader func(io.Reader) error) error {
+	return client.jobResult(ctx, "JobResult", jobId, format, reader)
+}
+
+func (client *TDClient) jobResult(ctx context.Context, operation string, jobId string, format string, reader func(io.Reader) error) error {
+	resp, err := client.get(ctx, operation, fmt.Sprintf("/v3/job/result/%s", url.QueryEscape(jobId)), url.Values{"format": {format}})
 	if err != nil {
 		return err
 	}
@@ -328,7 +300,12 @@ func (client *TDClient) JobResult(jobId string, format string, reader func(io.Re
 }
 
 func (client *TDClient) JobResultEach(jobId string, reader func(interface{}) error) error {
-	return client.JobResult(jobId, "msgpack", func(r io.Reader) error {
+	return client.JobResultEachContext(context.Background(), jobId, reader)
+}
+
+func (client *TDClient) JobResultEachContext(ctx context.Context, jobId string, reader func(interface{}) error) error {
+	ctx, decodedRows := withRowCounter(ctx)
+	return client.jobResult(ctx, "JobResultEach", jobId, "msgpack", func(r io.Reader) error {
 		dec := client.getMessagePackDecoder(r)
 		for {
 			v := (interface{})(nil)
@@ -338,11 +315,12 @@ func (client *TDClient) JobResultEach(jobId string, reader func(interface{}) err
 					break
 				}
 				return &APIError{
-					Type:    GenericError,
+					Type:    InvalidResponseError,
 					Message: "Invalid MessagePack stream",
 					Cause:   err,
 				}
 			}
+			atomic.AddInt64(decodedRows, 1)
 			err = reader(v)
 			if err != nil {
 				return &APIError{
@@ -357,7 +335,11 @@ func (client *TDClient) JobResultEach(jobId string, reader func(interface{}) err
 }
 
 func (client *TDClient) KillJob(jobId string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/job/kill/%s", url.QueryEscape(jobId)), nil)
+	return client.KillJobContext(context.Background(), jobId)
+}
+
+func (client *TDClient) KillJobContext(ctx context.Context, jobId string) error {
+	resp, err := client.post(ctx, "KillJob", fmt.Sprintf("/v3/job/kill/%s", url.QueryEscape(jobId)), nil)
 	if err != nil {
 		return err
 	}
@@ -368,7 +350,16 @@ func (client *TDClient) KillJob(jobId string) error {
 	return nil
 }
 
+// SubmitQuery issues the query as a job and returns the id of the job.
+//
+// A query with a DomainKey is retried after a transient failure.  If the first attempt reached the server but
+// its response was lost, the retry is rejected with an APIError matching ErrAlreadyExists, as the job has been
+// issued under the key.
 func (client *TDClient) SubmitQuery(db string, q Query) (string, error) {
+	return client.SubmitQueryContext(context.Background(), db, q)
+}
+
+func (client *TDClient) SubmitQueryContext(ctx context.Context, db string, q Query) (string, error) {
 	params := url.Values{}
 	params.Set("query", q.Query)
 	if q.ResultUrl != "" {
@@ -383,7 +374,18 @@ func (client *TDClient) SubmitQuery(db string, q Query) (string, error) {
 	if q.EngineVersion != "" {
 		params.Set("engine_version", q.EngineVersion)
 	}
-	resp, err := client.post(fmt.Sprintf("/v3/job/issue/%s/%s", url.QueryEscape(q.Type), url.QueryEscape(db)), params)
+	if q.PoolName != "" {
+		params.Set("pool_name", q.PoolName)
+	}
+	if q.DomainKey != "" {
+		params.Set("domain_key", q.DomainKey)
+	}
+	return client.submitQuery(ctx, "SubmitQuery", q.Type, db, params)
+}
+
+func (client *TDClient) submitQuery(ctx context.Context, operation string, type_ string, db string, params url.Values) (string, error) {
+	// a query is safe to replay only if the server can tell the retry from a new submission.
+	resp, err := client.send(ctx, operation, "POST", fmt.Sprintf("/v3/job/issue/%s/%s", url.QueryEscape(type_), url.QueryEscape(db)), params, nil, params.Get("domain_key") != "")
 	if err != nil {
 		return "", err
 	}
@@ -391,17 +393,22 @@ func (client *TDClient) SubmitQuery(db string, q Query) (string, error) {
 	if resp.StatusCode != 200 {
 		return "", client.buildError(resp, -1, "Query failed", nil)
 	}
-	js, err := client.checkedJson(resp, submitJobSchema)
+	js := submitJobBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return "", err
 	}
-	return js["job_id"].(string), nil
+	return js.JobId, nil
 }
 
 func (client *TDClient) SubmitExportJob(db string, table string, storageType string, options map[string]string) (string, error) {
+	return client.SubmitExportJobContext(context.Background(), db, table, storageType, options)
+}
+
+func (client *TDClient) SubmitExportJobContext(ctx context.Context, db string, table string, storageType string, options map[string]string) (string, error) {
 	params := dictToValues(options)
 	params.Set("storage_type", storageType)
-	resp, err := client.post(fmt.Sprintf("/v3/export/run/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), params)
+	resp, err := client.post(ctx, "SubmitExportJob", fmt.Sprintf("/v3/export/run/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), params)
 	if err != nil {
 		return "", err
 	}
@@ -409,9 +416,10 @@ func (client *TDClient) SubmitExportJob(db string, table string, storageType str
 	if resp.StatusCode != 200 {
 		return "", client.buildError(resp, -1, "Export failed", nil)
 	}
-	js, err := client.checkedJson(resp, submitJobSchema)
+	js := submitJobBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return "", err
 	}
-	return js["job_id"].(string), nil
+	return js.JobId, nil
 }
@@ -19,29 +19,31 @@
 package td_client
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 )
 
 type ListResultsResultElement struct {
-	Name string
-	Url  string
+	Name string `td:"name"`
+	Url  string `td:"url"`
 }
 
 type ListResultsResult []ListResultsResultElement
 
-var listResultsSchema = map[string]interface{}{
-	"results": []map[string]string{
-		{
-			"name":         "",
-			"organization": "",
-			"url":          "",
-		},
-	},
+type listResultsBody struct {
+	Results []struct {
+		ListResultsResultElement
+		_ struct{} `td:"organization,optional"`
+	} `td:"results"`
 }
 
 func (client *TDClient) ListResults() (*ListResultsResult, error) {
-	resp, err := client.get("/v3/result/list", nil)
+	return client.ListResultsContext(context.Background())
+}
+
+func (client *TDClient) ListResultsContext(ctx context.Context) (*ListResultsResult, error) {
+	resp, err := client.get(ctx, "ListResults", "/v3/result/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -49,23 +51,24 @@ func (client *TDClient) ListResults() (*ListResultsResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List result tables failed", nil)
 	}
-	js, err := client.checkedJson(resp, listResultsSchema)
+	js := listResultsBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	results := js["results"].([]map[string]string)
-	retval := make(ListResultsResult, len(results))
-	for i, v := range results {
-		retval[i] = ListResultsResultElement{
-			Name: v["name"],
-			Url:  v["url"],
-		}
+	retval := make(ListResultsResult, len(js.Results))
+	for i, v := range js.Results {
+		retval[i] = v.ListResultsResultElement
 	}
 	return &retval, nil
 }
 
 func (client *TDClient) CreateResult(name, url_ string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/result/create/%s", url.QueryEscape(name)), url.Values{"url": {url_}})
+	return client.CreateResultContext(context.Background(), name, url_)
+}
+
+func (client *TDClient) CreateResultContext(ctx context.Context, name, url_ string) error {
+	resp, err := client.post(ctx, "CreateResult", fmt.Sprintf("/v3/result/create/%s", url.QueryEscape(name)), url.Values{"url": {url_}})
 	if err != nil {
 		return err
 	}
@@ -77,7 +80,11 @@ func (client *TDClient) CreateResult(name, url_ string) error {
 }
 
 func (client *TDClient) DeleteResult(name string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/result/delete/%s", url.QueryEscape(name)), nil)
+	return client.DeleteResultContext(context.Background(), name)
+}
+
+func (client *TDClient) DeleteResultContext(ctx context.Context, name string) error {
+	resp, err := client.post(ctx, "DeleteResult", fmt.Sprintf("/v3/result/delete/%s", url.QueryEscape(name)), nil)
 	if err != nil {
 		return err
 	}
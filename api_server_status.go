@@ -18,16 +18,18 @@
 
 package td_client
 
+import "context"
+
 type ServerStatusResult struct {
-	Status string
+	Status string `td:"status"`
 }
 
-var serverStatusSchema = map[string]interface{}{
-	"status": "",
+func (client *TDClient) ServerStatus() (*ServerStatusResult, error) {
+	return client.ServerStatusContext(context.Background())
 }
 
-func (client *TDClient) ServerStatus() (*ServerStatusResult, error) {
-	resp, err := client.get("/v3/system/server_status", nil)
+func (client *TDClient) ServerStatusContext(ctx context.Context) (*ServerStatusResult, error) {
+	resp, err := client.get(ctx, "ServerStatus", "/v3/system/server_status", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -35,11 +37,10 @@ func (client *TDClient) ServerStatus() (*ServerStatusResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Server is down", nil)
 	}
-	js, err := client.checkedJson(resp, serverStatusSchema)
+	result := ServerStatusResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &ServerStatusResult{
-		Status: js["status"].(string),
-	}, nil
+	return &result, nil
 }
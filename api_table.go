@@ -19,86 +19,61 @@
 package td_client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 // ListTablesResultElement represents an item of the result of ListTables API
 // call
 type ListTablesResultElement struct {
-	Id                   int
-	Name                 string
-	Type                 string
-	Count                int
-	CreatedAt            time.Time
-	UpdatedAt            time.Time
-	LastImport           time.Time
-	LastLogTimestamp     time.Time
-	EstimatedStorageSize int
-	Schema               []interface{}
-	ExpireDays           int
-	PrimaryKey           string
-	PrimaryKeyType       string
-	IncludeV             bool
+	Id                   int           `td:"id"`
+	Name                 string        `td:"name"`
+	Type                 string        `td:"type,optional,default=?"`
+	Count                int           `td:"count,optional"`
+	CreatedAt            time.Time     `td:"created_at"`
+	UpdatedAt            time.Time     `td:"updated_at"`
+	LastImport           time.Time     `td:"counter_updated_at,optional"`
+	LastLogTimestamp     time.Time     `td:"last_log_timestamp,optional"`
+	EstimatedStorageSize int           `td:"estimated_storage_size"`
+	Schema               []interface{} `td:"schema,optional,json"`
+	ExpireDays           int           `td:"expire_days,optional"`
+	PrimaryKey           string        `td:"primary_key,optional"`
+	PrimaryKeyType       string        `td:"primary_key_type,optional"`
+	IncludeV             bool          `td:"include_v"`
 }
 
-var showTableSchema = map[string]interface{}{
-	"id":                     0,
-	"name":                   "",
-	"type":                   Optional{"", "?"},
-	"count":                  Optional{0, 0},
-	"created_at":             time.Time{},
-	"updated_at":             time.Time{},
-	"counter_updated_at":     Optional{time.Time{}, time.Time{}},
-	"last_log_timestamp":     Optional{time.Time{}, time.Time{}},
-	"delete_protected":       false,
-	"estimated_storage_size": 0,
-	"schema":                 Optional{EmbeddedJSON([]interface{}{}), nil},
-	"expire_days":            Optional{0, 0},
-	"primary_key":            Optional{"", ""},
-	"primary_key_type":       Optional{"", ""},
-	"include_v":              false,
+type showTableBody struct {
+	ListTablesResultElement
+	_ struct{} `td:"delete_protected,optional"`
 }
 
 // ListTablesResult is a collection of ListTablesResultElement
 type ListTablesResult []ListTablesResultElement
 
-var listTablesSchema = map[string]interface{}{
-	"database": "",
-	"tables": []map[string]interface{}{
-		{
-			"id":                     0,
-			"name":                   "",
-			"type":                   Optional{"", "?"},
-			"count":                  Optional{0, 0},
-			"created_at":             time.Time{},
-			"updated_at":             time.Time{},
-			"counter_updated_at":     Optional{time.Time{}, time.Time{}},
-			"last_log_timestamp":     Optional{time.Time{}, time.Time{}},
-			"delete_protected":       false,
-			"estimated_storage_size": 0,
-			"schema":                 Optional{EmbeddedJSON([]interface{}{}), nil},
-			"expire_days":            Optional{0, 0},
-			"primary_key":            Optional{"", ""},
-			"primary_key_type":       Optional{"", ""},
-			"include_v":              false,
-		},
-	},
+type listTablesBody struct {
+	Database string          `td:"database"`
+	Tables   []showTableBody `td:"tables"`
 }
 
-var deleteTableSchema = map[string]interface{}{
-	"table":    "",
-	"database": "",
-	"type":     Optional{"", "?"},
+type deleteTableBody struct {
+	Table    string `td:"table"`
+	Database string `td:"database"`
+	Type     string `td:"type,optional,default=?"`
 }
 
 func (client *TDClient) ShowTable(db, table string) (*ListTablesResultElement, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/table/show/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), nil)
+	return client.ShowTableContext(context.Background(), db, table)
+}
+
+func (client *TDClient) ShowTableContext(ctx context.Context, db, table string) (*ListTablesResultElement, error) {
+	resp, err := client.get(ctx, "ShowTable", fmt.Sprintf("/v3/table/show/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -106,30 +81,20 @@ func (client *TDClient) ShowTable(db, table string) (*ListTablesResultElement, e
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Show table failed", nil)
 	}
-	js, err := client.checkedJson(resp, showTableSchema)
+	js := showTableBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	return &ListTablesResultElement{
-		Id:                   js["id"].(int),
-		Name:                 js["name"].(string),
-		Type:                 js["type"].(string),
-		Count:                js["count"].(int),
-		CreatedAt:            js["created_at"].(time.Time),
-		UpdatedAt:            js["updated_at"].(time.Time),
-		LastImport:           js["counter_updated_at"].(time.Time),
-		LastLogTimestamp:     js["last_log_timestamp"].(time.Time),
-		EstimatedStorageSize: js["estimated_storage_size"].(int),
-		Schema:               js["schema"].([]interface{}),
-		ExpireDays:           js["expire_days"].(int),
-		PrimaryKey:           js["primary_key"].(string),
-		PrimaryKeyType:       js["primary_key_type"].(string),
-		IncludeV:             js["include_v"].(bool),
-	}, nil
+	return &js.ListTablesResultElement, nil
 }
 
 func (client *TDClient) ListTables(db string) (*ListTablesResult, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/table/list/%s", url.QueryEscape(db)), nil)
+	return client.ListTablesContext(context.Background(), db)
+}
+
+func (client *TDClient) ListTablesContext(ctx context.Context, db string) (*ListTablesResult, error) {
+	resp, err := client.get(ctx, "ListTables", fmt.Sprintf("/v3/table/list/%s", url.QueryEscape(db)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -137,35 +102,20 @@ func (client *TDClient) ListTables(db string) (*ListTablesResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List tables failed", nil)
 	}
-	js, err := client.checkedJson(resp, listTablesSchema)
+	js := listTablesBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	tables := js["tables"].([]map[string]interface{})
-	retval := make(ListTablesResult, len(tables))
-	for i, v := range tables {
-		retval[i] = ListTablesResultElement{
-			Id:                   v["id"].(int),
-			Name:                 v["name"].(string),
-			Type:                 v["type"].(string),
-			Count:                v["count"].(int),
-			CreatedAt:            v["created_at"].(time.Time),
-			UpdatedAt:            v["updated_at"].(time.Time),
-			LastImport:           v["counter_updated_at"].(time.Time),
-			LastLogTimestamp:     v["last_log_timestamp"].(time.Time),
-			EstimatedStorageSize: v["estimated_storage_size"].(int),
-			Schema:               v["schema"].([]interface{}),
-			ExpireDays:           v["expire_days"].(int),
-			PrimaryKey:           v["primary_key"].(string),
-			PrimaryKeyType:       v["primary_key_type"].(string),
-			IncludeV:             v["include_v"].(bool),
-		}
+	retval := make(ListTablesResult, len(js.Tables))
+	for i, v := range js.Tables {
+		retval[i] = v.ListTablesResultElement
 	}
 	return &retval, nil
 }
 
-func (client *TDClient) createTable(db string, table string, type_ string, params map[string]string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/table/create/%s/%s/%s", url.QueryEscape(db), url.QueryEscape(table), url.QueryEscape(type_)), dictToValues(params))
+func (client *TDClient) createTable(ctx context.Context, operation string, db string, table string, type_ string, params map[string]string) error {
+	resp, err := client.post(ctx, operation, fmt.Sprintf("/v3/table/create/%s/%s/%s", url.QueryEscape(db), url.QueryEscape(table), url.QueryEscape(type_)), dictToValues(params))
 	if err != nil {
 		return err
 	}
@@ -177,11 +127,19 @@ func (client *TDClient) createTable(db string, table string, type_ string, param
 }
 
 func (client *TDClient) CreateLogTable(db string, table string) error {
-	return client.createTable(db, table, "log", nil)
+	return client.CreateLogTableContext(context.Background(), db, table)
+}
+
+func (client *TDClient) CreateLogTableContext(ctx context.Context, db string, table string) error {
+	return client.createTable(ctx, "CreateLogTable", db, table, "log", nil)
 }
 
 func (client *TDClient) SwapTable(db string, table1 string, table2 string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/table/swap/%s/%s/%s", url.QueryEscape(db), url.QueryEscape(table1), url.QueryEscape(table2)), nil)
+	return client.SwapTableContext(context.Background(), db, table1, table2)
+}
+
+func (client *TDClient) SwapTableContext(ctx context.Context, db string, table1 string, table2 string) error {
+	resp, err := client.post(ctx, "SwapTable", fmt.Sprintf("/v3/table/swap/%s/%s/%s", url.QueryEscape(db), url.QueryEscape(table1), url.QueryEscape(table2)), nil)
 	if err != nil {
 		return err
 	}
@@ -193,7 +151,11 @@ func (client *TDClient) SwapTable(db string, table1 string, table2 string) error
 }
 
 func (client *TDClient) UpdateTable(db string, table string, params map[string]string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/table/update/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), dictToValues(params))
+	return client.UpdateTableContext(context.Background(), db, table, params)
+}
+
+func (client *TDClient) UpdateTableContext(ctx context.Context, db string, table string, params map[string]string) error {
+	resp, err := client.post(ctx, "UpdateTable", fmt.Sprintf("/v3/table/update/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), dictToValues(params))
 	if err != nil {
 		return err
 	}
@@ -209,11 +171,15 @@ func (client *TDClient) UpdateTable(db string, table string, params map[string]s
 }
 
 func (client *TDClient) UpdateSchema(db string, table string, schema []interface{}) error {
+	return client.UpdateSchemaContext(context.Background(), db, table, schema)
+}
+
+func (client *TDClient) UpdateSchemaContext(ctx context.Context, db string, table string, schema []interface{}) error {
 	jsStr, err := json.Marshal(schema)
 	if err != nil {
 		return err
 	}
-	resp, err := client.post(fmt.Sprintf("/v3/table/update-schema/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), url.Values{"schema": {string(jsStr)}})
+	resp, err := client.post(ctx, "UpdateSchema", fmt.Sprintf("/v3/table/update-schema/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), url.Values{"schema": {string(jsStr)}})
 	if err != nil {
 		return err
 	}
@@ -225,7 +191,11 @@ func (client *TDClient) UpdateSchema(db string, table string, schema []interface
 }
 
 func (client *TDClient) UpdateExpire(db string, table string, expireDays int) error {
-	resp, err := client.post(fmt.Sprintf("/v3/table/update/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), url.Values{"expire_days": {strconv.Itoa(expireDays)}})
+	return client.UpdateExpireContext(context.Background(), db, table, expireDays)
+}
+
+func (client *TDClient) UpdateExpireContext(ctx context.Context, db string, table string, expireDays int) error {
+	resp, err := client.post(ctx, "UpdateExpire", fmt.Sprintf("/v3/table/update/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), url.Values{"expire_days": {strconv.Itoa(expireDays)}})
 	if err != nil {
 		return err
 	}
@@ -237,7 +207,11 @@ func (client *TDClient) UpdateExpire(db string, table string, expireDays int) er
 }
 
 func (client *TDClient) DeleteTable(db string, table string) (string, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/table/delete/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), nil)
+	return client.DeleteTableContext(context.Background(), db, table)
+}
+
+func (client *TDClient) DeleteTableContext(ctx context.Context, db string, table string) (string, error) {
+	resp, err := client.post(ctx, "DeleteTable", fmt.Sprintf("/v3/table/delete/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), nil)
 	if err != nil {
 		return "", err
 	}
@@ -245,14 +219,19 @@ func (client *TDClient) DeleteTable(db string, table string) (string, error) {
 	if resp.StatusCode != 200 {
 		return "", client.buildError(resp, -1, "Delete table failed", nil)
 	}
-	js, err := client.checkedJson(resp, deleteTableSchema)
+	js := deleteTableBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return "", err
 	}
-	return js["type"].(string), err
+	return js.Type, nil
 }
 
 func (client *TDClient) Tail(db string, table string, count int, to time.Time, from time.Time, reader func(interface{}) error) error {
+	return client.TailContext(context.Background(), db, table, count, to, from, reader)
+}
+
+func (client *TDClient) TailContext(ctx context.Context, db string, table string, count int, to time.Time, from time.Time, reader func(interface{}) error) error {
 	params := url.Values{}
 	if count > 0 {
 		params.Set("count", strconv.Itoa(count))
@@ -263,7 +242,8 @@ func (client *TDClient) Tail(db string, table string, count int, to time.Time, f
 	if !from.IsZero() {
 		params.Set("from", from.UTC().Format(TDAPIDateTime))
 	}
-	resp, err := client.post(fmt.Sprintf("/v3/table/tail/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), params)
+	ctx, decodedRows := withRowCounter(ctx)
+	resp, err := client.post(ctx, "Tail", fmt.Sprintf("/v3/table/tail/%s/%s", url.QueryEscape(db), url.QueryEscape(table)), params)
 	if err != nil {
 		return err
 	}
@@ -279,8 +259,9 @@ func (client *TDClient) Tail(db string, table string, count int, to time.Time, f
 			if err == io.EOF {
 				break
 			}
-			return client.buildError(resp, -1, "Invalid MessagePack stream", nil)
+			return client.buildError(resp, InvalidResponseError, "Invalid MessagePack stream", err)
 		}
+		atomic.AddInt64(decodedRows, 1)
 		err = reader(v)
 		if err != nil {
 			return client.buildError(resp, -1, "Reader returned error status", err)
@@ -19,6 +19,7 @@
 package td_client
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -26,78 +27,49 @@ import (
 
 // AuthenticateResult is result of authenticate API
 type AuthenticateResult struct {
-	Name   string
-	APIKey string
+	Name   string `td:"name"`
+	APIKey string `td:"apikey"`
 }
 
-var authenticateSchema = map[string]interface{}{
-	"name":   "",
-	"apikey": "",
+type ListUsersResultElement struct {
+	ID            int       `td:"id"`
+	FirstName     string    `td:"first_name,optional"`
+	LastName      string    `td:"last_name,optional"`
+	Email         string    `td:"email"`
+	Phone         string    `td:"phone,optional"`
+	GravatarURL   string    `td:"gravatar_url"`
+	Administrator bool      `td:"administrator"`
+	CreatedAt     time.Time `td:"created_at"`
+	UpdatedAt     time.Time `td:"updated_at"`
+	Name          string    `td:"name"`
+	AccountOwner  bool      `td:"account_owner"`
+	Organization  string    `td:"organization,optional"`
+	Roles         []string  `td:"roles"`
 }
 
-// ListUsersResultElement represents an item of the result of ListUsers API
-type ListUsersResultElement struct {
-	ID            int
-	FirstName     string
-	LastName      string
-	Email         string
-	Phone         string
-	GravatarURL   string
-	Administrator bool
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	AccountOwner  bool
-	Organization  string
-	Roles         []string
-}
-
-// ListUsersResult is a collection of ListUsersResultElement
 type ListUsersResult []ListUsersResultElement
 
-var listUsersSchema = map[string]interface{}{
-	"users": []map[string]interface{}{
-		{
-			"id":            0,
-			"first_name":    Optional{"", ""},
-			"last_name":     Optional{"", ""},
-			"email":         "",
-			"phone":         Optional{"", ""},
-			"gravatar_url":  "",
-			"administrator": false,
-			"created_at":    time.Time{},
-			"updated_at":    time.Time{},
-			"name":          "",
-			"account_owner": false,
-			"organization":  Optional{"", ""},
-			"roles":         []string{},
-		},
-	},
-}
-
-// ListAPIKeysResult represents the result of ListAPIKeys API
-type ListAPIKeysResult struct {
-	APIKeys []string
+type listUsersBody struct {
+	Users ListUsersResult `td:"users"`
 }
 
-var listAPIKeysSchema = map[string]interface{}{
-	"apikeys": []string{},
+type ListAPIKeysResult struct {
+	APIKeys []string `td:"apikeys"`
 }
 
-// AddAPIKeyResult represents the result of AddAPIKey API
 type AddAPIKeyResult struct {
-	APIKey string
+	APIKey string `td:"apikey"`
 }
 
-var addAPIKeySchema = map[string]interface{}{
-	"apikey": "",
+func (client *TDClient) Authenticate(email, password string) (*AuthenticateResult, error) {
+	return client.AuthenticateContext(context.Background(), email, password)
 }
 
-func (client *TDClient) Authenticate(email, password string) (*AuthenticateResult, error) {
+func (client *TDClient) AuthenticateContext(ctx context.Context, email, password string) (*AuthenticateResult, error) {
 	params := url.Values{}
 	params.Set("user", email)
 	params.Set("password", password)
-	resp, err := client.post("/v3/user/authenticate", params)
+	resp, err := client.post(ctx, "Authenticate", "/v3/user/authenticate", params)
 	if err != nil {
 		return nil, err
 	}
@@ -105,18 +77,20 @@ func (client *TDClient) Authenticate(email, password string) (*AuthenticateResul
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "Authentication failed", nil)
 	}
-	js, err := client.checkedJson(resp, authenticateSchema)
+	result := AuthenticateResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &AuthenticateResult{
-		Name:   js["name"].(string),
-		APIKey: js["apikey"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) ListUsers() (*ListUsersResult, error) {
-	resp, err := client.get("/v3/user/list", nil)
+	return client.ListUsersContext(context.Background())
+}
+
+func (client *TDClient) ListUsersContext(ctx context.Context) (*ListUsersResult, error) {
+	resp, err := client.get(ctx, "ListUsers", "/v3/user/list", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -124,34 +98,20 @@ func (client *TDClient) ListUsers() (*ListUsersResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List users failed", nil)
 	}
-	js, err := client.checkedJson(resp, listUsersSchema)
+	js := listUsersBody{}
+	err = client.checkedJson(resp, &js)
 	if err != nil {
 		return nil, err
 	}
-	users := js["users"].([]map[string]interface{})
-	retval := make(ListUsersResult, len(users))
-	for i, v := range users {
-		retval[i] = ListUsersResultElement{
-			ID:            v["id"].(int),
-			FirstName:     v["first_name"].(string),
-			LastName:      v["last_name"].(string),
-			Email:         v["email"].(string),
-			Phone:         v["phone"].(string),
-			GravatarURL:   v["gravatar_url"].(string),
-			Administrator: v["administrator"].(bool),
-			CreatedAt:     v["created_at"].(time.Time),
-			UpdatedAt:     v["updated_at"].(time.Time),
-			Name:          v["name"].(string),
-			AccountOwner:  v["account_owner"].(bool),
-			Organization:  v["organization"].(string),
-			Roles:         v["roles"].([]string),
-		}
-	}
-	return &retval, nil
+	return &js.Users, nil
 }
 
 func (client *TDClient) ListAPIKeys(email string) (*ListAPIKeysResult, error) {
-	resp, err := client.get(fmt.Sprintf("/v3/user/apikey/list/%s", url.QueryEscape(email)), nil)
+	return client.ListAPIKeysContext(context.Background(), email)
+}
+
+func (client *TDClient) ListAPIKeysContext(ctx context.Context, email string) (*ListAPIKeysResult, error) {
+	resp, err := client.get(ctx, "ListAPIKeys", fmt.Sprintf("/v3/user/apikey/list/%s", url.QueryEscape(email)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -159,22 +119,24 @@ func (client *TDClient) ListAPIKeys(email string) (*ListAPIKeysResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "List apikey failed", nil)
 	}
-	js, err := client.checkedJson(resp, listAPIKeysSchema)
+	result := ListAPIKeysResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-
-	return &ListAPIKeysResult{
-		APIKeys: js["apikeys"].([]string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) AddUser(name, org, email, password string) error {
+	return client.AddUserContext(context.Background(), name, org, email, password)
+}
+
+func (client *TDClient) AddUserContext(ctx context.Context, name, org, email, password string) error {
 	params := url.Values{}
 	params.Set("organization", org)
 	params.Set("email", email)
 	params.Set("password", password)
-	resp, err := client.post(fmt.Sprintf("/v3/user/add/%s", url.QueryEscape(name)), params)
+	resp, err := client.post(ctx, "AddUser", fmt.Sprintf("/v3/user/add/%s", url.QueryEscape(name)), params)
 	if err != nil {
 		return err
 	}
@@ -186,7 +148,11 @@ func (client *TDClient) AddUser(name, org, email, password string) error {
 }
 
 func (client *TDClient) RemoveUser(email string) error {
-	resp, err := client.post(fmt.Sprintf("/v3/user/remove/%s", url.QueryEscape(email)), nil)
+	return client.RemoveUserContext(context.Background(), email)
+}
+
+func (client *TDClient) RemoveUserContext(ctx context.Context, email string) error {
+	resp, err := client.post(ctx, "RemoveUser", fmt.Sprintf("/v3/user/remove/%s", url.QueryEscape(email)), nil)
 	if err != nil {
 		return err
 	}
@@ -198,7 +164,11 @@ func (client *TDClient) RemoveUser(email string) error {
 }
 
 func (client *TDClient) AddAPIKey(email string) (*AddAPIKeyResult, error) {
-	resp, err := client.post(fmt.Sprintf("/v3/user/apikey/add/%s", url.QueryEscape(email)), nil)
+	return client.AddAPIKeyContext(context.Background(), email)
+}
+
+func (client *TDClient) AddAPIKeyContext(ctx context.Context, email string) (*AddAPIKeyResult, error) {
+	resp, err := client.post(ctx, "AddAPIKey", fmt.Sprintf("/v3/user/apikey/add/%s", url.QueryEscape(email)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -206,19 +176,22 @@ func (client *TDClient) AddAPIKey(email string) (*AddAPIKeyResult, error) {
 	if resp.StatusCode != 200 {
 		return nil, client.buildError(resp, -1, "add apikey failed", nil)
 	}
-	js, err := client.checkedJson(resp, addAPIKeySchema)
+	result := AddAPIKeyResult{}
+	err = client.checkedJson(resp, &result)
 	if err != nil {
 		return nil, err
 	}
-	return &AddAPIKeyResult{
-		APIKey: js["apikey"].(string),
-	}, nil
+	return &result, nil
 }
 
 func (client *TDClient) RemoveAPIKey(email, apikey string) error {
+	return client.RemoveAPIKeyContext(context.Background(), email, apikey)
+}
+
+func (client *TDClient) RemoveAPIKeyContext(ctx context.Context, email, apikey string) error {
 	params := url.Values{}
 	params.Set("apikey", apikey)
-	resp, err := client.post(fmt.Sprintf("/v3/user/apikey/remove/%s", url.QueryEscape(email)), params)
+	resp, err := client.post(ctx, "RemoveAPIKey", fmt.Sprintf("/v3/user/apikey/remove/%s", url.QueryEscape(email)), params)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,267 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BulkImportPart is a part uploaded by BulkImportSession.
+type BulkImportPart struct {
+	Name string // Part name, unique within the session.
+	Blob Blob
+}
+
+// BulkImportSessionOptions stores the optional parameters of BulkImportSession.
+type BulkImportSessionOptions struct {
+	Concurrency     int             // (Optional) Number of parts uploaded in parallel. Defaults to 4.
+	MaxErrorRecords int             // (Optional) Number of error records tolerated. Negative value means no limit.
+	MaxErrorParts   int             // (Optional) Number of error parts tolerated. Negative value means no limit.
+	Polling         PollingStrategy // (Optional) Polling schedule for the perform job and the commit. DefaultPolling is used if nil.
+	KeepOnFailure   bool            // (Optional) Do not delete the session when the import fails.
+}
+
+// BulkImportSession drives a bulk import from the creation of the session to the commit.
+//
+// A session is resumable: running it again with the same name after a crash skips
+// the parts that have already been uploaded and continues from the current status
+// of the session.
+type BulkImportSession struct {
+	Name     string
+	Database string
+	Table    string
+	client   *TDClient
+	options  BulkImportSessionOptions
+}
+
+// BulkImportError is returned when the perform job has produced more error records or parts than tolerated.
+type BulkImportError struct {
+	Name         string
+	ErrorRecords int
+	ErrorParts   int
+	BulkImport   *BulkImportElement
+}
+
+func (e *BulkImportError) Error() string {
+	return fmt.Sprintf("bulk import %s has %d error records in %d error parts", e.Name, e.ErrorRecords, e.ErrorParts)
+}
+
+// NewBulkImportSession creates a BulkImportSession that imports into the table.  No API call is made until Run, Upload or Finish is called.
+func (client *TDClient) NewBulkImportSession(name string, db string, table string, options *BulkImportSessionOptions) *BulkImportSession {
+	session := &BulkImportSession{
+		Name:     name,
+		Database: db,
+		Table:    table,
+		client:   client,
+	}
+	if options != nil {
+		session.options = *options
+	}
+	if session.options.Concurrency <= 0 {
+		session.options.Concurrency = 4
+	}
+	if session.options.Polling == nil {
+		session.options.Polling = &DefaultPolling
+	}
+	return session
+}
+
+// Run uploads the parts, performs the import and commits it.
+// The session is deleted on failure unless KeepOnFailure is set or ctx has been canceled, in which case it is left for resumption.
+// It is never deleted once the commit may have been accepted, even if the commit request failed.
+func (s *BulkImportSession) Run(ctx context.Context, parts []BulkImportPart) (*BulkImportElement, error) {
+	committing := false
+	err := s.Upload(ctx, parts)
+	var bi *BulkImportElement
+	if err == nil {
+		bi, committing, err = s.finish(ctx)
+	}
+	if err != nil && !committing && !s.options.KeepOnFailure && ctx.Err() == nil {
+		s.client.DeleteBulkImportContext(ctx, s.Name, nil)
+	}
+	return bi, err
+}
+
+// Upload creates the session if it does not exist and uploads the parts that are not present yet.
+// Nothing is uploaded if the session is already frozen.
+func (s *BulkImportSession) Upload(ctx context.Context, parts []BulkImportPart) error {
+	bi, err := s.client.ShowBulkImportContext(ctx, s.Name)
+	if err != nil {
+		if apiErr, ok := err.(*APIError); !ok || apiErr.Type != NotFoundError {
+			return err
+		}
+		_, err = s.client.CreateBulkImportContext(ctx, s.Name, s.Database, s.Table, nil)
+		if err != nil {
+			return err
+		}
+		return s.uploadParts(ctx, parts)
+	}
+	if bi.Database != s.Database || bi.Table != s.Table {
+		return &APIError{
+			Type:    AlreadyExistsError,
+			Message: fmt.Sprintf("Bulk import %s exists for %s.%s", s.Name, bi.Database, bi.Table),
+		}
+	}
+	if bi.Status != "uploading" || bi.UploadFrozen {
+		return nil
+	}
+	uploaded, err := s.client.ListBulkImportPartsContext(ctx, s.Name, nil)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(uploaded.Parts))
+	for _, name := range uploaded.Parts {
+		present[name] = true
+	}
+	missing := make([]BulkImportPart, 0, len(parts))
+	for _, part := range parts {
+		if !present[part.Name] {
+			missing = append(missing, part)
+		}
+	}
+	return s.uploadParts(ctx, missing)
+}
+
+func (s *BulkImportSession) uploadParts(ctx context.Context, parts []BulkImportPart) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan BulkImportPart)
+	errs := make(chan error, s.options.Concurrency)
+	wg := sync.WaitGroup{}
+	for i := 0; i < s.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range ch {
+				_, err := s.client.UploadBulkImportPartContext(ctx, s.Name, part.Name, part.Blob)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for _, part := range parts {
+		select {
+		case ch <- part:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ch)
+	wg.Wait()
+	close(errs)
+	if err, ok := <-errs; ok {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Finish freezes the session, performs the import, waits for the perform job, checks the error counts and commits.
+// It picks up from the current status of the session, so it can be called again after an interruption.
+func (s *BulkImportSession) Finish(ctx context.Context) (*BulkImportElement, error) {
+	bi, _, err := s.finish(ctx)
+	return bi, err
+}
+
+// finish also tells whether the commit has been requested, after which the session must not be deleted.
+func (s *BulkImportSession) finish(ctx context.Context) (*BulkImportElement, bool, error) {
+	bi, err := s.client.ShowBulkImportContext(ctx, s.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	if bi.Status == "uploading" {
+		if !bi.UploadFrozen {
+			_, err = s.client.FreezeBulkImportContext(ctx, s.Name, nil)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		perform, err := s.client.PerformBulkImportContext(ctx, s.Name, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		bi.Status = "performing"
+		bi.JobID = perform.JobID
+	}
+	if bi.Status == "performing" {
+		_, err = s.client.WaitJobContext(ctx, bi.JobID, &WaitJobOptions{Polling: s.options.Polling})
+		if err != nil {
+			return nil, false, err
+		}
+		bi, err = s.waitWhile(ctx, "performing")
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if bi.Status == "ready" {
+		if (s.options.MaxErrorRecords >= 0 && bi.ErrorRecords > s.options.MaxErrorRecords) ||
+			(s.options.MaxErrorParts >= 0 && bi.ErrorParts > s.options.MaxErrorParts) {
+			return bi, false, &BulkImportError{
+				Name:         s.Name,
+				ErrorRecords: bi.ErrorRecords,
+				ErrorParts:   bi.ErrorParts,
+				BulkImport:   bi,
+			}
+		}
+		_, err = s.client.CommitBulkImportContext(ctx, s.Name, nil)
+		if err != nil {
+			// the server may have accepted the commit unless it rejected the request.
+			var apiErr *APIError
+			rejected := errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+			return nil, !rejected, err
+		}
+		bi.Status = "committing"
+	}
+	if bi.Status == "committing" {
+		bi, err = s.waitWhile(ctx, "committing")
+		if err != nil {
+			return nil, true, err
+		}
+	}
+	if bi.Status != "committed" {
+		return bi, true, &APIError{
+			Type:    GenericError,
+			Message: fmt.Sprintf("Bulk import %s ended up with unexpected status %s", s.Name, bi.Status),
+		}
+	}
+	return bi, true, nil
+}
+
+// waitWhile polls the session until its status changes from the given one.
+func (s *BulkImportSession) waitWhile(ctx context.Context, status string) (*BulkImportElement, error) {
+	for n := 1; ; n++ {
+		bi, err := s.client.ShowBulkImportContext(ctx, s.Name)
+		if err != nil {
+			return nil, err
+		}
+		if bi.Status != status {
+			return bi, nil
+		}
+		err = sleepContext(ctx, s.options.Polling.Next(n))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
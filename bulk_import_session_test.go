@@ -0,0 +1,221 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BulkImportTransport emulates the bulk import API for a single session.
+type BulkImportTransport struct {
+	mu           sync.Mutex
+	Exists       bool
+	Status       string
+	Frozen       bool
+	Parts        []string
+	ErrorRecords int
+	FailPart     string
+	FailCommit   int // status code of the commit failing after it is accepted, if any
+	Paths        []string
+}
+
+func (t *BulkImportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	path := req.URL.Path
+	t.Paths = append(t.Paths, path)
+	statusCode, body := 200, `{"name":"session","bulk_import":"session"}`
+	switch {
+	case path == "/v3/bulk_import/show/session":
+		if !t.Exists {
+			statusCode, body = 404, `{"error":"Bulk import session not found"}`
+			break
+		}
+		body = fmt.Sprintf(`{"name":"session","status":"%s","job_id":"12345","valid_records":10,"error_records":%d,"valid_parts":%d,"error_parts":0,"upload_frozen":%t,"database":"db","table":"tbl"}`, t.Status, t.ErrorRecords, len(t.Parts), t.Frozen)
+		if t.Status == "committing" {
+			t.Status = "committed"
+		}
+	case path == "/v3/bulk_import/create/session/db/tbl":
+		t.Exists = true
+		t.Status = "uploading"
+	case path == "/v3/bulk_import/list_parts/session":
+		js, _ := json.Marshal(t.Parts)
+		body = `{"name":"session","bulk_import":"session","parts":` + string(js) + `}`
+	case strings.HasPrefix(path, "/v3/bulk_import/upload_part/session/"):
+		part := strings.TrimPrefix(path, "/v3/bulk_import/upload_part/session/")
+		if part == t.FailPart {
+			statusCode, body = 400, `{"error":"Invalid part"}`
+			break
+		}
+		t.Parts = append(t.Parts, part)
+	case path == "/v3/bulk_import/freeze/session":
+		t.Frozen = true
+	case path == "/v3/bulk_import/perform/session":
+		t.Status = "performing"
+		body = `{"name":"session","bulk_import":"session","job_id":12345}`
+	case path == "/v3/job/status/12345":
+		t.Status = "ready"
+		body = string(jobStatusResponse("success"))
+	case path == "/v3/job/show/12345":
+		body = string(showJobResponse("success", ""))
+	case path == "/v3/bulk_import/commit/session":
+		t.Status = "committing"
+		if t.FailCommit != 0 {
+			statusCode, body = t.FailCommit, `{"error":"Commit failed"}`
+		}
+	case path == "/v3/bulk_import/delete/session":
+		t.Exists = false
+	default:
+		statusCode, body = 404, `{"error":"Unexpected request"}`
+	}
+	return &http.Response{
+		Status: fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)), StatusCode: statusCode,
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func (t *BulkImportTransport) count(prefix string) int {
+	n := 0
+	for _, path := range t.Paths {
+		if strings.HasPrefix(path, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func testBulkImportParts(names ...string) []BulkImportPart {
+	parts := make([]BulkImportPart, len(names))
+	for i, name := range names {
+		parts[i] = BulkImportPart{Name: name, Blob: InMemoryBlob(bytes.Repeat([]byte{byte(i)}, 16))}
+	}
+	return parts
+}
+
+func TestBulkImportSession(t *testing.T) {
+	transport := &BulkImportTransport{}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	session := client.NewBulkImportSession("session", "db", "tbl", &BulkImportSessionOptions{Concurrency: 2, Polling: testPolling})
+	bi, err := session.Run(context.Background(), testBulkImportParts("p1", "p2", "p3", "p4", "p5"))
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if bi.Status != "committed" {
+		t.Fatalf("unexpected status: %s", bi.Status)
+	}
+	sort.Strings(transport.Parts)
+	if strings.Join(transport.Parts, ",") != "p1,p2,p3,p4,p5" {
+		t.Fatalf("unexpected parts: %v", transport.Parts)
+	}
+	if transport.count("/v3/bulk_import/list_parts/") != 0 || transport.count("/v3/bulk_import/freeze/") != 1 || transport.count("/v3/bulk_import/commit/") != 1 {
+		t.Fatalf("unexpected requests: %v", transport.Paths)
+	}
+}
+
+func TestBulkImportSessionResume(t *testing.T) {
+	transport := &BulkImportTransport{Exists: true, Status: "uploading", Parts: []string{"p1", "p3"}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	session := client.NewBulkImportSession("session", "db", "tbl", &BulkImportSessionOptions{Polling: testPolling})
+	_, err = session.Run(context.Background(), testBulkImportParts("p1", "p2", "p3"))
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if transport.count("/v3/bulk_import/upload_part/") != 1 || transport.count("/v3/bulk_import/upload_part/session/p2") != 1 {
+		t.Fatalf("unexpected requests: %v", transport.Paths)
+	}
+	if transport.count("/v3/bulk_import/create/") != 0 {
+		t.Fatalf("session must not be recreated: %v", transport.Paths)
+	}
+}
+
+func TestBulkImportSessionErrorRecords(t *testing.T) {
+	transport := &BulkImportTransport{ErrorRecords: 3}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	session := client.NewBulkImportSession("session", "db", "tbl", &BulkImportSessionOptions{MaxErrorRecords: 2, Polling: testPolling})
+	_, err = session.Run(context.Background(), testBulkImportParts("p1"))
+	bulkImportErr, ok := err.(*BulkImportError)
+	if !ok {
+		t.Fatalf("expected *BulkImportError, got %v", err)
+	}
+	if bulkImportErr.ErrorRecords != 3 {
+		t.Fatalf("unexpected error: %s", bulkImportErr.Error())
+	}
+	if transport.count("/v3/bulk_import/commit/") != 0 || transport.Exists {
+		t.Fatalf("session must be deleted without commit: %v", transport.Paths)
+	}
+}
+
+func TestBulkImportSessionUploadFailure(t *testing.T) {
+	transport := &BulkImportTransport{FailPart: "p2"}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	session := client.NewBulkImportSession("session", "db", "tbl", &BulkImportSessionOptions{Concurrency: 1, KeepOnFailure: true, Polling: testPolling})
+	_, err = session.Run(context.Background(), testBulkImportParts("p1", "p2", "p3"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if transport.count("/v3/bulk_import/upload_part/session/p3") != 0 || transport.count("/v3/bulk_import/freeze/") != 0 {
+		t.Fatalf("unexpected requests: %v", transport.Paths)
+	}
+	if !transport.Exists {
+		t.Fatalf("session must be kept")
+	}
+}
+
+func TestBulkImportSessionCommitFailure(t *testing.T) {
+	for _, statusCode := range []int{500, 400} {
+		transport := &BulkImportTransport{FailCommit: statusCode}
+		client, err := NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+		if err != nil {
+			t.Fatalf("failed create client: %s", err.Error())
+		}
+		session := client.NewBulkImportSession("session", "db", "tbl", &BulkImportSessionOptions{Polling: testPolling})
+		_, err = session.Run(context.Background(), testBulkImportParts("p1"))
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+		// a 5xx commit may have been accepted, so the session must be kept, while a 4xx one has surely been rejected.
+		if transport.Exists != (statusCode == 500) {
+			t.Fatalf("%d: unexpected requests: %v", statusCode, transport.Paths)
+		}
+	}
+}
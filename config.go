@@ -0,0 +1,249 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Routers of the Treasure Data regions.
+var (
+	USRouter = V3EndpointRouter{
+		DefaultEndpoint: "api.treasuredata.com",
+		ImportEndpoint:  "api-import.treasuredata.com",
+	}
+	EU01Router = V3EndpointRouter{
+		DefaultEndpoint: "api.eu01.treasuredata.com",
+		ImportEndpoint:  "api-import.eu01.treasuredata.com",
+	}
+	AP01Router = V3EndpointRouter{ // Tokyo
+		DefaultEndpoint: "api.treasuredata.co.jp",
+		ImportEndpoint:  "api-import.treasuredata.co.jp",
+	}
+	AP02Router = V3EndpointRouter{ // Korea
+		DefaultEndpoint: "api.ap02.treasuredata.com",
+		ImportEndpoint:  "api-import.ap02.treasuredata.com",
+	}
+	AP03Router = V3EndpointRouter{
+		DefaultEndpoint: "api.ap03.treasuredata.com",
+		ImportEndpoint:  "api-import.ap03.treasuredata.com",
+	}
+)
+
+// RegionRouter returns the router of the region named case-insensitively as "us", "eu01", "ap01" (or "tokyo"), "ap02" (or "korea") or "ap03".
+func RegionRouter(region string) (*V3EndpointRouter, error) {
+	var router V3EndpointRouter
+	switch strings.ToLower(region) {
+	case "us":
+		router = USRouter
+	case "eu01":
+		router = EU01Router
+	case "ap01", "tokyo":
+		router = AP01Router
+	case "ap02", "korea":
+		router = AP02Router
+	case "ap03":
+		router = AP03Router
+	default:
+		return nil, fmt.Errorf("unknown region: %s", region)
+	}
+	return &router, nil
+}
+
+// parseEndpoint accepts the endpoint either as a host name, host:port or a URL such as https://api.treasuredata.com.
+func parseEndpoint(endpoint string) (host string, port int, err error) {
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", 0, err
+		}
+		if u.Scheme != "https" {
+			return "", 0, fmt.Errorf("unsupported scheme in endpoint %s; only https is permitted", endpoint)
+		}
+		endpoint = u.Host
+	}
+	host = endpoint
+	if h, p, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port in endpoint %s", endpoint)
+		}
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid endpoint %s", endpoint)
+	}
+	return host, port, nil
+}
+
+// endpointSettings sets the router and the port for the API endpoint and the import endpoint.
+// The import endpoint defaults to the API endpoint with "api." replaced by "api-import.", or to the API endpoint itself.
+func endpointSettings(settings *Settings, endpoint string, importEndpoint string) error {
+	if endpoint == "" && importEndpoint == "" {
+		return nil
+	}
+	router := DefaultRouter
+	if endpoint != "" {
+		host, port, err := parseEndpoint(endpoint)
+		if err != nil {
+			return err
+		}
+		router.DefaultEndpoint = host
+		router.ImportEndpoint = host
+		if strings.HasPrefix(host, "api.") {
+			router.ImportEndpoint = "api-import." + strings.TrimPrefix(host, "api.")
+		}
+		settings.Port = port
+	}
+	if importEndpoint != "" {
+		host, port, err := parseEndpoint(importEndpoint)
+		if err != nil {
+			return err
+		}
+		if port != 0 {
+			if settings.Port != 0 && settings.Port != port {
+				return errors.New("the API endpoint and the import endpoint must share the port")
+			}
+			settings.Port = port
+		}
+		router.ImportEndpoint = host
+	}
+	settings.Router = &router
+	return nil
+}
+
+// SettingsFromEnv builds Settings from the environment variables:
+//
+//	TD_API_KEY            API key
+//	TD_API_SERVER         (Optional) API endpoint, e.g. api.treasuredata.co.jp or https://api.treasuredata.co.jp
+//	TD_API_IMPORT_SERVER  (Optional) Import endpoint, derived from TD_API_SERVER if absent
+//
+// The proxy is taken from HTTPS_PROXY, HTTP_PROXY and NO_PROXY as described in http.ProxyFromEnvironment.
+func SettingsFromEnv() (Settings, error) {
+	settings := Settings{
+		ApiKey: os.Getenv("TD_API_KEY"),
+		Proxy:  http.ProxyFromEnvironment,
+	}
+	if settings.ApiKey == "" {
+		return settings, errors.New("TD_API_KEY is not set")
+	}
+	err := endpointSettings(&settings, os.Getenv("TD_API_SERVER"), os.Getenv("TD_API_IMPORT_SERVER"))
+	if err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// NewTDClientFromEnv creates a new TDClient instance according to the environment variables described in SettingsFromEnv.
+func NewTDClientFromEnv() (*TDClient, error) {
+	settings, err := SettingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewTDClient(settings)
+}
+
+// DefaultTDConfPath returns the path of the configuration file of the td toolbelt,
+// which is TD_CONFIG_PATH if set, or ~/.td/td.conf.
+func DefaultTDConfPath() (string, error) {
+	if path := os.Getenv("TD_CONFIG_PATH"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".td", "td.conf"), nil
+}
+
+// ParseTDConf parses the configuration file of the td toolbelt into the map from "section.key" to the value, e.g. "account.apikey".
+//
+// The file consists of [section] headers and `key = value` lines.  Blank lines and those starting with # or ; are ignored.
+func ParseTDConf(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	retval := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("%s:%d: malformed section header", path, n)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if section != "" {
+			key = section + "." + key
+		}
+		retval[key] = strings.TrimSpace(line[i+1:])
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
+
+// LoadTDConf builds Settings from the configuration file of the td toolbelt, using DefaultTDConfPath if path is empty.
+// account.apikey gives the API key, and account.endpoint and account.import_endpoint give the endpoints as with TD_API_SERVER and TD_API_IMPORT_SERVER.
+func LoadTDConf(path string) (Settings, error) {
+	settings := Settings{}
+	if path == "" {
+		var err error
+		path, err = DefaultTDConfPath()
+		if err != nil {
+			return settings, err
+		}
+	}
+	conf, err := ParseTDConf(path)
+	if err != nil {
+		return settings, err
+	}
+	settings.ApiKey = conf["account.apikey"]
+	if settings.ApiKey == "" {
+		return settings, fmt.Errorf("%s: account.apikey is not set", path)
+	}
+	err = endpointSettings(&settings, conf["account.endpoint"], conf["account.import_endpoint"])
+	if err != nil {
+		return settings, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return settings, nil
+}
@@ -0,0 +1,163 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setenv sets the environment variables for the duration of the test.
+func setenv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		prev, ok := os.LookupEnv(k)
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestRegionRouter(t *testing.T) {
+	router, err := RegionRouter("Tokyo")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if router.Route("/v3/job/list") != "api.treasuredata.co.jp" || router.Route("/v3/table/import/db/t/msgpack.gz") != "api-import.treasuredata.co.jp" {
+		t.Fatalf("unexpected router: %+v", router)
+	}
+	router.DefaultEndpoint = "modified"
+	if AP01Router.DefaultEndpoint != "api.treasuredata.co.jp" {
+		t.Fatal("the returned router aliases the shared one")
+	}
+	for region, endpoint := range map[string]string{"us": "api.treasuredata.com", "eu01": "api.eu01.treasuredata.com", "AP02": "api.ap02.treasuredata.com", "ap03": "api.ap03.treasuredata.com"} {
+		router, err := RegionRouter(region)
+		if err != nil || router.DefaultEndpoint != endpoint {
+			t.Errorf("%s: unexpected router %+v (%v)", region, router, err)
+		}
+	}
+	if _, err := RegionRouter("mars"); err == nil {
+		t.Fatal("expected error for an unknown region")
+	}
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	setenv(t, map[string]string{
+		"TD_API_KEY":           "1/abcdef",
+		"TD_API_SERVER":        "https://api.eu01.treasuredata.com",
+		"TD_API_IMPORT_SERVER": "",
+	})
+	settings, err := SettingsFromEnv()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if settings.ApiKey != "1/abcdef" || settings.Proxy == nil || settings.Port != 0 {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+	if *settings.Router.(*V3EndpointRouter) != EU01Router {
+		t.Fatalf("unexpected router: %+v", settings.Router)
+	}
+
+	setenv(t, map[string]string{
+		"TD_API_SERVER":        "td.example.com:8443",
+		"TD_API_IMPORT_SERVER": "import.example.com",
+	})
+	settings, err = SettingsFromEnv()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if settings.Port != 8443 || *settings.Router.(*V3EndpointRouter) != (V3EndpointRouter{DefaultEndpoint: "td.example.com", ImportEndpoint: "import.example.com"}) {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+	client, err := NewTDClientFromEnv()
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	if apiKey, _ := client.credentials.APIKey(context.Background()); apiKey != "1/abcdef" {
+		t.Fatalf("unexpected API key: %s", apiKey)
+	}
+
+	setenv(t, map[string]string{"TD_API_SERVER": "http://api.treasuredata.com"})
+	if _, err := SettingsFromEnv(); err == nil {
+		t.Fatal("expected error for http endpoint")
+	}
+	setenv(t, map[string]string{"TD_API_KEY": ""})
+	if _, err := SettingsFromEnv(); err == nil {
+		t.Fatal("expected error for the missing API key")
+	}
+}
+
+func TestLoadTDConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "td.conf")
+	err := ioutil.WriteFile(path, []byte(`# written by td account
+[account]
+  user = alice@example.com
+  apikey = 1/abcdef
+  endpoint = https://api.treasuredata.co.jp
+
+; other sections are ignored
+[server]
+  port = 1
+`), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	conf, err := ParseTDConf(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if conf["account.user"] != "alice@example.com" || conf["server.port"] != "1" {
+		t.Fatalf("unexpected conf: %v", conf)
+	}
+	setenv(t, map[string]string{"TD_CONFIG_PATH": path})
+	settings, err := LoadTDConf("")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if settings.ApiKey != "1/abcdef" || *settings.Router.(*V3EndpointRouter) != AP01Router {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+
+	err = ioutil.WriteFile(path, []byte("[account]\nuser = alice@example.com\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := LoadTDConf(path); err == nil {
+		t.Fatal("expected error for the missing API key")
+	}
+	err = ioutil.WriteFile(path, []byte("[account\napikey = x\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := ParseTDConf(path); err == nil {
+		t.Fatal("expected error for the malformed file")
+	}
+}
@@ -0,0 +1,183 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialProvider supplies the API key, consulted on every request so that the key can be rotated
+// without recreating the TDClient.
+type CredentialProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// CredentialRefresher is implemented by the CredentialProviders that cache the API key.
+// Refresh is called to re-fetch the key once the API has rejected the cached one.
+type CredentialRefresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// ErrNoCredentials is returned by the CredentialProviders having no API key to offer.
+var ErrNoCredentials = errors.New("no credentials available")
+
+// StaticCredentials is a CredentialProvider always returning the same API key.
+type StaticCredentials string
+
+func (c StaticCredentials) APIKey(_ context.Context) (string, error) {
+	return string(c), nil
+}
+
+// EnvCredentials is a CredentialProvider reading the API key from the environment variable Name,
+// TD_API_KEY if empty.  The variable is read on every request.
+type EnvCredentials struct {
+	Name string
+}
+
+func (c *EnvCredentials) APIKey(_ context.Context) (string, error) {
+	name := c.Name
+	if name == "" {
+		name = "TD_API_KEY"
+	}
+	apiKey := os.Getenv(name)
+	if apiKey == "" {
+		return "", fmt.Errorf("%w: %s is not set", ErrNoCredentials, name)
+	}
+	return apiKey, nil
+}
+
+// DefaultCredentialsCheckInterval is how often FileCredentials checks the file for changes by default.
+var DefaultCredentialsCheckInterval = 10 * time.Second
+
+// FileCredentials is a CredentialProvider reading the API key from a file, such as a mounted Kubernetes secret.
+// The file is checked for changes at most once every CheckInterval, and re-read when its modification time or size
+// has changed.  The surrounding whitespace is trimmed off the key.
+type FileCredentials struct {
+	Path          string
+	CheckInterval time.Duration // Defaults to DefaultCredentialsCheckInterval.
+	mu            sync.Mutex
+	apiKey        string
+	modTime       time.Time
+	size          int64
+	checkedAt     time.Time
+}
+
+// NewFileCredentials creates a FileCredentials for the file at path.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{Path: path}
+}
+
+func (c *FileCredentials) APIKey(_ context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	interval := c.CheckInterval
+	if interval <= 0 {
+		interval = DefaultCredentialsCheckInterval
+	}
+	if c.apiKey != "" && time.Since(c.checkedAt) < interval {
+		return c.apiKey, nil
+	}
+	err := c.load(false)
+	if err != nil {
+		return "", err
+	}
+	return c.apiKey, nil
+}
+
+// Refresh re-reads the file regardless of CheckInterval.
+func (c *FileCredentials) Refresh(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load(true)
+}
+
+func (c *FileCredentials) load(force bool) error {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	c.checkedAt = time.Now()
+	if !force && c.apiKey != "" && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return nil
+	}
+	content, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+	apiKey := strings.TrimSpace(string(content))
+	if apiKey == "" {
+		return fmt.Errorf("%w: %s is empty", ErrNoCredentials, c.Path)
+	}
+	c.apiKey = apiKey
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return nil
+}
+
+// ChainCredentials is a CredentialProvider returning the API key of the first provider that has one.
+type ChainCredentials []CredentialProvider
+
+func (c ChainCredentials) APIKey(ctx context.Context) (string, error) {
+	messages := []string{}
+	for _, provider := range c {
+		apiKey, err := provider.APIKey(ctx)
+		if err != nil {
+			messages = append(messages, err.Error())
+			continue
+		}
+		if apiKey != "" {
+			return apiKey, nil
+		}
+	}
+	if len(messages) == 0 {
+		return "", ErrNoCredentials
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoCredentials, strings.Join(messages, "; "))
+}
+
+// Refresh refreshes every provider in the chain implementing CredentialRefresher, returning the first error.
+func (c ChainCredentials) Refresh(ctx context.Context) error {
+	retval := (error)(nil)
+	for _, provider := range c {
+		if refresher, ok := provider.(CredentialRefresher); ok {
+			err := refresher.Refresh(ctx)
+			if err != nil && retval == nil {
+				retval = err
+			}
+		}
+	}
+	return retval
+}
+
+// refreshCredentials re-fetches the API key after the API rejected the given one, and reports whether a different key is now available.
+func (client *TDClient) refreshCredentials(ctx context.Context, rejected string) bool {
+	if refresher, ok := client.credentials.(CredentialRefresher); ok {
+		// a failed refresh leaves the key as it was, which is detected below.
+		refresher.Refresh(ctx)
+	}
+	apiKey, err := client.credentials.APIKey(ctx)
+	return err == nil && apiKey != rejected
+}
@@ -0,0 +1,152 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// AuthTransport accepts only the requests authenticated with ApiKey, recording the keys presented.
+type AuthTransport struct {
+	ApiKey string
+	Keys   []string
+}
+
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiKey := req.Header.Get("Authorization")[len("TD1 "):]
+	t.Keys = append(t.Keys, apiKey)
+	statusCode := 200
+	body := []byte(`{"status":"ok"}`)
+	if apiKey != t.ApiKey {
+		statusCode = 401
+		body = []byte(`{"error":"authentication failed"}`)
+	}
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func TestFileCredentialsRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikey")
+	err := ioutil.WriteFile(path, []byte("1/old\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	credentials := NewFileCredentials(path)
+	credentials.CheckInterval = time.Hour
+	transport := &AuthTransport{ApiKey: "1/old"}
+	client, err := NewTDClient(Settings{Transport: transport, Credentials: credentials})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+
+	// the key is rotated, and the cached one is rejected before the interval elapses.
+	err = ioutil.WriteFile(path, []byte("1/new-key\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	transport.ApiKey = "1/new-key"
+	err = client.CreateDatabase("sample_db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if !reflect.DeepEqual(transport.Keys, []string{"1/old", "1/old", "1/new-key"}) {
+		t.Fatalf("unexpected keys: %v", transport.Keys)
+	}
+}
+
+func TestCredentialsRetryOnce(t *testing.T) {
+	transport := &AuthTransport{ApiKey: "1/valid"}
+	client, err := NewTDClient(Settings{Transport: transport, ApiKey: "1/invalid", Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	apiError := (*APIError)(nil)
+	if !errors.As(err, &apiError) || apiError.Type != AuthError {
+		t.Fatalf("expected AuthError, got %v", err)
+	}
+	// the key has not changed, so the request is not sent again.
+	if len(transport.Keys) != 1 {
+		t.Fatalf("unexpected requests: %v", transport.Keys)
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	setenv(t, map[string]string{"TD_API_KEY": "1/env", "MY_TD_API_KEY": ""})
+	apiKey, err := (&EnvCredentials{}).APIKey(context.Background())
+	if err != nil || apiKey != "1/env" {
+		t.Fatalf("unexpected key: %s (%v)", apiKey, err)
+	}
+	_, err = (&EnvCredentials{Name: "MY_TD_API_KEY"}).APIKey(context.Background())
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+func TestChainCredentials(t *testing.T) {
+	setenv(t, map[string]string{"MY_TD_API_KEY": ""})
+	chain := ChainCredentials{
+		&EnvCredentials{Name: "MY_TD_API_KEY"},
+		NewFileCredentials(filepath.Join(t.TempDir(), "missing")),
+		StaticCredentials("1/static"),
+	}
+	apiKey, err := chain.APIKey(context.Background())
+	if err != nil || apiKey != "1/static" {
+		t.Fatalf("unexpected key: %s (%v)", apiKey, err)
+	}
+	setenv(t, map[string]string{"MY_TD_API_KEY": "1/env"})
+	apiKey, err = chain.APIKey(context.Background())
+	if err != nil || apiKey != "1/env" {
+		t.Fatalf("unexpected key: %s (%v)", apiKey, err)
+	}
+	_, err = chain[1:2].APIKey(context.Background())
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+	if err := chain[1:].Refresh(context.Background()); err == nil {
+		t.Fatal("expected error refreshing the missing file")
+	}
+
+	client, err := NewTDClient(Settings{Transport: &AuthTransport{}, Credentials: ChainCredentials{}})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	if err != ErrNoCredentials {
+		t.Fatalf("expected ErrNoCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugLogger receives a record for every request sent by TDClient.  *slog.Logger satisfies it.
+//
+// The arguments are alternating keys and values as with slog:
+//
+//	operation      name of the API call, e.g. "SubmitQuery"
+//	attempt        number of the attempt under the retry policy, 1 for the first
+//	method         HTTP method
+//	endpoint       host chosen by the EndpointRouter
+//	path           request path
+//	status         HTTP status code, absent if the request failed without a response
+//	latency        time.Duration until the response body was closed
+//	response_size  bytes read from the response body
+//	error          error returned by the transport, if any
+//	request_body   redacted request body, if Settings.DebugLogBodies is set
+//	response_body  redacted response body, if Settings.DebugLogBodies is set
+type DebugLogger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// maxDebugLogBody is the number of bytes of a body dumped to the DebugLogger.
+const maxDebugLogBody = 64 * 1024
+
+const redacted = "[REDACTED]"
+
+// secretFormFields are the form fields redacted from the request bodies, such as the password of Authenticate and AddUser.
+var secretFormFields = []string{"password", "apikey"}
+
+// secretJSONFields matches the values of the keys holding credentials in the response bodies, such as the apikey returned by Authenticate and AddAPIKey.
+var secretJSONFields = regexp.MustCompile(`("(?:apikey|apikeys|password)"\s*:\s*)("(?:[^"\\]|\\.)*"|\[[^\]]*\]?)`)
+
+// debugLogInterceptor makes the Interceptor that records the requests to the logger.
+// It is placed innermost so that the request is logged as it is sent, one record per attempt.
+func debugLogInterceptor(logger DebugLogger, dumpBodies bool) Interceptor {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(operation string, req *http.Request) (*http.Response, error) {
+			// the API key may be rotated by the CredentialProvider, so the one the request carries is redacted.
+			apiKey := strings.TrimPrefix(req.Header.Get("Authorization"), "TD1 ")
+			redact := func(s string) string {
+				if apiKey != "" {
+					s = strings.Replace(s, apiKey, redacted, -1)
+				}
+				return s
+			}
+			ctx := req.Context()
+			args := []interface{}{
+				"operation", operation,
+				"attempt", RequestAttempt(ctx),
+				"method", req.Method,
+				"endpoint", req.URL.Host,
+				"path", req.URL.Path,
+			}
+			requestBody := ""
+			if dumpBodies {
+				requestBody = dumpRequestBody(req, redact)
+			}
+			startedAt := time.Now()
+			resp, err := next(operation, req)
+			if err != nil {
+				args = append(args, "latency", time.Since(startedAt), "error", redact(err.Error()))
+				if dumpBodies {
+					args = append(args, "request_body", requestBody)
+				}
+				logger.DebugContext(ctx, "td api request", args...)
+				return nil, err
+			}
+			args = append(args, "status", resp.StatusCode)
+			responseBody := ""
+			if dumpBodies {
+				responseBody = dumpResponseBody(resp, redact)
+			}
+			body := &countingBody{ReadCloser: resp.Body}
+			body.onClose = func() {
+				args = append(args, "latency", time.Since(startedAt), "response_size", body.n)
+				if dumpBodies {
+					args = append(args, "request_body", requestBody, "response_body", responseBody)
+				}
+				logger.DebugContext(ctx, "td api request", args...)
+			}
+			resp.Body = body
+			return resp, nil
+		}
+	}
+}
+
+// dumpRequestBody renders the form of a POST request with the secrets redacted, or the size of an upload.
+func dumpRequestBody(req *http.Request, redact func(string) string) string {
+	if req.Body == nil {
+		return ""
+	}
+	if req.Method != "POST" {
+		return "(" + formatSize(req.ContentLength) + ")"
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return "(unreadable: " + err.Error() + ")"
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return redact(string(b))
+	}
+	for _, k := range secretFormFields {
+		if _, ok := form[k]; ok {
+			form.Set(k, redacted)
+		}
+	}
+	return redact(form.Encode())
+}
+
+// dumpResponseBody peeks the beginning of a JSON response, leaving the body intact for the caller.
+func dumpResponseBody(resp *http.Response, redact func(string) string) string {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return "(" + formatSize(resp.ContentLength) + " of " + resp.Header.Get("Content-Type") + ")"
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDebugLogBody+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+	if err != nil {
+		return "(unreadable: " + err.Error() + ")"
+	}
+	s := ""
+	if len(b) > maxDebugLogBody {
+		s = string(b[:maxDebugLogBody]) + "...(truncated)"
+	} else {
+		s = string(b)
+	}
+	return redact(secretJSONFields.ReplaceAllString(s, `${1}"`+redacted+`"`))
+}
+
+func formatSize(n int64) string {
+	if n < 0 {
+		return "unknown size"
+	}
+	return strconv.FormatInt(n, 10) + " bytes"
+}
+
+// countingBody counts the bytes read from the response body and calls onClose once it is closed.
+type countingBody struct {
+	io.ReadCloser
+	n       int64
+	once    sync.Once
+	onClose func()
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
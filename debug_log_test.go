@@ -0,0 +1,120 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// RecordingDebugLogger stores the records as maps from the keys to the values.
+type RecordingDebugLogger struct {
+	Records []map[string]interface{}
+}
+
+func (l *RecordingDebugLogger) DebugContext(_ context.Context, msg string, args ...interface{}) {
+	record := map[string]interface{}{"msg": msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		record[args[i].(string)] = args[i+1]
+	}
+	l.Records = append(l.Records, record)
+}
+
+func TestDebugLog(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		[]byte(`{"name":"alice","apikey":"1/0123456789abcdef"}`),
+		[]byte(`{"apikeys":["1/aaaa","1/bbbb"]}`),
+	}}
+	logger := &RecordingDebugLogger{}
+	client, err := NewTDClient(Settings{
+		ApiKey:         "1/secretkey",
+		Transport:      transport,
+		Router:         &FixedEndpointRouter{Endpoint: "api.example.com"},
+		DebugLog:       logger,
+		DebugLogBodies: true,
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	result, err := client.Authenticate("alice@example.com", "p@ssw0rd")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if result.APIKey != "1/0123456789abcdef" {
+		t.Fatalf("response body was not preserved: %+v", result)
+	}
+	_, err = client.ListAPIKeys("alice@example.com")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(logger.Records) != 2 {
+		t.Fatalf("unexpected records: %v", logger.Records)
+	}
+	record := logger.Records[0]
+	for k, v := range map[string]interface{}{
+		"operation":     "Authenticate",
+		"attempt":       1,
+		"method":        "POST",
+		"endpoint":      "api.example.com",
+		"path":          "/v3/user/authenticate",
+		"status":        200,
+		"response_size": int64(46),
+		"request_body":  "password=%5BREDACTED%5D&user=alice%40example.com",
+		"response_body": `{"name":"alice","apikey":"[REDACTED]"}`,
+	} {
+		if record[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, record[k])
+		}
+	}
+	if record := logger.Records[1]; record["response_body"] != `{"apikeys":"[REDACTED]"}` {
+		t.Errorf("unexpected response body: %v", record["response_body"])
+	}
+	for _, record := range logger.Records {
+		for k, v := range record {
+			s := fmt.Sprint(v)
+			if strings.Contains(s, "secretkey") || strings.Contains(s, "p@ssw0rd") || strings.Contains(s, "0123456789abcdef") || strings.Contains(s, "aaaa") {
+				t.Errorf("%s is not redacted: %s", k, s)
+			}
+		}
+	}
+}
+
+func TestDebugLogTransportError(t *testing.T) {
+	logger := &RecordingDebugLogger{}
+	client, err := NewTDClient(Settings{
+		ApiKey:    "1/secretkey",
+		Transport: &FlakyTransport{Failures: []int{0}},
+		DebugLog:  logger,
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(logger.Records) != 1 || logger.Records[0]["error"] != "connection reset by peer" || logger.Records[0]["status"] != nil {
+		t.Fatalf("unexpected records: %v", logger.Records)
+	}
+	if _, ok := logger.Records[0]["request_body"]; ok {
+		t.Fatalf("bodies are dumped without DebugLogBodies: %v", logger.Records)
+	}
+}
@@ -0,0 +1,348 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The API responses are decoded into structs annotated with `td` tags of the following form:
+//
+//	Field T `td:"key[,optional][,json][,default=value]"`
+//
+// - optional: the key may be missing or null, in which case the field is set to the default.
+// - json: the value is a string containing embedded JSON, which is parsed before being stored.  An empty string
+//   is taken as null for an optional field, as the API returns for a missing value.
+// - default=value: the value used instead of the zero value for an optional field.
+//
+// Anonymous struct fields are flattened.  Keys that have no corresponding field are ignored
+// unless the decoding is strict.  Tagged blank (_) fields declare the keys that are known
+// but not used, so that strict decoding accepts them.
+
+type fieldSpec struct {
+	key          string
+	index        []int
+	optional     bool
+	embeddedJSON bool
+	defaultValue string
+	hasDefault   bool
+}
+
+func parseFieldSpec(tag string) fieldSpec {
+	parts := strings.Split(tag, ",")
+	spec := fieldSpec{key: parts[0]}
+	for _, p := range parts[1:] {
+		switch {
+		case p == "optional":
+			spec.optional = true
+		case p == "json":
+			spec.embeddedJSON = true
+		case strings.HasPrefix(p, "default="):
+			spec.defaultValue = p[len("default="):]
+			spec.hasDefault = true
+		}
+	}
+	return spec
+}
+
+// structFields lists the tagged fields of the struct type, including the ones of the anonymous struct fields.
+func structFields(type_ reflect.Type, index []int, fields []fieldSpec) []fieldSpec {
+	for i := 0; i < type_.NumField(); i++ {
+		f := type_.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		tag, ok := f.Tag.Lookup("td")
+		if !ok {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				fields = structFields(f.Type, fieldIndex, fields)
+			}
+			continue
+		}
+		spec := parseFieldSpec(tag)
+		if f.Name == "_" {
+			spec.index = nil
+		} else {
+			spec.index = fieldIndex
+		}
+		fields = append(fields, spec)
+	}
+	return fields
+}
+
+func stringizeJSONType(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "[]"
+	case map[string]interface{}:
+		return "{}"
+	default:
+		return fmt.Sprintf("(unsupported type %T)", v)
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "/" {
+		return path + key
+	}
+	return path + "/" + key
+}
+
+// plainJSON converts the numbers into float64 so that the value looks as if it were parsed by json.Unmarshal.
+func plainJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = plainJSON(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = plainJSON(e)
+		}
+	}
+	return v
+}
+
+func parseAPITime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse(TDAPIDateTime, s)
+		if err != nil {
+			t, err = time.Parse(TDAPIDateTimeNumericZone, s)
+			if err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+	return t.UTC(), nil
+}
+
+func setDefault(path string, spec fieldSpec, dest reflect.Value) error {
+	dest.Set(reflect.Zero(dest.Type()))
+	if !spec.hasDefault {
+		return nil
+	}
+	switch dest.Kind() {
+	case reflect.String:
+		dest.SetString(spec.defaultValue)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(spec.defaultValue, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid default %s for %s", spec.defaultValue, path)
+		}
+		dest.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(spec.defaultValue, 64)
+		if err != nil {
+			return fmt.Errorf("invalid default %s for %s", spec.defaultValue, path)
+		}
+		dest.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(spec.defaultValue)
+		if err != nil {
+			return fmt.Errorf("invalid default %s for %s", spec.defaultValue, path)
+		}
+		dest.SetBool(b)
+	default:
+		return fmt.Errorf("default is not supported for %s", path)
+	}
+	return nil
+}
+
+// decodeJSONValue stores the parsed JSON value v into dest.
+func decodeJSONValue(path string, v interface{}, dest reflect.Value, strict bool) error {
+	switch dest.Kind() {
+	case reflect.Interface:
+		if v != nil {
+			dest.Set(reflect.ValueOf(plainJSON(v)))
+		}
+		return nil
+	case reflect.Struct:
+		if dest.Type() == timeType {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("type mismatch (%s != string) for %s", stringizeJSONType(v), path)
+			}
+			t, err := parseAPITime(s)
+			if err != nil {
+				return fmt.Errorf("invalid time string %s for %s", s, path)
+			}
+			dest.Set(reflect.ValueOf(t))
+			return nil
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("type mismatch (%s != {}) for %s", stringizeJSONType(v), path)
+		}
+		return decodeJSONObject(path, obj, dest, strict)
+	case reflect.String:
+		switch v := v.(type) {
+		case string:
+			dest.SetString(v)
+			return nil
+		case json.Number:
+			dest.SetString(v.String())
+			return nil
+		case map[string]interface{}:
+			b, err := json.Marshal(plainJSON(v))
+			if err != nil {
+				return fmt.Errorf("%s is failed parse map to string %s", path, err.Error())
+			}
+			dest.SetString(string(b))
+			return nil
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			if err != nil {
+				f, err := n.Float64()
+				if err != nil {
+					return fmt.Errorf("invalid number %s for %s", n.String(), path)
+				}
+				i = int64(f)
+			}
+			dest.SetInt(i)
+			return nil
+		}
+	case reflect.Float64:
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			if err != nil {
+				return fmt.Errorf("invalid number %s for %s", n.String(), path)
+			}
+			dest.SetFloat(f)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			dest.SetBool(b)
+			return nil
+		}
+	case reflect.Slice:
+		if a, ok := v.([]interface{}); ok {
+			rv := reflect.MakeSlice(dest.Type(), len(a), len(a))
+			for i, e := range a {
+				if e == nil && rv.Index(i).Kind() != reflect.Interface {
+					return fmt.Errorf("%s[%d] may not be null", path, i)
+				}
+				err := decodeJSONValue(fmt.Sprintf("%s[%d]", path, i), e, rv.Index(i), strict)
+				if err != nil {
+					return err
+				}
+			}
+			dest.Set(rv)
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported type %s in the schema for %s", dest.Type().String(), path)
+	}
+	return fmt.Errorf("type mismatch (%s != %s) for %s", stringizeJSONType(v), stringizeType(dest.Type()), path)
+}
+
+func decodeJSONObject(path string, obj map[string]interface{}, dest reflect.Value, strict bool) error {
+	fields := structFields(dest.Type(), nil, nil)
+	if strict {
+		known := make(map[string]bool, len(fields))
+		for _, spec := range fields {
+			known[spec.key] = true
+		}
+		for k := range obj {
+			if !known[k] {
+				return fmt.Errorf("unknown key %s under %s", k, path)
+			}
+		}
+	}
+	for _, spec := range fields {
+		fieldPath := joinPath(path, spec.key)
+		v, ok := obj[spec.key]
+		if !ok && !spec.optional {
+			return fmt.Errorf("missing key %s under %s", spec.key, path)
+		}
+		if spec.index == nil {
+			continue
+		}
+		field := dest.FieldByIndex(spec.index)
+		if v == nil || (spec.optional && v == "" && (field.Type() == timeType || spec.embeddedJSON)) {
+			if !spec.optional {
+				return fmt.Errorf("%s may not be null", fieldPath)
+			}
+			err := setDefault(fieldPath, spec, field)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if spec.embeddedJSON {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("type mismatch (%s != string) for %s", stringizeJSONType(v), fieldPath)
+			}
+			var err error
+			v, err = parseJSON([]byte(s))
+			if err != nil {
+				return fmt.Errorf("invalid embedded JSON for %s: %s", fieldPath, err.Error())
+			}
+			if v == nil {
+				err := setDefault(fieldPath, spec, field)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		err := decodeJSONValue(fieldPath, v, field, strict)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseJSON(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeJSON stores the JSON document parsed by parseJSON into the struct pointed to by dest according to the `td` tags.
+func decodeJSON(v interface{}, dest interface{}, strict bool) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("type mismatch (%s != {}) for /", stringizeJSONType(v))
+	}
+	return decodeJSONObject("/", obj, reflect.ValueOf(dest).Elem(), strict)
+}
@@ -58,5 +58,11 @@ Job/Query API:
 Import API:
 
 	Import
+
+Every API function has a counterpart suffixed with Context (e.g. ListJobsContext,
+SubmitQueryContext, ImportContext) that takes a context.Context as its first
+argument.  The context is attached to the underlying HTTP request, so canceling
+it or letting its deadline pass aborts the call, including the transfer of the
+response body passed to the reader of JobResultContext or TailContext.
 */
 package td_client
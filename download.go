@@ -0,0 +1,380 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultDownloadChunkSize = 64 * 1024 * 1024
+
+// DownloadOptions stores the optional parameters of DownloadJobResult.
+type DownloadOptions struct {
+	Parallelism int          // (Optional) Number of the chunks downloaded at once. 0 or 1 downloads the result in a single stream.
+	ChunkSize   int64        // (Optional) Size of a chunk downloaded in parallel. Defaults to 64MiB.
+	Resume      *RetryPolicy // (Optional) How many times and after how long an interrupted download is resumed. Defaults to DefaultRetryPolicy.
+}
+
+// errRangeIgnored is returned by a chunk of a parallel download when the server has stopped honouring the ranges,
+// making the download fall back to a single stream.
+var errRangeIgnored = errors.New("server ignored the range request")
+
+// DownloadJobResult downloads the result of the job in the format, e.g. "msgpack.gz" or "csv", into the file at path,
+// returning the size of the file.
+//
+// When the download is interrupted by a transient failure, it is resumed from where it stopped with a Range request.
+// With Parallelism above 1, the result is split into chunks of ChunkSize downloaded at once, unless the server does not
+// honour ranges or stops honouring them partway, in which case the result is downloaded in a single stream and restarted
+// from the beginning after a failure.
+// The size of the file is verified against the size reported by the server.
+//
+// The result is written to a temporary file in the same directory, which is renamed to path once complete,
+// so the file never appears half-written.
+func (client *TDClient) DownloadJobResult(jobId string, format string, path string, options *DownloadOptions) (int64, error) {
+	return client.DownloadJobResultContext(context.Background(), jobId, format, path, options)
+}
+
+func (client *TDClient) DownloadJobResultContext(ctx context.Context, jobId string, format string, path string, options *DownloadOptions) (int64, error) {
+	d := &downloader{
+		client:     client,
+		ctx:        ctx,
+		requestUri: fmt.Sprintf("/v3/job/result/%s", url.QueryEscape(jobId)),
+		params:     url.Values{"format": {format}},
+		resume:     &DefaultRetryPolicy,
+	}
+	if options != nil {
+		d.options = *options
+	}
+	if d.options.ChunkSize <= 0 {
+		d.options.ChunkSize = defaultDownloadChunkSize
+	}
+	if d.options.Resume != nil {
+		d.resume = d.options.Resume
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	d.f = f
+	size, err := d.download()
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+type downloader struct {
+	client     *TDClient
+	ctx        context.Context
+	requestUri string
+	params     url.Values
+	options    DownloadOptions
+	resume     *RetryPolicy
+	f          *os.File
+}
+
+func (d *downloader) download() (int64, error) {
+	firstEnd := int64(-1)
+	if d.options.Parallelism > 1 {
+		firstEnd = d.options.ChunkSize - 1
+	}
+	var resp *http.Response
+	var partial bool
+	var total int64
+	for failures := 1; ; failures++ {
+		var err error
+		resp, partial, total, err = d.request(0, firstEnd)
+		if err == nil {
+			break
+		}
+		if !d.resumable(err) || failures >= d.resume.maxAttempts() {
+			return 0, err
+		}
+		err = sleepContext(d.ctx, d.resume.backoff(failures, nil))
+		if err != nil {
+			return 0, err
+		}
+	}
+	if d.options.Parallelism > 1 && partial && total < 0 {
+		// the size is unknown, so the result is requested again in a single stream.
+		resp.Body.Close()
+		resp = nil
+	}
+	if d.options.Parallelism <= 1 || !partial || total < 0 {
+		// a single stream, restarted from the beginning if the server does not honour ranges.
+		end := int64(-1)
+		if total >= 0 {
+			end = total - 1
+		}
+		size, err := d.fetch(resp, 0, end, true)
+		if err != nil {
+			return 0, err
+		}
+		return size, d.f.Truncate(size)
+	}
+	err := d.f.Truncate(total)
+	if err != nil {
+		resp.Body.Close()
+		return 0, err
+	}
+	err = d.fetchChunks(resp, total)
+	if err == errRangeIgnored {
+		// the server has stopped honouring the ranges, so the result is downloaded again in a single stream.
+		size, err := d.fetch(nil, 0, total-1, true)
+		if err != nil {
+			return 0, err
+		}
+		return size, d.f.Truncate(size)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// fetchChunks downloads the chunks in parallel, the first of which has been requested by resp.
+func (d *downloader) fetchChunks(resp *http.Response, total int64) error {
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	chunkDownloader := *d
+	chunkDownloader.ctx = ctx
+	chunkSize := d.options.ChunkSize
+	sem := make(chan struct{}, d.options.Parallelism)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	retval := (error)(nil)
+	for start := int64(0); start < total; start += chunkSize {
+		end := start + chunkSize - 1
+		if end >= total {
+			end = total - 1
+		}
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(resp *http.Response, start int64, end int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, err := chunkDownloader.fetch(resp, start, end, false)
+			if err != nil {
+				mu.Lock()
+				if retval == nil {
+					retval = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}(resp, start, end)
+		resp = nil
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	wg.Wait()
+	if retval == nil && d.ctx.Err() != nil {
+		retval = d.ctx.Err()
+	}
+	return retval
+}
+
+// fetch writes the bytes from start to end inclusive, or to the end of the result if end is negative,
+// at their offsets in the file, resuming with Range requests after failures.  resp is the response already
+// received for the range, if any.  When the server ignores the range, the download starts over if restartable
+// is true, which requires start to be 0, or fails with errRangeIgnored otherwise.  It returns the offset at
+// which the download has ended.
+func (d *downloader) fetch(resp *http.Response, start int64, end int64, restartable bool) (int64, error) {
+	offset := start
+	failures := 0
+	for {
+		var err error
+		if resp == nil {
+			var partial bool
+			resp, partial, _, err = d.request(offset, end)
+			if err == nil && !partial {
+				if restartable {
+					offset = start
+				} else {
+					resp.Body.Close()
+					resp = nil
+					err = errRangeIgnored
+				}
+			}
+		}
+		if err == nil {
+			// never write past the end of the range, whatever the server sends.
+			body := io.Reader(resp.Body)
+			if end >= 0 {
+				body = io.LimitReader(resp.Body, end-offset+1)
+			}
+			var n int64
+			n, err = io.Copy(&offsetWriter{f: d.f, offset: offset}, body)
+			resp.Body.Close()
+			resp = nil
+			offset += n
+			if n > 0 {
+				failures = 0
+			}
+			if err == nil && end >= 0 && offset != end+1 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				return offset, nil
+			}
+		}
+		failures++
+		if !d.resumable(err) || failures >= d.resume.maxAttempts() {
+			return offset, err
+		}
+		err = sleepContext(d.ctx, d.resume.backoff(failures, nil))
+		if err != nil {
+			return offset, err
+		}
+	}
+}
+
+// resumable tells whether the download may go on after the error.
+func (d *downloader) resumable(err error) bool {
+	if d.ctx.Err() != nil || err == errRangeIgnored {
+		return false
+	}
+	// failed to write the file
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return d.resume.transientStatus(apiErr.StatusCode)
+	}
+	return isTransientError(err)
+}
+
+// request asks for the bytes from start to end inclusive, or to the end of the result if end is negative.
+// partial tells whether the server has honoured the range, and total is the size of the whole result, or -1 if unknown.
+func (d *downloader) request(start int64, end int64) (resp *http.Response, partial bool, total int64, err error) {
+	header := http.Header{}
+	if end >= 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	} else {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+	// the ranges refer to the bytes as stored, so the transport must not negotiate a compression.
+	header.Set("Accept-Encoding", "identity")
+	resp, err = d.client.sendWithHeader(d.ctx, "DownloadJobResult", "GET", d.requestUri, d.params, header, nil, true)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, false, resp.ContentLength, nil
+	case http.StatusPartialContent:
+		first, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if ok && first == start {
+			return resp, true, total, nil
+		}
+		resp.Body.Close()
+		return nil, false, 0, &APIError{
+			Type:       InvalidResponseError,
+			Message:    fmt.Sprintf("Unexpected Content-Range %s for the range from %d", resp.Header.Get("Content-Range"), start),
+			StatusCode: resp.StatusCode,
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the range starts at the end of the result, e.g. the result is empty.
+		_, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if ok && total >= 0 && start >= total {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			resp.Body = http.NoBody
+			return resp, true, total, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, false, 0, d.client.buildError(resp, -1, "Get job result failed", nil)
+}
+
+// parseContentRange parses the value of Content-Range header, e.g. "bytes 0-99/1000" or "bytes */1000".
+// first is -1 for an unsatisfied range, and total is -1 if the size is unknown.
+func parseContentRange(value string) (first int64, total int64, ok bool) {
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	value = strings.TrimPrefix(value, "bytes ")
+	i := strings.IndexByte(value, '/')
+	if i < 0 {
+		return 0, 0, false
+	}
+	total = -1
+	if value[i+1:] != "*" {
+		var err error
+		total, err = strconv.ParseInt(value[i+1:], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	if value[:i] == "*" {
+		return -1, total, true
+	}
+	j := strings.IndexByte(value[:i], '-')
+	if j < 0 {
+		return 0, 0, false
+	}
+	first, err := strconv.ParseInt(value[:j], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return first, total, true
+}
+
+// offsetWriter writes to the file sequentially from the offset.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,253 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RangeTransport serves Data honouring the Range header unless IgnoreRange is set, or only for the first RangeLimit requests
+// if RangeLimit is positive.  The body of the nth response is cut after Cuts[n] bytes, if any.
+type RangeTransport struct {
+	Data        []byte
+	Total       int64 // size reported to the client, len(Data) if 0
+	IgnoreRange bool
+	RangeLimit  int
+	Cuts        []int
+	Ranges      []string
+	mu          sync.Mutex
+}
+
+// cutReader fails with io.ErrUnexpectedEOF after n bytes, as a connection dropped in the middle.
+type cutReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *cutReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func (t *RangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	rangeHeader := req.Header.Get("Range")
+	t.Ranges = append(t.Ranges, rangeHeader)
+	cut := -1
+	if len(t.Cuts) > 0 {
+		cut = t.Cuts[0]
+		t.Cuts = t.Cuts[1:]
+	}
+	ignoreRange := t.IgnoreRange || (t.RangeLimit > 0 && len(t.Ranges) > t.RangeLimit)
+	t.mu.Unlock()
+	total := t.Total
+	if total == 0 {
+		total = int64(len(t.Data))
+	}
+	resp := &http.Response{
+		Status:     http.StatusText(200),
+		StatusCode: 200,
+		Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header: http.Header{"Content-Type": {"application/octet-stream"}},
+	}
+	body := t.Data
+	if !ignoreRange && strings.HasPrefix(rangeHeader, "bytes=") {
+		bounds := strings.SplitN(strings.TrimPrefix(rangeHeader, "bytes="), "-", 2)
+		start, _ := strconv.ParseInt(bounds[0], 10, 64)
+		end := total - 1
+		if bounds[1] != "" {
+			end, _ = strconv.ParseInt(bounds[1], 10, 64)
+		}
+		if start >= int64(len(t.Data)) {
+			resp.Status, resp.StatusCode = http.StatusText(416), 416
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+			resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+			return resp, nil
+		}
+		if end >= int64(len(t.Data)) {
+			end = int64(len(t.Data)) - 1
+		}
+		body = t.Data[start : end+1]
+		resp.Status, resp.StatusCode = http.StatusText(206), 206
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+	}
+	resp.ContentLength = int64(len(body))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if cut >= 0 {
+		resp.Body = ioutil.NopCloser(&cutReader{r: bytes.NewReader(body), n: cut})
+	}
+	return resp, nil
+}
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func downloadTestFile(t *testing.T, transport *RangeTransport, options *DownloadOptions) (string, int64, error) {
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	dir, err := ioutil.TempDir("", "td-client-go")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "result.msgpack.gz")
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	options.Resume = testRetryPolicy
+	size, err := client.DownloadJobResult("12345", "msgpack.gz", path, options)
+	return path, size, err
+}
+
+func checkDownloadedFile(t *testing.T, path string, size int64, data []byte) {
+	if size != int64(len(data)) {
+		t.Fatalf("unexpected size: %d", size)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("unexpected content: %d bytes", len(b))
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*"))
+	if len(files) != 0 {
+		t.Fatalf("temporary files are left: %v", files)
+	}
+}
+
+func TestDownloadJobResultResume(t *testing.T) {
+	data := testData(1000)
+	transport := &RangeTransport{Data: data, Cuts: []int{300, 200}}
+	path, size, err := downloadTestFile(t, transport, nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	checkDownloadedFile(t, path, size, data)
+	expected := []string{"bytes=0-", "bytes=300-999", "bytes=500-999"}
+	if strings.Join(transport.Ranges, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected ranges: %v", transport.Ranges)
+	}
+}
+
+func TestDownloadJobResultParallel(t *testing.T) {
+	data := testData(1050)
+	transport := &RangeTransport{Data: data, Cuts: []int{50}}
+	path, size, err := downloadTestFile(t, transport, &DownloadOptions{Parallelism: 3, ChunkSize: 100})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	checkDownloadedFile(t, path, size, data)
+	// 11 chunks, the first of which is resumed
+	ranges := append([]string{}, transport.Ranges...)
+	sort.Strings(ranges)
+	if len(ranges) != 12 || transport.Ranges[0] != "bytes=0-99" || ranges[2] != "bytes=1000-1049" || ranges[6] != "bytes=50-99" {
+		t.Fatalf("unexpected ranges: %v", ranges)
+	}
+}
+
+func TestDownloadJobResultIgnoredRange(t *testing.T) {
+	data := testData(1000)
+	transport := &RangeTransport{Data: data, IgnoreRange: true, Cuts: []int{300}}
+	path, size, err := downloadTestFile(t, transport, &DownloadOptions{Parallelism: 4, ChunkSize: 100})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	checkDownloadedFile(t, path, size, data)
+	// falls back to a single stream, restarted from the beginning
+	if len(transport.Ranges) != 2 {
+		t.Fatalf("unexpected ranges: %v", transport.Ranges)
+	}
+}
+
+func TestDownloadJobResultRangeStopsBeingHonoured(t *testing.T) {
+	data := testData(1000)
+	transport := &RangeTransport{Data: data, RangeLimit: 3}
+	path, size, err := downloadTestFile(t, transport, &DownloadOptions{Parallelism: 2, ChunkSize: 100})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	checkDownloadedFile(t, path, size, data)
+	// falls back to a single stream once a chunk gets the whole result
+	if last := transport.Ranges[len(transport.Ranges)-1]; last != "bytes=0-999" {
+		t.Fatalf("unexpected ranges: %v", transport.Ranges)
+	}
+}
+
+func TestDownloadJobResultEmpty(t *testing.T) {
+	transport := &RangeTransport{}
+	path, size, err := downloadTestFile(t, transport, nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	checkDownloadedFile(t, path, size, []byte{})
+}
+
+func TestDownloadJobResultSizeMismatch(t *testing.T) {
+	transport := &RangeTransport{Data: testData(900), Total: 1000}
+	path, _, err := downloadTestFile(t, transport, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	hidden, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*"))
+	if len(files)+len(hidden) != 0 {
+		t.Fatalf("files are left: %v %v", files, hidden)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for value, expected := range map[string][3]int64{
+		"bytes 0-99/1000": {0, 1000, 1},
+		"bytes 100-199/*": {100, -1, 1},
+		"bytes */1000":    {-1, 1000, 1},
+		"bytes 0-99":      {0, 0, 0},
+		"items 0-99/1000": {0, 0, 0},
+	} {
+		first, total, ok := parseContentRange(value)
+		if first != expected[0] || total != expected[1] || ok != (expected[2] == 1) {
+			t.Errorf("%s: unexpected %d %d %v", value, first, total, ok)
+		}
+	}
+}
@@ -1,24 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
 	"fmt"
 	td_client "github.com/treasure-data/td-client-go"
-	"github.com/ugorji/go/codec"
 	"os"
 	"strconv"
 	"time"
 )
 
-func CompressWithGzip(b []byte) []byte {
-	retval := bytes.Buffer{}
-	w := gzip.NewWriter(&retval)
-	w.Write(b)
-	w.Close()
-	return retval.Bytes()
-}
-
 func main() {
 	apiKey := os.Getenv("TD_CLIENT_API_KEY")
 	client, err := td_client.NewTDClient(td_client.Settings{
@@ -99,22 +88,30 @@ func main() {
 			return
 		}
 	}
-	data := bytes.Buffer{}
-	handle := codec.MsgpackHandle{}
-	encoder := codec.NewEncoder(&data, &handle)
+	writer := client.NewRecordWriter(nil, func(part td_client.Blob, records int) error {
+		payloadSize, _ := part.Size()
+		fmt.Printf("payloadSize:%d\n", payloadSize)
+		time_, err := client.Import("sample_db2", "test", "msgpack.gz", part, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("elapsed time:%g\n", time_)
+		return nil
+	})
 	for i := 0; i < 10000; i += 1 {
-		encoder.Encode(map[string]interface{}{
+		err = writer.Write(map[string]interface{}{
 			"time": i, "a": strconv.Itoa(i), "b": strconv.Itoa(i),
 		})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 	}
-	payload := CompressWithGzip(data.Bytes())
-	fmt.Printf("payloadSize:%d\n", len(payload))
-	time_, err := client.Import("sample_db2", "test", "msgpack.gz", (td_client.InMemoryBlob)(payload), "")
+	err = writer.Close()
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	fmt.Printf("elapsed time:%g\n", time_)
 	jobId, err := client.SubmitQuery("sample_db2", td_client.Query{
 		Type:       "hive",
 		Query:      "SELECT COUNT(*) AS c FROM test WHERE a >= 5000",
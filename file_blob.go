@@ -0,0 +1,140 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileBlob is a Blob backed by a file.  Reader() opens the file on every call, so an upload can be retried
+// without holding the content in memory.  The MD5 sum is computed once by reading through the file and cached.
+type FileBlob struct {
+	Path   string
+	mu     sync.Mutex
+	md5Sum []byte
+}
+
+// NewFileBlob creates a FileBlob for the file at path.
+func NewFileBlob(path string) *FileBlob {
+	return &FileBlob{Path: path}
+}
+
+func (blob *FileBlob) Reader() (io.ReadCloser, error) {
+	return os.Open(blob.Path)
+}
+
+func (blob *FileBlob) Size() (int64, error) {
+	info, err := os.Stat(blob.Path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (blob *FileBlob) MD5Sum() ([]byte, error) {
+	blob.mu.Lock()
+	defer blob.mu.Unlock()
+	if blob.md5Sum == nil {
+		md5Sum, err := readerMD5Sum(blob)
+		if err != nil {
+			return nil, err
+		}
+		blob.md5Sum = md5Sum
+	}
+	return blob.md5Sum, nil
+}
+
+// SectionBlob is a Blob exposing a byte range of a file, which lets a large file be uploaded
+// in several parts without copying.
+type SectionBlob struct {
+	Path   string
+	Offset int64
+	Length int64
+	mu     sync.Mutex
+	md5Sum []byte
+}
+
+// NewSectionBlob creates a SectionBlob for length bytes starting at offset of the file at path.
+func NewSectionBlob(path string, offset int64, length int64) *SectionBlob {
+	return &SectionBlob{Path: path, Offset: offset, Length: length}
+}
+
+type sectionReader struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (r *sectionReader) Close() error {
+	return r.f.Close()
+}
+
+func (blob *SectionBlob) Reader() (io.ReadCloser, error) {
+	_, err := blob.Size()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(blob.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &sectionReader{io.NewSectionReader(f, blob.Offset, blob.Length), f}, nil
+}
+
+// Size returns Length after checking that the range lies within the file.
+func (blob *SectionBlob) Size() (int64, error) {
+	info, err := os.Stat(blob.Path)
+	if err != nil {
+		return 0, err
+	}
+	if blob.Offset < 0 || blob.Length < 0 || blob.Offset+blob.Length > info.Size() {
+		return 0, fmt.Errorf("section %d+%d is out of %s (%d bytes)", blob.Offset, blob.Length, blob.Path, info.Size())
+	}
+	return blob.Length, nil
+}
+
+func (blob *SectionBlob) MD5Sum() ([]byte, error) {
+	blob.mu.Lock()
+	defer blob.mu.Unlock()
+	if blob.md5Sum == nil {
+		md5Sum, err := readerMD5Sum(blob)
+		if err != nil {
+			return nil, err
+		}
+		blob.md5Sum = md5Sum
+	}
+	return blob.md5Sum, nil
+}
+
+func readerMD5Sum(blob Blob) ([]byte, error) {
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := md5.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,107 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func readBlob(t *testing.T, blob Blob) []byte {
+	r, err := blob.Reader()
+	if err != nil {
+		t.Fatalf("failed to open blob: %s", err.Error())
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read blob: %s", err.Error())
+	}
+	return b
+}
+
+func TestFileBlob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "part")
+	content := []byte("0123456789")
+	err := ioutil.WriteFile(path, content, 0600)
+	if err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	blob := NewFileBlob(path)
+	size, err := blob.Size()
+	if err != nil || size != 10 {
+		t.Fatalf("unexpected size: %d, %v", size, err)
+	}
+	for i := 0; i < 2; i++ {
+		if !bytes.Equal(readBlob(t, blob), content) {
+			t.Fatalf("unexpected content")
+		}
+	}
+	md5Sum, err := blob.MD5Sum()
+	if err != nil {
+		t.Fatalf("failed to compute md5: %s", err.Error())
+	}
+	expected := md5.Sum(content)
+	if !bytes.Equal(md5Sum, expected[:]) {
+		t.Fatalf("unexpected md5: %x", md5Sum)
+	}
+	err = ioutil.WriteFile(path, []byte("changed"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	md5Sum, _ = blob.MD5Sum()
+	if !bytes.Equal(md5Sum, expected[:]) {
+		t.Fatalf("md5 is not cached")
+	}
+	_, err = NewFileBlob(filepath.Join(t.TempDir(), "missing")).Reader()
+	if err == nil {
+		t.Fatalf("expected an error for the missing file")
+	}
+}
+
+func TestSectionBlob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	err := ioutil.WriteFile(path, []byte("0123456789"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	blob := NewSectionBlob(path, 3, 4)
+	size, err := blob.Size()
+	if err != nil || size != 4 {
+		t.Fatalf("unexpected size: %d, %v", size, err)
+	}
+	if string(readBlob(t, blob)) != "3456" {
+		t.Fatalf("unexpected content")
+	}
+	md5Sum, err := blob.MD5Sum()
+	if err != nil {
+		t.Fatalf("failed to compute md5: %s", err.Error())
+	}
+	expected := md5.Sum([]byte("3456"))
+	if !bytes.Equal(md5Sum, expected[:]) {
+		t.Fatalf("unexpected md5: %x", md5Sum)
+	}
+	_, err = NewSectionBlob(path, 8, 4).Size()
+	if err == nil {
+		t.Fatalf("expected an error for the section out of the file")
+	}
+}
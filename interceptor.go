@@ -0,0 +1,102 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// RoundTripFunc sends the request issued by the API call named operation, such as "SubmitQuery" or "Import",
+// which is the name of the TDClient method without the Context suffix.
+type RoundTripFunc func(operation string, req *http.Request) (*http.Response, error)
+
+// Interceptor is a middleware that wraps the RoundTripFunc sending the requests of TDClient.
+//
+// Interceptors are given in Settings.Interceptors and see every attempt made under the retry policy,
+// after the client has set the headers and before the request reaches the transport.  An interceptor
+// may modify the request, observe the response, or return a response or an error without calling next.
+// As with http.RoundTripper, the returned response body is closed by the client.
+type Interceptor func(next RoundTripFunc) RoundTripFunc
+
+// chainInterceptors builds the RoundTripFunc that passes the request through the interceptors to the transport.
+func chainInterceptors(transport http.RoundTripper, interceptors []Interceptor) RoundTripFunc {
+	var retval RoundTripFunc = func(_ string, req *http.Request) (*http.Response, error) {
+		return transport.RoundTrip(req)
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		retval = interceptors[i](retval)
+	}
+	return retval
+}
+
+type attemptKey struct{}
+
+type operationKey struct{}
+
+type decodedRowsKey struct{}
+
+type requestErrorKey struct{}
+
+// RequestAttempt returns the number of the attempt, 1 for the first, given the context of a request passed to an Interceptor.
+func RequestAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// DecodedRows returns the number of rows decoded so far from the response of JobResultEach or Tail, given the context
+// of the request passed to an Interceptor.  The count is final when the response body is closed.
+// ok is false for the requests of other API calls.
+func DecodedRows(ctx context.Context) (n int64, ok bool) {
+	counter, ok := ctx.Value(decodedRowsKey{}).(*int64)
+	if !ok {
+		return 0, false
+	}
+	return atomic.LoadInt64(counter), true
+}
+
+// withRowCounter attaches the counter reported by DecodedRows to the context.
+func withRowCounter(ctx context.Context) (context.Context, *int64) {
+	counter := new(int64)
+	return context.WithValue(ctx, decodedRowsKey{}, counter), counter
+}
+
+// RequestError returns the APIError the API call has built from the response, given the context of the request passed
+// to an Interceptor.  It is set by the time the response body is closed, and nil if the call has not failed on the response.
+func RequestError(ctx context.Context) *APIError {
+	holder, ok := ctx.Value(requestErrorKey{}).(*atomic.Value)
+	if !ok {
+		return nil
+	}
+	apiErr, _ := holder.Load().(*APIError)
+	return apiErr
+}
+
+// withRequestError attaches the holder of the error reported by RequestError to the context.
+func withRequestError(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestErrorKey{}, &atomic.Value{})
+}
+
+// recordRequestError stores the error for RequestError in the context of the request the response is for.
+func recordRequestError(resp *http.Response, apiErr *APIError) {
+	if holder, ok := resp.Request.Context().Value(requestErrorKey{}).(*atomic.Value); ok {
+		holder.Store(apiErr)
+	}
+}
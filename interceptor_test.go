@@ -0,0 +1,214 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterceptors(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		jobStatusResponse("success"),
+		showJobResponse("success", ""),
+	}}
+	trace := []string{}
+	record := func(name string) Interceptor {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(operation string, req *http.Request) (*http.Response, error) {
+				trace = append(trace, name+" "+operation+" "+req.URL.Path)
+				req.Header.Set("X-Intercepted-By", name)
+				resp, err := next(operation, req)
+				trace = append(trace, name+" done")
+				return resp, err
+			}
+		}
+	}
+	var header string
+	client, err := NewTDClient(Settings{
+		Transport: transport,
+		Interceptors: []Interceptor{
+			record("outer"),
+			record("inner"),
+			func(next RoundTripFunc) RoundTripFunc {
+				return func(operation string, req *http.Request) (*http.Response, error) {
+					header = req.Header.Get("X-Intercepted-By")
+					return next(operation, req)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.JobStatus("9999999")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.ShowJob("9999999")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	expected := []string{
+		"outer JobStatus /v3/job/status/9999999",
+		"inner JobStatus /v3/job/status/9999999",
+		"inner done",
+		"outer done",
+		"outer ShowJob /v3/job/show/9999999",
+		"inner ShowJob /v3/job/show/9999999",
+		"inner done",
+		"outer done",
+	}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("unexpected trace: %v", trace)
+	}
+	if header != "inner" {
+		t.Fatalf("unexpected header: %s", header)
+	}
+}
+
+func TestInterceptorOperations(t *testing.T) {
+	submitResponse := `{"job":"9999999","job_id":"9999999","database":"sample_datasets"}`
+	listResponse := `{"jobs":[],"count":0,"from":null,"to":null}`
+	for expected, test := range map[string]struct {
+		response string
+		call     func(client *TDClient) error
+	}{
+		"CreateLogTable": {createLogTableResponse, func(client *TDClient) error {
+			return client.CreateLogTable("sample_datasets", "www_access")
+		}},
+		"ListJobs": {listResponse, func(client *TDClient) error {
+			_, err := client.ListJobs()
+			return err
+		}},
+		"ListJobsWithOptions": {listResponse, func(client *TDClient) error {
+			_, err := client.ListJobsWithOptions(&ListJobsOptions{})
+			return err
+		}},
+		"SubmitQuery": {submitResponse, func(client *TDClient) error {
+			_, err := client.SubmitQuery("sample_datasets", Query{Type: "presto", Query: "SELECT 1"})
+			return err
+		}},
+		"SubmitQueryWithOptions": {submitResponse, func(client *TDClient) error {
+			_, err := client.SubmitQueryWithOptions("sample_datasets", NewQuery("SELECT 1"))
+			return err
+		}},
+	} {
+		operations := []string{}
+		client, err := NewTDClient(Settings{
+			Transport: &DummyTransport{[]byte(test.response)},
+			Interceptors: []Interceptor{func(next RoundTripFunc) RoundTripFunc {
+				return func(operation string, req *http.Request) (*http.Response, error) {
+					operations = append(operations, operation)
+					return next(operation, req)
+				}
+			}},
+		})
+		if err != nil {
+			t.Fatalf("failed create client: %s", err.Error())
+		}
+		err = test.call(client)
+		if err != nil {
+			t.Fatalf("%s: bad request: %s", expected, err.Error())
+		}
+		if len(operations) != 1 || operations[0] != expected {
+			t.Fatalf("%s: unexpected operations: %v", expected, operations)
+		}
+	}
+}
+
+func TestInterceptorFaultInjection(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		jobStatusResponse("success"),
+	}}
+	attempts := 0
+	numbers := []int{}
+	client, err := NewTDClient(Settings{
+		Transport: transport,
+		Retry:     &RetryPolicy{BaseBackoff: time.Millisecond, Jitter: -1},
+		Interceptors: []Interceptor{
+			func(next RoundTripFunc) RoundTripFunc {
+				return func(operation string, req *http.Request) (*http.Response, error) {
+					attempts++
+					numbers = append(numbers, RequestAttempt(req.Context()))
+					if attempts == 1 {
+						return nil, syscall.ECONNRESET
+					}
+					return next(operation, req)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	status, err := client.JobStatus("9999999")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if status != "success" || attempts != 2 || len(transport.Paths) != 1 {
+		t.Fatalf("unexpected result: %s after %d attempts", status, attempts)
+	}
+	if !reflect.DeepEqual(numbers, []int{1, 2}) {
+		t.Fatalf("unexpected attempt numbers: %v", numbers)
+	}
+}
+
+// closeHook calls onClose when the body is closed.
+type closeHook struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *closeHook) Close() error {
+	b.onClose()
+	return b.ReadCloser.Close()
+}
+
+func TestRequestError(t *testing.T) {
+	var apiErr *APIError
+	client, err := NewTDClient(Settings{
+		Transport: &DummyTransport{[]byte("{")},
+		Interceptors: []Interceptor{
+			func(next RoundTripFunc) RoundTripFunc {
+				return func(operation string, req *http.Request) (*http.Response, error) {
+					resp, err := next(operation, req)
+					if err == nil {
+						resp.Body = &closeHook{ReadCloser: resp.Body, onClose: func() { apiErr = RequestError(req.Context()) }}
+					}
+					return resp, err
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ListDatabases()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if apiErr == nil || apiErr.TypeName() != "InvalidResponseError" || apiErr.Operation != "ListDatabases" {
+		t.Fatalf("unexpected request error: %v", apiErr)
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// DefaultJobPageSize is the number of the jobs JobIterator fetches at once by default.
+const DefaultJobPageSize = 100
+
+// JobFilter selects the jobs walked by JobIterator.  Status and SlowerThan are applied by the API,
+// while Database, Since and Until are applied as the pages arrive.
+type JobFilter struct {
+	Status     string        // (Optional) One of queued, running, success, error and killed.
+	SlowerThan time.Duration // (Optional) Only the jobs that have run for longer than this.
+	Database   string        // (Optional) Only the jobs issued against the database.
+	Since      time.Time     // (Optional) Only the jobs created at or after this.
+	Until      time.Time     // (Optional) Only the jobs created before this.
+	PageSize   int           // (Optional) Number of the jobs fetched per request. Defaults to DefaultJobPageSize.
+}
+
+// JobIterator walks the job history from the newest job to the oldest, fetching a page at a time.
+//
+//	it := client.Jobs(td_client.JobFilter{Status: "error"})
+//	for it.Next() {
+//		job := it.Job()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type JobIterator struct {
+	client *TDClient
+	ctx    context.Context
+	filter JobFilter
+	page   ListJobsResultElements
+	job    ListJobsResultElement
+	from   int
+	lastId int64 // Id of the last job yielded, to skip the jobs pushed into the next page by the new ones.
+	done   bool
+	err    error
+}
+
+// Jobs returns a JobIterator over the jobs selected by the filter.
+func (client *TDClient) Jobs(filter JobFilter) *JobIterator {
+	return client.JobsContext(context.Background(), filter)
+}
+
+func (client *TDClient) JobsContext(ctx context.Context, filter JobFilter) *JobIterator {
+	if filter.PageSize <= 0 {
+		filter.PageSize = DefaultJobPageSize
+	}
+	return &JobIterator{client: client, ctx: ctx, filter: filter, lastId: -1}
+}
+
+// Next advances to the next job, returning false when the jobs are exhausted or an error has occurred.
+func (it *JobIterator) Next() bool {
+	for {
+		for len(it.page) > 0 {
+			job := it.page[0]
+			it.page = it.page[1:]
+			if id, err := strconv.ParseInt(job.Id, 10, 64); err == nil {
+				if it.lastId >= 0 && id >= it.lastId {
+					continue
+				}
+				it.lastId = id
+			}
+			if !it.filter.Since.IsZero() && job.CreatedAt.Before(it.filter.Since) {
+				// the jobs are listed newest first, so the rest are older still.
+				it.page = nil
+				it.done = true
+				break
+			}
+			if !it.filter.Until.IsZero() && !job.CreatedAt.Before(it.filter.Until) {
+				continue
+			}
+			if it.filter.Database != "" && job.Database != it.filter.Database {
+				continue
+			}
+			it.job = job
+			return true
+		}
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+}
+
+func (it *JobIterator) fetch() {
+	options := &ListJobsOptions{}
+	options.WithFrom(it.from).WithTo(it.from + it.filter.PageSize - 1)
+	if it.filter.Status != "" {
+		options.WithStatus(it.filter.Status)
+	}
+	if it.filter.SlowerThan > 0 {
+		options.WithSlowerThan(it.filter.SlowerThan)
+	}
+	result, err := it.client.ListJobsWithOptionsContext(it.ctx, options)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.page = result.ListJobsResultElements
+	it.from += it.filter.PageSize
+	if len(it.page) < it.filter.PageSize {
+		it.done = true
+	}
+}
+
+// Job returns the current job.
+func (it *JobIterator) Job() ListJobsResultElement {
+	return it.job
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *JobIterator) Err() error {
+	return it.err
+}
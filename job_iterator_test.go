@@ -0,0 +1,178 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var jobListEpoch = time.Date(2016, 7, 26, 0, 0, 0, 0, time.UTC)
+
+// JobListTransport serves the jobs numbered from 1 to Jobs, newest first, one created every hour
+// in the database sample_db, or other_db for the multiples of 3.  The multiples of 5 have an empty result schema,
+// as the jobs that have not produced a result.  OnList is called after each page.
+type JobListTransport struct {
+	Jobs    int
+	Queries []string
+	OnList  func(t *JobListTransport)
+}
+
+func (t *JobListTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Queries = append(t.Queries, req.URL.RawQuery)
+	params := req.URL.Query()
+	from, _ := strconv.Atoi(params.Get("from"))
+	to, _ := strconv.Atoi(params.Get("to"))
+	jobs := []interface{}{}
+	for i := from; i <= to && t.Jobs-i > 0; i++ {
+		id := t.Jobs - i
+		db := "sample_db"
+		if id%3 == 0 {
+			db = "other_db"
+		}
+		createdAt := jobListEpoch.Add(time.Duration(id) * time.Hour).Format("2006-01-02 15:04:05 MST")
+		schema := `[["_col0", "bigint"]]`
+		if id%5 == 0 {
+			schema = ""
+		}
+		jobs = append(jobs, map[string]interface{}{
+			"job_id": strconv.Itoa(id), "type": "presto", "database": db, "status": "success",
+			"query": "SELECT 1", "created_at": createdAt, "updated_at": createdAt, "result": "",
+			"priority": 0, "retry_limit": 0, "user_name": "alice@example.com",
+			"url": fmt.Sprintf("https://console.treasuredata.com/jobs/%d", id), "organization": nil,
+			"hive_result_schema": schema,
+		})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"jobs": jobs, "count": t.Jobs, "from": from, "to": to})
+	if t.OnList != nil {
+		t.OnList(t)
+	}
+	return &http.Response{
+		Status: "200 OK", StatusCode: 200,
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func collectJobIds(t *testing.T, it *JobIterator) []string {
+	ids := []string{}
+	for it.Next() {
+		ids = append(ids, it.Job().Id)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	return ids
+}
+
+func TestJobIterator(t *testing.T) {
+	transport := &JobListTransport{Jobs: 7}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	it := client.JobsContext(context.Background(), JobFilter{PageSize: 3, Status: "killed", SlowerThan: 90 * time.Second})
+	ids := []string{}
+	for it.Next() {
+		ids = append(ids, it.Job().Id)
+		if it.Job().Id == "5" && it.Job().HiveResultSchema != nil {
+			t.Fatalf("unexpected result schema: %v", it.Job().HiveResultSchema)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if !reflect.DeepEqual(ids, []string{"7", "6", "5", "4", "3", "2", "1"}) {
+		t.Fatalf("unexpected jobs: %v", ids)
+	}
+	if !reflect.DeepEqual(transport.Queries, []string{
+		"from=0&slower_than=90&status=killed&to=2",
+		"from=3&slower_than=90&status=killed&to=5",
+		"from=6&slower_than=90&status=killed&to=8",
+	}) {
+		t.Fatalf("unexpected queries: %v", transport.Queries)
+	}
+	job := it.Job()
+	if job.UserName != "alice@example.com" || job.Url != "https://console.treasuredata.com/jobs/1" || !reflect.DeepEqual(job.HiveResultSchema, []interface{}{[]interface{}{"_col0", "bigint"}}) {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestJobIteratorFilter(t *testing.T) {
+	transport := &JobListTransport{Jobs: 20}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	ids := collectJobIds(t, client.Jobs(JobFilter{
+		PageSize: 4,
+		Database: "sample_db",
+		Since:    jobListEpoch.Add(5 * time.Hour),
+		Until:    jobListEpoch.Add(15 * time.Hour),
+	}))
+	if !reflect.DeepEqual(ids, []string{"14", "13", "11", "10", "8", "7", "5"}) {
+		t.Fatalf("unexpected jobs: %v", ids)
+	}
+	// the iteration stops at the first job older than Since without fetching further pages.
+	if len(transport.Queries) != 5 {
+		t.Fatalf("unexpected queries: %v", transport.Queries)
+	}
+}
+
+func TestJobIteratorNewJobs(t *testing.T) {
+	// a job issued between the pages shifts the older jobs toward the next page.
+	transport := &JobListTransport{Jobs: 5, OnList: func(t *JobListTransport) { t.Jobs++ }}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	ids := collectJobIds(t, client.Jobs(JobFilter{PageSize: 2}))
+	if !reflect.DeepEqual(ids, []string{"5", "4", "3", "2", "1"}) {
+		t.Fatalf("unexpected jobs: %v", ids)
+	}
+}
+
+func TestListJobsUnsupportedStatus(t *testing.T) {
+	transport := &JobListTransport{}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ListJobsWithOptions((&ListJobsOptions{}).WithStatus("finished"))
+	if err == nil {
+		t.Fatal("expected error for the unsupported status")
+	}
+	it := client.Jobs(JobFilter{Status: "finished"})
+	if it.Next() || it.Err() == nil {
+		t.Fatal("expected error for the unsupported status")
+	}
+	if len(transport.Queries) != 0 {
+		t.Fatalf("unexpected queries: %v", transport.Queries)
+	}
+}
@@ -0,0 +1,358 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLoggerClosed is returned by Logger.Post after the logger has been closed.
+	ErrLoggerClosed = errors.New("logger is closed")
+	// ErrLogBatchDropped is passed to LoggerOptions.OnFailure for the batches dropped because the upload queue is full.
+	ErrLogBatchDropped = errors.New("log batch dropped because the upload queue is full")
+)
+
+// LogBatch is a chunk of records uploaded by Logger in a single Import call.
+type LogBatch struct {
+	Database string
+	Table    string
+	Format   string // Always "msgpack.gz".
+	UniqueId string // Passed to Import so that a retried upload is not loaded twice.
+	Records  int
+	Blob     Blob
+}
+
+// LoggerOptions stores the optional parameters of Logger.
+type LoggerOptions struct {
+	FlushRecords  int                              // (Optional) Number of records per table that triggers a flush. Defaults to 10000.
+	FlushSize     int                              // (Optional) Compressed size in bytes per table that triggers a flush. Defaults to 4MiB.
+	FlushInterval time.Duration                    // (Optional) Interval at which the buffers are flushed regardless of their size. Defaults to 1 minute.
+	Concurrency   int                              // (Optional) Number of goroutines uploading the batches. Defaults to 2.
+	QueueSize     int                              // (Optional) Number of batches waiting for upload beyond which new batches are dropped. Defaults to 32.
+	Spool         *Spool                           // (Optional) Spool where the batches that have been dropped or failed to upload are saved.
+	OnFailure     func(batch *LogBatch, err error) // (Optional) Called with the batches that have been dropped or failed to upload.
+}
+
+// Logger buffers records per table and uploads them in the background through Import.
+//
+// Records are accepted in the same forms as RecordWriter.  Each batch is uploaded with
+// a unique id generated on creation, so the retries of Import never load it twice.
+// Batches that cannot be uploaded are saved to LoggerOptions.Spool if given, and then
+// reported to LoggerOptions.OnFailure along with the error, which is the one of the
+// spool if saving has failed as well.  OnFailure is called from the background
+// goroutines and must not call Post on the same Logger.
+type Logger struct {
+	client    *TDClient
+	options   LoggerOptions
+	mu        sync.Mutex
+	buffers   map[string]*loggerBuffer
+	closed    bool
+	queue     chan *LogBatch
+	senders   sync.WaitGroup // FlushContext and CloseContext calls handing batches to the queue, which is closed after them
+	stop      chan struct{}
+	ctx       context.Context // context of the uploads, canceled once CloseContext gives up waiting for them
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	pendingMu sync.Mutex
+	pending   int
+	drained   *sync.Cond
+}
+
+type loggerBuffer struct {
+	db     string
+	table  string
+	writer *RecordWriter
+	ready  []*LogBatch
+}
+
+// NewLogger creates a Logger and starts its background goroutines.  Close must be called to release them.
+func (client *TDClient) NewLogger(options *LoggerOptions) *Logger {
+	l := &Logger{
+		client:  client,
+		buffers: map[string]*loggerBuffer{},
+		stop:    make(chan struct{}),
+	}
+	if options != nil {
+		l.options = *options
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	if l.options.FlushRecords <= 0 {
+		l.options.FlushRecords = 10000
+	}
+	if l.options.FlushSize <= 0 {
+		l.options.FlushSize = 4 * 1024 * 1024
+	}
+	if l.options.FlushInterval <= 0 {
+		l.options.FlushInterval = time.Minute
+	}
+	if l.options.Concurrency <= 0 {
+		l.options.Concurrency = 2
+	}
+	if l.options.QueueSize <= 0 {
+		l.options.QueueSize = 32
+	}
+	l.drained = sync.NewCond(&l.pendingMu)
+	l.queue = make(chan *LogBatch, l.options.QueueSize)
+	for i := 0; i < l.options.Concurrency; i++ {
+		l.workers.Add(1)
+		go l.upload()
+	}
+	go l.tick()
+	return l
+}
+
+// Post adds the record to the buffer of the table.
+func (l *Logger) Post(db string, table string, record interface{}) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrLoggerClosed
+	}
+	key := db + "." + table
+	buffer, ok := l.buffers[key]
+	if !ok {
+		buffer = &loggerBuffer{db: db, table: table}
+		buffer.writer = l.client.NewRecordWriter(&RecordWriterOptions{
+			MaxRecords: l.options.FlushRecords,
+			MaxSize:    l.options.FlushSize,
+		}, buffer.add)
+		l.buffers[key] = buffer
+	}
+	err := buffer.writer.Write(record)
+	dropped := l.enqueue(buffer.ready)
+	buffer.ready = nil
+	l.mu.Unlock()
+	l.failAll(dropped, ErrLogBatchDropped)
+	return err
+}
+
+// Flush uploads the buffered records and waits until all the batches have been processed.
+func (l *Logger) Flush() error {
+	return l.FlushContext(context.Background())
+}
+
+// FlushContext is Flush giving up when ctx is done.  The batches that could not be queued by then are reported as
+// failed with the error of ctx, while those queued are still uploaded in the background.
+func (l *Logger) FlushContext(ctx context.Context) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrLoggerClosed
+	}
+	batches, err := l.flushBuffers()
+	l.senders.Add(1)
+	l.mu.Unlock()
+	left := l.send(ctx, batches)
+	l.failAll(left, ctx.Err())
+	drained := make(chan struct{})
+	go func() {
+		l.pendingMu.Lock()
+		for l.pending > 0 {
+			l.drained.Wait()
+		}
+		l.pendingMu.Unlock()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Close flushes the buffered records, waits for the uploads in progress and stops the background goroutines.
+func (l *Logger) Close() error {
+	return l.CloseContext(context.Background())
+}
+
+// CloseContext is Close canceling the uploads in progress when ctx is done.  The batches that have not been uploaded
+// by then are reported as failed, which saves them to the spool if any.
+func (l *Logger) CloseContext(ctx context.Context) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.stop)
+	batches, err := l.flushBuffers()
+	l.senders.Add(1)
+	l.mu.Unlock()
+	left := l.send(ctx, batches)
+	stopped := make(chan struct{})
+	go func() {
+		l.senders.Wait()
+		close(l.queue)
+		l.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// the uploads fail as soon as their context is canceled, so the workers stop shortly.
+		l.cancel()
+		<-stopped
+	}
+	l.cancel()
+	l.failAll(left, ctx.Err())
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (buffer *loggerBuffer) add(part Blob, records int) error {
+	buffer.ready = append(buffer.ready, &LogBatch{
+		Database: buffer.db,
+		Table:    buffer.table,
+		Format:   "msgpack.gz",
+		UniqueId: newUniqueId(),
+		Records:  records,
+		Blob:     part,
+	})
+	return nil
+}
+
+// flushBuffers completes the parts of all the buffers and takes their batches; it must be called with l.mu held.
+func (l *Logger) flushBuffers() ([]*LogBatch, error) {
+	var firstErr error
+	var batches []*LogBatch
+	for _, buffer := range l.buffers {
+		err := buffer.writer.Flush()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		batches = append(batches, buffer.ready...)
+		buffer.ready = nil
+	}
+	return batches, firstErr
+}
+
+// enqueue hands the batches to the uploaders unless the queue is full; it must be called with l.mu held.
+// The dropped batches are returned so that they are reported after l.mu is released.
+func (l *Logger) enqueue(batches []*LogBatch) []*LogBatch {
+	var dropped []*LogBatch
+	for _, batch := range batches {
+		l.pendingMu.Lock()
+		l.pending++
+		l.pendingMu.Unlock()
+		select {
+		case l.queue <- batch:
+		default:
+			l.done()
+			dropped = append(dropped, batch)
+		}
+	}
+	return dropped
+}
+
+// send hands the batches to the uploaders, waiting for room in the queue until ctx is done, and returns the batches
+// left.  It must be called without l.mu held, after l.senders has been added to with l.mu held.
+func (l *Logger) send(ctx context.Context, batches []*LogBatch) []*LogBatch {
+	defer l.senders.Done()
+	for i, batch := range batches {
+		if ctx.Err() != nil {
+			return batches[i:]
+		}
+		l.pendingMu.Lock()
+		l.pending++
+		l.pendingMu.Unlock()
+		select {
+		case l.queue <- batch:
+		case <-ctx.Done():
+			l.done()
+			return batches[i:]
+		}
+	}
+	return nil
+}
+
+func (l *Logger) done() {
+	l.pendingMu.Lock()
+	l.pending--
+	if l.pending == 0 {
+		l.drained.Broadcast()
+	}
+	l.pendingMu.Unlock()
+}
+
+func (l *Logger) failAll(batches []*LogBatch, err error) {
+	for _, batch := range batches {
+		batchErr := err
+		if l.options.Spool != nil {
+			spoolErr := l.options.Spool.Write(batch)
+			if spoolErr != nil {
+				batchErr = spoolErr
+			}
+		}
+		if l.options.OnFailure != nil {
+			l.options.OnFailure(batch, batchErr)
+		}
+	}
+}
+
+func (l *Logger) upload() {
+	defer l.workers.Done()
+	for batch := range l.queue {
+		_, err := l.client.ImportContext(l.ctx, batch.Database, batch.Table, batch.Format, batch.Blob, batch.UniqueId)
+		if err != nil {
+			l.failAll([]*LogBatch{batch}, err)
+		}
+		l.done()
+	}
+}
+
+func (l *Logger) tick() {
+	ticker := time.NewTicker(l.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			var dropped []*LogBatch
+			if !l.closed {
+				batches, _ := l.flushBuffers()
+				dropped = l.enqueue(batches)
+			}
+			l.mu.Unlock()
+			l.failAll(dropped, ErrLogBatchDropped)
+		}
+	}
+}
+
+// newUniqueId generates a random id for Import in the same form as the other Treasure Data clients, 32 hex digits.
+func newUniqueId() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
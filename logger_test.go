@@ -0,0 +1,201 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ImportTransport accepts Import calls and records the requested paths.  With Hang set, the calls never complete
+// until they are canceled.
+type ImportTransport struct {
+	mu         sync.Mutex
+	StatusCode int
+	Hang       bool
+	Paths      []string
+	Bodies     []string
+}
+
+func (t *ImportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Hang {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sent, _ := ioutil.ReadAll(req.Body)
+	t.Paths = append(t.Paths, req.URL.Path)
+	t.Bodies = append(t.Bodies, string(sent))
+	statusCode, body := t.StatusCode, `{"error":"Invalid format"}`
+	if statusCode == 0 {
+		statusCode, body = 200, `{"database":"db","table":"tbl","md5_hex":"","elapsed_time":0.1}`
+	}
+	return &http.Response{
+		Status: http.StatusText(statusCode), StatusCode: statusCode,
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func (t *ImportTransport) paths() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.Paths...)
+}
+
+func TestLogger(t *testing.T) {
+	transport := &ImportTransport{}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	logger := client.NewLogger(&LoggerOptions{FlushRecords: 2})
+	for i := 0; i < 5; i++ {
+		err = logger.Post("db", "a", map[string]interface{}{"i": i})
+		if err != nil {
+			t.Fatalf("failed to post: %s", err.Error())
+		}
+	}
+	err = logger.Post("db", "b", map[string]interface{}{"i": 0})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	err = logger.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	uniqueIds := map[string]bool{}
+	tables := map[string]int{}
+	for _, path := range transport.paths() {
+		elems := strings.Split(path, "/")
+		if len(elems) != 8 || elems[3] != "import_with_id" || elems[7] != "msgpack.gz" {
+			t.Fatalf("unexpected request: %s", path)
+		}
+		tables[elems[5]]++
+		uniqueIds[elems[6]] = true
+	}
+	if tables["a"] != 3 || tables["b"] != 1 || len(uniqueIds) != 4 {
+		t.Fatalf("unexpected requests: %v", transport.Paths)
+	}
+	if logger.Post("db", "a", map[string]interface{}{}) != ErrLoggerClosed {
+		t.Fatalf("expected ErrLoggerClosed")
+	}
+}
+
+func TestLoggerFailure(t *testing.T) {
+	transport := &ImportTransport{StatusCode: 400}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	mu := sync.Mutex{}
+	failed := []*LogBatch{}
+	logger := client.NewLogger(&LoggerOptions{
+		OnFailure: func(batch *LogBatch, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, batch)
+		},
+	})
+	defer logger.Close()
+	err = logger.Post("db", "tbl", map[string]interface{}{"i": 0})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	err = logger.Flush()
+	if err != nil {
+		t.Fatalf("failed to flush: %s", err.Error())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || failed[0].Table != "tbl" || failed[0].Records != 1 || len(failed[0].UniqueId) != 32 {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+}
+
+func TestLoggerFlushInterval(t *testing.T) {
+	transport := &ImportTransport{}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	logger := client.NewLogger(&LoggerOptions{FlushInterval: 10 * time.Millisecond})
+	defer logger.Close()
+	err = logger.Post("db", "tbl", map[string]interface{}{"i": 0})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(transport.paths()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("records have not been flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoggerHungUpload(t *testing.T) {
+	transport := &ImportTransport{Hang: true}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	failures := make(chan error, 10)
+	logger := client.NewLogger(&LoggerOptions{
+		Concurrency: 1,
+		OnFailure: func(batch *LogBatch, err error) {
+			failures <- err
+		},
+	})
+	err = logger.Post("db", "tbl", map[string]interface{}{"i": 0})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = logger.FlushContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	// the logger is not locked by the upload in progress.
+	err = logger.Post("db", "tbl", map[string]interface{}{"i": 1})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = logger.CloseContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if len(failures) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(failures))
+	}
+	if err := <-failures; err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// QueryEngine is the engine a query runs on.
+type QueryEngine string
+
+const (
+	Hive   QueryEngine = "hive"
+	Presto QueryEngine = "presto"
+)
+
+// JobPriority is the priority of a job, from VeryLow to VeryHigh.
+type JobPriority int
+
+const (
+	VeryLow  JobPriority = -2
+	Low      JobPriority = -1
+	Normal   JobPriority = 0
+	High     JobPriority = 1
+	VeryHigh JobPriority = 2
+)
+
+var jobPriorityNames = map[JobPriority]string{
+	VeryLow:  "VERY LOW",
+	Low:      "LOW",
+	Normal:   "NORMAL",
+	High:     "HIGH",
+	VeryHigh: "VERY HIGH",
+}
+
+// String returns the name of the priority shown in the console, e.g. "VERY HIGH".
+func (p JobPriority) String() string {
+	name, ok := jobPriorityNames[p]
+	if !ok {
+		return strconv.Itoa(int(p))
+	}
+	return name
+}
+
+// engineVersionPattern matches the engine versions, "stable", "experimental" or a version number such as "350".
+var engineVersionPattern = regexp.MustCompile(`^(stable|experimental|[0-9]+(\.[0-9]+)*)$`)
+
+// QueryOptions describes a query submitted by SubmitQueryWithOptions, created by NewQuery:
+//
+//	jobId, err := client.SubmitQueryWithOptions("mydatabase",
+//		td_client.NewQuery("SELECT * FROM mytable").Engine(td_client.Hive).Priority(td_client.High).Retry(3))
+//
+// Unlike Query, the priority and the retry limit are left to the server unless they are set.
+type QueryOptions struct {
+	query         string
+	engine        QueryEngine
+	engineVersion string
+	priority      *JobPriority
+	retryLimit    *int
+	resultUrl     string
+	poolName      string
+	domainKey     string
+}
+
+// NewQuery creates the options of the query, running on Presto unless Engine is called.
+func NewQuery(query string) *QueryOptions {
+	return &QueryOptions{query: query, engine: Presto}
+}
+
+func (options *QueryOptions) Engine(engine QueryEngine) *QueryOptions {
+	options.engine = engine
+	return options
+}
+
+// EngineVersion sets the version of the engine, which is "stable", "experimental" or a version number.
+// SubmitQueryWithOptions fails for any other version.
+func (options *QueryOptions) EngineVersion(version string) *QueryOptions {
+	options.engineVersion = version
+	return options
+}
+
+// Priority sets the priority of the job.  SubmitQueryWithOptions fails for a priority out of VeryLow to VeryHigh.
+func (options *QueryOptions) Priority(priority JobPriority) *QueryOptions {
+	options.priority = &priority
+	return options
+}
+
+// Retry sets how many times the job is retried after it fails.
+func (options *QueryOptions) Retry(limit int) *QueryOptions {
+	options.retryLimit = &limit
+	return options
+}
+
+// Result sets the URL the result of the job is written to.
+func (options *QueryOptions) Result(resultUrl string) *QueryOptions {
+	options.resultUrl = resultUrl
+	return options
+}
+
+// PoolName sets the resource pool the job runs in.
+func (options *QueryOptions) PoolName(poolName string) *QueryOptions {
+	options.poolName = poolName
+	return options
+}
+
+// DomainKey sets the idempotency key; the server rejects a second job issued with the same key.  It makes the
+// submission retried, and a retry whose first attempt was issued fails with ErrAlreadyExists as SubmitQuery describes.
+func (options *QueryOptions) DomainKey(domainKey string) *QueryOptions {
+	options.domainKey = domainKey
+	return options
+}
+
+// Validate checks the options as SubmitQueryWithOptions does before sending them.
+func (options *QueryOptions) Validate() error {
+	if options.query == "" {
+		return fmt.Errorf("query is empty")
+	}
+	if options.engine != Hive && options.engine != Presto {
+		return fmt.Errorf("unsupported query engine: %s", options.engine)
+	}
+	if options.engineVersion != "" && !engineVersionPattern.MatchString(options.engineVersion) {
+		return fmt.Errorf("unsupported engine version: %s", options.engineVersion)
+	}
+	if options.priority != nil && (*options.priority < VeryLow || *options.priority > VeryHigh) {
+		return fmt.Errorf("unsupported priority: %d", *options.priority)
+	}
+	if options.retryLimit != nil && *options.retryLimit < 0 {
+		return fmt.Errorf("negative retry limit: %d", *options.retryLimit)
+	}
+	return nil
+}
+
+func (options *QueryOptions) values() url.Values {
+	params := url.Values{}
+	params.Set("query", options.query)
+	if options.resultUrl != "" {
+		params.Set("result", options.resultUrl)
+	}
+	if options.priority != nil {
+		params.Set("priority", strconv.Itoa(int(*options.priority)))
+	}
+	if options.retryLimit != nil {
+		params.Set("retry_limit", strconv.Itoa(*options.retryLimit))
+	}
+	if options.engineVersion != "" {
+		params.Set("engine_version", options.engineVersion)
+	}
+	if options.poolName != "" {
+		params.Set("pool_name", options.poolName)
+	}
+	if options.domainKey != "" {
+		params.Set("domain_key", options.domainKey)
+	}
+	return params
+}
+
+func (client *TDClient) SubmitQueryWithOptions(db string, options *QueryOptions) (string, error) {
+	return client.SubmitQueryWithOptionsContext(context.Background(), db, options)
+}
+
+func (client *TDClient) SubmitQueryWithOptionsContext(ctx context.Context, db string, options *QueryOptions) (string, error) {
+	err := options.Validate()
+	if err != nil {
+		return "", err
+	}
+	return client.submitQuery(ctx, "SubmitQueryWithOptions", string(options.engine), db, options.values())
+}
+
+const tdTimeLayout = "2006-01-02 15:04:05"
+
+// tdIntervalPattern matches the duration of TD_INTERVAL, e.g. "-1d" or "2h".
+var tdIntervalPattern = regexp.MustCompile(`^[+-]?[0-9]+[smhdwMy]$`)
+
+// tdLocation returns the location the times are written in for the TD time functions and its name.  local stands for
+// time.Local, whose name is unknown, so the fixed offset in effect at t, e.g. "-0700", stands for it, and the times must
+// be written with that offset rather than the local one that may change with DST.
+func tdLocation(t time.Time, local *time.Location) (*time.Location, string) {
+	loc := t.Location()
+	if loc == time.UTC {
+		return loc, "UTC"
+	}
+	if loc == local || loc.String() == "" {
+		_, offset := t.Zone()
+		return time.FixedZone("", offset), t.Format("-0700")
+	}
+	return loc, loc.String()
+}
+
+// TDTimeRange renders the predicate TD_TIME_RANGE(column, start, end, timezone) selecting the rows whose column is
+// at or after start and before end, e.g. TD_TIME_RANGE(time, '2020-01-01 00:00:00', '2020-01-02 00:00:00', 'Asia/Tokyo').
+// The bounds are written in the location of start, and a zero end leaves the range open.  Sub-second parts are truncated.
+func TDTimeRange(column string, start time.Time, end time.Time) string {
+	return tdTimeRange(column, start, end, time.Local)
+}
+
+func tdTimeRange(column string, start time.Time, end time.Time, local *time.Location) string {
+	loc, timezone := tdLocation(start, local)
+	to := "NULL"
+	if !end.IsZero() {
+		to = "'" + end.In(loc).Format(tdTimeLayout) + "'"
+	}
+	return fmt.Sprintf("TD_TIME_RANGE(%s, '%s', %s, '%s')", column, start.In(loc).Format(tdTimeLayout), to, timezone)
+}
+
+// TDInterval renders the predicate TD_INTERVAL(column, duration, timezone) relative to the time the query is scheduled at,
+// e.g. TD_INTERVAL(time, '-1d', 'Asia/Tokyo') selecting the day before in Tokyo.  The duration is a number followed by
+// one of the units s, m, h, d, w, M and y.
+func TDInterval(column string, duration string, loc *time.Location) (string, error) {
+	if !tdIntervalPattern.MatchString(duration) {
+		return "", fmt.Errorf("invalid TD_INTERVAL duration: %s", duration)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	_, timezone := tdLocation(time.Now().In(loc), time.Local)
+	return fmt.Sprintf("TD_INTERVAL(%s, '%s', '%s')", column, duration, timezone), nil
+}
+
+// TDIntervalAt is TDInterval relative to base, e.g. TD_INTERVAL(time, '-1d/2020-01-02', 'Asia/Tokyo')
+// selecting the 1st of January 2020 in Tokyo.  base is written in its location, with the time of the day unless midnight.
+func TDIntervalAt(column string, duration string, base time.Time) (string, error) {
+	if !tdIntervalPattern.MatchString(duration) {
+		return "", fmt.Errorf("invalid TD_INTERVAL duration: %s", duration)
+	}
+	loc, timezone := tdLocation(base, time.Local)
+	base = base.In(loc)
+	at := base.Format(tdTimeLayout)
+	if base.Hour() == 0 && base.Minute() == 0 && base.Second() == 0 {
+		at = base.Format("2006-01-02")
+	}
+	return fmt.Sprintf("TD_INTERVAL(%s, '%s/%s', '%s')", column, duration, at, timezone), nil
+}
@@ -0,0 +1,150 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSubmitQueryWithOptions(t *testing.T) {
+	transport := &FlakyTransport{ResponseBytes: []byte(`{"job":"9999999","job_id":"9999999","database":"sample_datasets"}`)}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	options := NewQuery("SELECT 1").Engine(Hive).EngineVersion("stable").Priority(VeryLow).Retry(0).
+		Result("td://@/db/tbl").PoolName("hadoop2").DomainKey("key")
+	jobId, err := client.SubmitQueryWithOptions("sample_datasets", options)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if jobId != "9999999" {
+		t.Fatalf("unexpected job id: %s", jobId)
+	}
+	params, _ := url.ParseQuery(transport.Bodies[0])
+	expected := url.Values{
+		"query":          {"SELECT 1"},
+		"engine_version": {"stable"},
+		"priority":       {"-2"},
+		"retry_limit":    {"0"},
+		"result":         {"td://@/db/tbl"},
+		"pool_name":      {"hadoop2"},
+		"domain_key":     {"key"},
+	}
+	if params.Encode() != expected.Encode() {
+		t.Fatalf("unexpected params: %s", params.Encode())
+	}
+
+	_, err = client.SubmitQueryWithOptions("sample_datasets", NewQuery("SELECT 1"))
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	params, _ = url.ParseQuery(transport.Bodies[1])
+	if params.Encode() != "query=SELECT+1" {
+		t.Fatalf("unexpected params: %s", params.Encode())
+	}
+}
+
+func TestQueryOptionsValidate(t *testing.T) {
+	for _, options := range []*QueryOptions{
+		NewQuery(""),
+		NewQuery("SELECT 1").Engine("pig"),
+		NewQuery("SELECT 1").EngineVersion("latest"),
+		NewQuery("SELECT 1").Priority(3),
+		NewQuery("SELECT 1").Retry(-1),
+	} {
+		if options.Validate() == nil {
+			t.Errorf("expected error for %+v", options)
+		}
+	}
+	for _, version := range []string{"stable", "experimental", "350", "0.205"} {
+		err := NewQuery("SELECT 1").EngineVersion(version).Validate()
+		if err != nil {
+			t.Errorf("%s: %s", version, err.Error())
+		}
+	}
+	if High.String() != "HIGH" || VeryLow.String() != "VERY LOW" {
+		t.Fatalf("unexpected names: %s %s", High, VeryLow)
+	}
+}
+
+func TestTDTimeRange(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, tokyo)
+	end := time.Date(2020, 1, 1, 15, 0, 0, 0, time.UTC)
+	expected := "TD_TIME_RANGE(time, '2020-01-01 00:00:00', '2020-01-02 00:00:00', 'Asia/Tokyo')"
+	if s := TDTimeRange("time", start, end); s != expected {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+	expected = "TD_TIME_RANGE(time, '2019-12-31 15:00:00', NULL, 'UTC')"
+	if s := TDTimeRange("time", start.UTC(), time.Time{}); s != expected {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+	fixed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.FixedZone("", -7*60*60))
+	expected = "TD_TIME_RANGE(time, '2020-01-01 00:00:00', NULL, '-0700')"
+	if s := TDTimeRange("time", fixed, time.Time{}); s != expected {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+}
+
+func TestTDTimeRangeLocalDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err.Error())
+	}
+	// DST starts on the 8th of March 2020, so the end is written with the offset of the start.
+	start := time.Date(2020, 3, 7, 0, 0, 0, 0, newYork)
+	end := time.Date(2020, 3, 9, 0, 0, 0, 0, newYork)
+	expected := "TD_TIME_RANGE(time, '2020-03-07 00:00:00', '2020-03-08 23:00:00', '-0500')"
+	if s := tdTimeRange("time", start, end, newYork); s != expected {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+}
+
+func TestTDInterval(t *testing.T) {
+	s, err := TDInterval("time", "-1d", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s != "TD_INTERVAL(time, '-1d', 'UTC')" {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+	s, err = TDIntervalAt("t.time", "-1h", time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s != "TD_INTERVAL(t.time, '-1h/2020-01-02 03:00:00', 'UTC')" {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+	s, err = TDIntervalAt("time", "1M", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s != "TD_INTERVAL(time, '1M/2020-01-01', 'UTC')" {
+		t.Fatalf("unexpected predicate: %s", s)
+	}
+	if _, err := TDInterval("time", "1 day", nil); err == nil {
+		t.Fatal("expected error for the invalid duration")
+	}
+}
@@ -0,0 +1,235 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit describes the client-side limits on the requests sent to an endpoint.
+//
+// The requests waiting for the limits are served in the order they arrived, and give up
+// waiting when their context is done.  When the endpoint responds with 429, the requests to it
+// are held back for the duration given by Retry-After (DefaultRateLimitPause if absent) and
+// RequestsPerSecond is halved, recovering gradually as the subsequent requests succeed.
+type RateLimit struct {
+	RequestsPerSecond float64 // Sustained rate of the requests. 0 means no limit on the rate.
+	Burst             int     // Number of the requests that can be sent at once when the rate allows. Defaults to 1.
+	MaxInFlight       int     // Number of the requests outstanding at once, until their response bodies are closed. 0 means no limit.
+}
+
+// DefaultRateLimitPause is how long the requests to an endpoint are held back after a 429 response without Retry-After.
+var DefaultRateLimitPause = time.Second
+
+// maxSlowdown bounds the factor by which 429 responses divide RateLimit.RequestsPerSecond.
+const maxSlowdown = 64
+
+// rateLimiter enforces a RateLimit on an endpoint.
+type rateLimiter struct {
+	limit       RateLimit
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	slowdown    float64
+	pausedUntil time.Time
+	inFlight    int
+	waiters     []chan struct{} // Requests waiting for an in-flight slot, in arrival order.
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &rateLimiter{
+		limit:    limit,
+		tokens:   float64(limit.Burst),
+		last:     time.Now(),
+		slowdown: 1,
+	}
+}
+
+// rateLimiters holds the limiters of the endpoints, created as the endpoints are first used.
+type rateLimiters struct {
+	limits   map[string]RateLimit
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+func newRateLimiters(limits map[string]RateLimit) *rateLimiters {
+	if len(limits) == 0 {
+		return nil
+	}
+	return &rateLimiters{
+		limits:   limits,
+		limiters: map[string]*rateLimiter{},
+	}
+}
+
+// get returns the limiter of the endpoint, or nil if the endpoint is not limited.
+func (l *rateLimiters) get(endpoint string) *rateLimiter {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limiter, ok := l.limiters[endpoint]; ok {
+		return limiter
+	}
+	limit, ok := l.limits[endpoint]
+	if !ok {
+		limit, ok = l.limits[""]
+	}
+	limiter := (*rateLimiter)(nil)
+	if ok {
+		limiter = newRateLimiter(limit)
+	}
+	l.limiters[endpoint] = limiter
+	return limiter
+}
+
+// acquire waits until the request may be sent.  release must be called once the response has been consumed.
+func (l *rateLimiter) acquire(ctx context.Context) error {
+	if l.limit.MaxInFlight > 0 {
+		err := l.acquireSlot(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	wait, reserved := l.reserve(time.Now())
+	err := sleepContext(ctx, wait)
+	if err != nil {
+		l.mu.Lock()
+		if reserved {
+			l.tokens++
+		}
+		l.mu.Unlock()
+		l.release()
+		return err
+	}
+	return nil
+}
+
+func (l *rateLimiter) acquireSlot(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < l.limit.MaxInFlight && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, w := range l.waiters {
+			if w == ch {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				l.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		l.mu.Unlock()
+		// the slot has been handed over in the meantime; pass it on.
+		l.release()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait for it.
+func (l *rateLimiter) reserve(now time.Time) (wait time.Duration, reserved bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit.RequestsPerSecond > 0 {
+		rate := l.limit.RequestsPerSecond / l.slowdown
+		l.tokens += now.Sub(l.last).Seconds() * rate
+		if burst := float64(l.limit.Burst); l.tokens > burst {
+			l.tokens = burst
+		}
+		l.last = now
+		l.tokens--
+		reserved = true
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / rate * float64(time.Second))
+		}
+	}
+	if pause := l.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+	return wait, reserved
+}
+
+// release frees the in-flight slot taken by acquire, handing it to the longest waiting request.
+func (l *rateLimiter) release() {
+	if l.limit.MaxInFlight <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) > 0 {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		return
+	}
+	l.inFlight--
+}
+
+// observe adapts the limits to the response.
+func (l *rateLimiter) observe(resp *http.Response) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.slowdown *= 2
+		if l.slowdown > maxSlowdown {
+			l.slowdown = maxSlowdown
+		}
+		pause, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if !ok {
+			pause = DefaultRateLimitPause
+		}
+		if until := now.Add(pause); until.After(l.pausedUntil) {
+			l.pausedUntil = until
+		}
+	} else if resp.StatusCode < 400 && l.slowdown > 1 {
+		l.slowdown /= 1.1
+		if l.slowdown < 1 {
+			l.slowdown = 1
+		}
+	}
+}
+
+// limitedBody releases the in-flight slot when the response body is closed.
+type limitedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	limiter *rateLimiter
+}
+
+func (b *limitedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.limiter.release)
+	return err
+}
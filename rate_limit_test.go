@@ -0,0 +1,212 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ConcurrencyTransport holds every request for Delay and records the maximum number of the requests in flight.
+type ConcurrencyTransport struct {
+	Delay       time.Duration
+	mu          sync.Mutex
+	inFlight    int
+	MaxInFlight int
+	Hosts       []string
+}
+
+func (t *ConcurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.inFlight++
+	if t.inFlight > t.MaxInFlight {
+		t.MaxInFlight = t.inFlight
+	}
+	t.Hosts = append(t.Hosts, req.URL.Host)
+	t.mu.Unlock()
+	time.Sleep(t.Delay)
+	t.mu.Lock()
+	t.inFlight--
+	t.mu.Unlock()
+	body := jobStatusResponse("success")
+	return &http.Response{
+		Status: "200 OK", StatusCode: 200,
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func TestRateLimitMaxInFlight(t *testing.T) {
+	transport := &ConcurrencyTransport{Delay: 5 * time.Millisecond}
+	client, err := NewTDClient(Settings{
+		Transport:  transport,
+		RateLimits: map[string]RateLimit{DefaultRouter.DefaultEndpoint: {MaxInFlight: 2}},
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.JobStatus("9999999")
+			if err != nil {
+				t.Errorf("bad request: %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if transport.MaxInFlight != 2 {
+		t.Fatalf("unexpected number of requests in flight: %d", transport.MaxInFlight)
+	}
+}
+
+func TestRateLimitPerEndpoint(t *testing.T) {
+	limiters := newRateLimiters(map[string]RateLimit{DefaultRouter.ImportEndpoint: {RequestsPerSecond: 1}})
+	if limiters.get(DefaultRouter.ImportEndpoint) == nil || limiters.get(DefaultRouter.DefaultEndpoint) != nil {
+		t.Fatal("unexpected limiters")
+	}
+	limiters = newRateLimiters(map[string]RateLimit{"": {RequestsPerSecond: 1}})
+	if limiters.get(DefaultRouter.ImportEndpoint) == limiters.get(DefaultRouter.DefaultEndpoint) {
+		t.Fatal("endpoints share a limiter")
+	}
+	if newRateLimiters(nil).get(DefaultRouter.DefaultEndpoint) != nil {
+		t.Fatal("unexpected limiter")
+	}
+}
+
+func TestRateLimitRate(t *testing.T) {
+	client, err := NewTDClient(Settings{
+		Transport:  &ConcurrencyTransport{},
+		RateLimits: map[string]RateLimit{"": {RequestsPerSecond: 100, Burst: 2}},
+	})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	startedAt := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := client.JobStatus("9999999")
+		if err != nil {
+			t.Fatalf("bad request: %s", err.Error())
+		}
+	}
+	// the burst lets the first two through and the rest are paced at 10ms.
+	if elapsed := time.Since(startedAt); elapsed < 35*time.Millisecond {
+		t.Fatalf("requests were not paced: %s", elapsed)
+	}
+}
+
+func TestRateLimitFairness(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{MaxInFlight: 1})
+	err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mu := sync.Mutex{}
+	order := []int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := limiter.acquire(context.Background())
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			limiter.release()
+		}(i)
+		// wait for the goroutine to queue up before starting the next.
+		for {
+			limiter.mu.Lock()
+			n := len(limiter.waiters)
+			limiter.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	limiter.release()
+	wg.Wait()
+	if !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	if limiter.inFlight != 0 {
+		t.Fatalf("slots leaked: %d", limiter.inFlight)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{MaxInFlight: 1})
+	err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	err = limiter.acquire(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if len(limiter.waiters) != 0 {
+		t.Fatal("waiter left in the queue")
+	}
+	limiter.release()
+	if limiter.inFlight != 0 {
+		t.Fatalf("slots leaked: %d", limiter.inFlight)
+	}
+}
+
+func TestRateLimitSlowDown(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 10, Burst: 1})
+	now := time.Now()
+	limiter.observe(&http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"2"}}})
+	if limiter.slowdown != 2 {
+		t.Fatalf("unexpected slowdown: %g", limiter.slowdown)
+	}
+	wait, _ := limiter.reserve(now)
+	if wait < 1900*time.Millisecond || wait > 2*time.Second+100*time.Millisecond {
+		t.Fatalf("unexpected wait: %s", wait)
+	}
+	// the next token comes at the halved rate.
+	limiter.pausedUntil = time.Time{}
+	wait, _ = limiter.reserve(now)
+	if wait < 190*time.Millisecond || wait > 210*time.Millisecond {
+		t.Fatalf("unexpected wait: %s", wait)
+	}
+	for i := 0; i < 100; i++ {
+		limiter.observe(&http.Response{StatusCode: 200})
+	}
+	if limiter.slowdown != 1 {
+		t.Fatalf("unexpected slowdown: %g", limiter.slowdown)
+	}
+}
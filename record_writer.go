@@ -0,0 +1,249 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+const defaultMaxPartSize = 32 * 1024 * 1024
+
+// RecordWriterOptions stores the optional parameters of RecordWriter.
+type RecordWriterOptions struct {
+	MaxRecords int              // (Optional) Number of records after which a new part is started. 0 means no limit.
+	MaxSize    int              // (Optional) Compressed size in bytes after which a new part is started. Defaults to 32MiB.
+	Now        func() time.Time // (Optional) Gives the value of the `time` column for the records that lack it. Defaults to time.Now.
+}
+
+// RecordWriter encodes records into gzipped MessagePack, the "msgpack.gz" format accepted by Import and UploadBulkImportPart.
+//
+// Records are either map[string]interface{} or structs, whose fields are named by the `td` tag, e.g. `td:"user_id"`,
+// or by the field name in lower case when the tag is absent.  Fields tagged with `td:"-"` are skipped.
+//
+// Every record must have a `time` column holding a non-negative integer or a time.Time, the latter being converted
+// into the UNIX time.  The column is added if missing.
+//
+// The output is split into parts so that each part stays within the limits; every complete part is passed to the
+// function given to NewRecordWriter.  MaxSize is checked against the data that has been compressed so far, so a part
+// may exceed it by the size of the internal buffer of the compressor.  A part the function fails for is kept and passed
+// to it again by the next Flush or Close.
+//
+// A RecordWriter is not safe for concurrent use.
+type RecordWriter struct {
+	options        RecordWriterOptions
+	flush          func(part Blob, records int) error
+	buf            *bytes.Buffer
+	gz             *gzip.Writer
+	scratch        bytes.Buffer // encoded record, written to gz only once complete
+	encoder        *codec.Encoder
+	records        int
+	pending        Blob // completed part the flush function has failed for
+	pendingRecords int
+}
+
+// NewRecordWriter creates a RecordWriter that calls flush with every complete part.
+func (client *TDClient) NewRecordWriter(options *RecordWriterOptions, flush func(part Blob, records int) error) *RecordWriter {
+	w := &RecordWriter{
+		flush: flush,
+		buf:   &bytes.Buffer{},
+	}
+	if options != nil {
+		w.options = *options
+	}
+	if w.options.MaxSize <= 0 {
+		w.options.MaxSize = defaultMaxPartSize
+	}
+	if w.options.Now == nil {
+		w.options.Now = time.Now
+	}
+	w.gz = gzip.NewWriter(w.buf)
+	w.encoder = client.getMessagePackEncoder(&w.scratch)
+	return w
+}
+
+// Write adds the record to the current part, flushing the part if it has reached the limits.
+func (w *RecordWriter) Write(record interface{}) error {
+	if w.gz == nil {
+		return errors.New("record writer is closed")
+	}
+	m, err := w.recordToMap(record)
+	if err != nil {
+		return err
+	}
+	// a record failing partway must not leave its beginning in the part.
+	w.scratch.Reset()
+	err = w.encoder.Encode(m)
+	if err != nil {
+		// the encoder keeps failing once it has failed.
+		w.encoder.Reset(&w.scratch)
+		return err
+	}
+	_, err = w.gz.Write(w.scratch.Bytes())
+	if err != nil {
+		return err
+	}
+	w.records++
+	if (w.options.MaxRecords > 0 && w.records >= w.options.MaxRecords) || w.buf.Len() >= w.options.MaxSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush completes the current part and passes it to the flush function unless it is empty, after the part the
+// function has failed for, if any.
+func (w *RecordWriter) Flush() error {
+	if w.gz == nil {
+		return errors.New("record writer is closed")
+	}
+	if w.pending != nil {
+		err := w.flush(w.pending, w.pendingRecords)
+		if err != nil {
+			return err
+		}
+		w.pending, w.pendingRecords = nil, 0
+	}
+	if w.records == 0 {
+		return nil
+	}
+	err := w.gz.Close()
+	if err != nil {
+		return err
+	}
+	part, records := InMemoryBlob(w.buf.Bytes()), w.records
+	w.buf = &bytes.Buffer{}
+	w.gz.Reset(w.buf)
+	w.records = 0
+	err = w.flush(part, records)
+	if err != nil {
+		w.pending, w.pendingRecords = part, records
+		return err
+	}
+	return nil
+}
+
+// Close flushes the last part.  The RecordWriter cannot be used afterwards, unless Close fails, in which case
+// it may be called again to pass the remaining parts.
+func (w *RecordWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	w.gz = nil
+	return nil
+}
+
+func (w *RecordWriter) recordToMap(record interface{}) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if src, ok := record.(map[string]interface{}); ok {
+		m = make(map[string]interface{}, len(src)+1)
+		for k, v := range src {
+			m[k] = v
+		}
+	} else {
+		rv := reflect.ValueOf(record)
+		if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("record must be a map[string]interface{} or a struct: %T", record)
+		}
+		m = structToRecord(rv)
+	}
+	t, ok := m["time"]
+	if !ok || t == nil {
+		m["time"] = w.options.Now().Unix()
+		return m, nil
+	}
+	unixTime, err := recordTime(t)
+	if err != nil {
+		return nil, err
+	}
+	m["time"] = unixTime
+	return m, nil
+}
+
+func structToRecord(rv reflect.Value) map[string]interface{} {
+	type_ := rv.Type()
+	m := make(map[string]interface{}, type_.NumField())
+	for i := 0; i < type_.NumField(); i++ {
+		f := type_.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, tagged := f.Tag.Lookup("td")
+		if name == "-" {
+			continue
+		}
+		if !tagged {
+			name = strings.ToLower(f.Name)
+		}
+		m[name] = rv.Field(i).Interface()
+	}
+	return m
+}
+
+// recordTime validates the value of the `time` column and converts it into the UNIX time.
+func recordTime(v interface{}) (int64, error) {
+	var retval int64
+	switch v := v.(type) {
+	case time.Time:
+		retval = v.Unix()
+	case *time.Time:
+		if v == nil {
+			return 0, errors.New("time column may not be null")
+		}
+		retval = v.Unix()
+	case int:
+		retval = int64(v)
+	case int32:
+		retval = int64(v)
+	case int64:
+		retval = v
+	case uint32:
+		retval = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("time column out of range: %d", v)
+		}
+		retval = int64(v)
+	case float64:
+		if v != math.Trunc(v) || v > math.MaxInt64 {
+			return 0, fmt.Errorf("time column must be an integer: %g", v)
+		}
+		retval = int64(v)
+	default:
+		return 0, fmt.Errorf("time column must be an integer or time.Time: %T", v)
+	}
+	if retval < 0 {
+		return 0, fmt.Errorf("time column must not be negative: %d", retval)
+	}
+	return retval, nil
+}
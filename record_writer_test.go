@@ -0,0 +1,215 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type testRecord struct {
+	Time   time.Time `td:"time"`
+	UserId int64     `td:"user_id"`
+	Name   string
+	Secret string `td:"-"`
+}
+
+func readRecordPart(t *testing.T, part Blob) []map[string]interface{} {
+	r, err := part.Reader()
+	if err != nil {
+		t.Fatalf("failed to read part: %s", err.Error())
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("failed to read part: %s", err.Error())
+	}
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	dec := codec.NewDecoder(gz, handle)
+	retval := []map[string]interface{}{}
+	for {
+		m := map[string]interface{}{}
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to decode part: %s", err.Error())
+		}
+		retval = append(retval, m)
+	}
+	return retval
+}
+
+func TestRecordWriter(t *testing.T) {
+	client, err := NewTDClient(Settings{})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	parts := [][]map[string]interface{}{}
+	w := client.NewRecordWriter(&RecordWriterOptions{
+		MaxRecords: 2,
+		Now:        func() time.Time { return time.Unix(1400000000, 0) },
+	}, func(part Blob, records int) error {
+		parts = append(parts, readRecordPart(t, part))
+		if len(parts[len(parts)-1]) != records {
+			t.Fatalf("expected %d records, got %d", records, len(parts[len(parts)-1]))
+		}
+		return nil
+	})
+	err = w.Write(map[string]interface{}{"a": "x"})
+	if err != nil {
+		t.Fatalf("failed to write: %s", err.Error())
+	}
+	err = w.Write(map[string]interface{}{"time": 1500000000, "a": "y"})
+	if err != nil {
+		t.Fatalf("failed to write: %s", err.Error())
+	}
+	err = w.Write(&testRecord{Time: time.Unix(1600000000, 0), UserId: 3, Name: "z", Secret: "s"})
+	if err != nil {
+		t.Fatalf("failed to write: %s", err.Error())
+	}
+	if len(parts) != 1 {
+		t.Fatalf("expected 1 part before close, got %d", len(parts))
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if parts[0][0]["time"] != int64(1400000000) || parts[0][0]["a"] != "x" || parts[0][1]["time"] != int64(1500000000) {
+		t.Fatalf("unexpected part: %v", parts[0])
+	}
+	record := parts[1][0]
+	if record["time"] != int64(1600000000) || record["user_id"] != int64(3) || record["name"] != "z" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+	if _, ok := record["Secret"]; ok {
+		t.Fatalf("unexpected record: %v", record)
+	}
+	if w.Write(map[string]interface{}{}) == nil {
+		t.Fatalf("expected an error after close")
+	}
+}
+
+func TestRecordWriterMaxSize(t *testing.T) {
+	client, err := NewTDClient(Settings{})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	parts := 0
+	w := client.NewRecordWriter(&RecordWriterOptions{MaxSize: 1}, func(part Blob, records int) error {
+		parts++
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		err = w.Write(map[string]interface{}{"time": i})
+		if err != nil {
+			t.Fatalf("failed to write: %s", err.Error())
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	if parts != 3 {
+		t.Fatalf("expected 3 parts, got %d", parts)
+	}
+}
+
+func TestRecordWriterInvalidTime(t *testing.T) {
+	client, err := NewTDClient(Settings{})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	w := client.NewRecordWriter(nil, func(part Blob, records int) error {
+		return nil
+	})
+	for _, v := range []interface{}{"2014-01-01", -1, 1.5} {
+		if w.Write(map[string]interface{}{"time": v}) == nil {
+			t.Fatalf("expected an error for %v", v)
+		}
+	}
+	if w.Write(42) == nil {
+		t.Fatalf("expected an error for a non-record")
+	}
+}
+
+func TestRecordWriterEncodeFailure(t *testing.T) {
+	client, err := NewTDClient(Settings{})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	parts := [][]map[string]interface{}{}
+	w := client.NewRecordWriter(nil, func(part Blob, records int) error {
+		parts = append(parts, readRecordPart(t, part))
+		return nil
+	})
+	if w.Write(map[string]interface{}{"time": 1, "a": "x", "b": complex(1, 2)}) == nil {
+		t.Fatal("expected an error for the unencodable value")
+	}
+	err = w.Write(map[string]interface{}{"time": 2, "a": "y"})
+	if err != nil {
+		t.Fatalf("failed to write: %s", err.Error())
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	if len(parts) != 1 || len(parts[0]) != 1 || parts[0][0]["a"] != "y" {
+		t.Fatalf("unexpected parts: %v", parts)
+	}
+}
+
+func TestRecordWriterFlushFailure(t *testing.T) {
+	client, err := NewTDClient(Settings{})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	failures := 1
+	records := []int{}
+	w := client.NewRecordWriter(&RecordWriterOptions{MaxRecords: 2}, func(part Blob, n int) error {
+		if failures > 0 {
+			failures--
+			return errors.New("failure")
+		}
+		records = append(records, len(readRecordPart(t, part)))
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		err = w.Write(map[string]interface{}{"time": i})
+		if i == 1 && err == nil {
+			t.Fatal("expected the flush to fail")
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	if len(records) != 2 || records[0] != 2 || records[1] != 1 {
+		t.Fatalf("unexpected parts: %v", records)
+	}
+}
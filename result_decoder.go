@@ -0,0 +1,455 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultColumn describes a column of a job result as given in `hive_result_schema`.
+type ResultColumn struct {
+	Name string
+	Type string // Column type in lower case, such as "bigint", "varchar" or "array<varchar>".
+}
+
+// ParseResultSchema converts ShowJobResult.HiveResultSchema into the list of columns.
+func ParseResultSchema(hiveResultSchema []interface{}) ([]ResultColumn, error) {
+	retval := make([]ResultColumn, len(hiveResultSchema))
+	for i, c := range hiveResultSchema {
+		pair, ok := c.([]interface{})
+		if !ok || len(pair) < 2 {
+			return nil, fmt.Errorf("invalid column definition at %d: %v", i, c)
+		}
+		name, ok := pair[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid column name at %d: %v", i, pair[0])
+		}
+		type_, ok := pair[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid column type at %d: %v", i, pair[1])
+		}
+		retval[i] = ResultColumn{Name: name, Type: strings.ToLower(type_)}
+	}
+	return retval, nil
+}
+
+// BaseType strips the type parameters, e.g. "varchar(10)" to "varchar" and "array<bigint>" to "array".
+func (c ResultColumn) BaseType() string {
+	if i := strings.IndexAny(c.Type, "(<"); i >= 0 {
+		return strings.TrimSpace(c.Type[:i])
+	}
+	return c.Type
+}
+
+// ResultDecoder maps the rows of a job result into structs.
+//
+// Struct fields are matched with the columns by the `td` tag, e.g. `td:"user_id"`, or by the field name compared case-insensitively when the tag is absent.
+// Fields tagged with `td:"-"` are ignored, and so are the columns without the corresponding field.
+// NULL is decoded to the zero value, or to nil if the field is a pointer.
+//
+// A ResultDecoder is not safe for concurrent use.
+type ResultDecoder struct {
+	Columns  []ResultColumn
+	mappings map[reflect.Type][]int
+}
+
+// NewResultDecoder creates a ResultDecoder for the result described by ShowJobResult.HiveResultSchema.
+func NewResultDecoder(hiveResultSchema []interface{}) (*ResultDecoder, error) {
+	columns, err := ParseResultSchema(hiveResultSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultDecoder{
+		Columns:  columns,
+		mappings: map[reflect.Type][]int{},
+	}, nil
+}
+
+// mapping returns the index of the field for each column, -1 meaning the column is not mapped.
+func (d *ResultDecoder) mapping(type_ reflect.Type) ([]int, error) {
+	if m, ok := d.mappings[type_]; ok {
+		return m, nil
+	}
+	columnIndex := make(map[string]int, len(d.Columns))
+	for i, c := range d.Columns {
+		columnIndex[c.Name] = i
+	}
+	m := make([]int, len(d.Columns))
+	for i := range m {
+		m[i] = -1
+	}
+	for i := 0; i < type_.NumField(); i++ {
+		f := type_.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, tagged := f.Tag.Lookup("td")
+		if name == "-" {
+			continue
+		}
+		ci, ok := -1, false
+		if tagged {
+			ci, ok = columnIndex[name]
+			if !ok {
+				return nil, fmt.Errorf("no column named %s for field %s", name, f.Name)
+			}
+		} else {
+			for j, c := range d.Columns {
+				if strings.EqualFold(c.Name, f.Name) {
+					ci, ok = j, true
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		m[ci] = i
+	}
+	d.mappings[type_] = m
+	return m, nil
+}
+
+// Decode stores the row, as passed to the reader of JobResultEach, into the struct pointed to by dest.
+func (d *ResultDecoder) Decode(row interface{}, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("destination must be a non-nil pointer to a struct")
+	}
+	rv = rv.Elem()
+	cells, ok := row.([]interface{})
+	if !ok {
+		return fmt.Errorf("row is not an array: %T", row)
+	}
+	if len(cells) != len(d.Columns) {
+		return fmt.Errorf("row has %d columns while the schema has %d", len(cells), len(d.Columns))
+	}
+	m, err := d.mapping(rv.Type())
+	if err != nil {
+		return err
+	}
+	for i, fi := range m {
+		if fi < 0 {
+			continue
+		}
+		err := convertResultValue(d.Columns[i], cells[i], rv.Field(fi))
+		if err != nil {
+			return fmt.Errorf("column %s (%s): %s", d.Columns[i].Name, d.Columns[i].Type, err.Error())
+		}
+	}
+	return nil
+}
+
+// Value converts the cell of the specified column into the natural Go representation:
+// int64, float64, bool, string, []byte for binary columns, []interface{} and map[string]interface{}.
+func (d *ResultDecoder) Value(column int, cell interface{}) interface{} {
+	return normalizeResultValue(d.Columns[column], cell)
+}
+
+func normalizeResultValue(c ResultColumn, v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		switch c.BaseType() {
+		case "varbinary", "binary":
+			return v
+		}
+		return string(v)
+	case []interface{}:
+		retval := make([]interface{}, len(v))
+		for i, e := range v {
+			retval[i] = normalizeResultValue(ResultColumn{}, e)
+		}
+		return retval
+	case map[interface{}]interface{}:
+		retval := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			retval[fmt.Sprint(normalizeResultValue(ResultColumn{}, k))] = normalizeResultValue(ResultColumn{}, e)
+		}
+		return retval
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+	}
+	return v
+}
+
+var resultTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999 MST",
+	"2006-01-02 15:04:05.999999999 -0700",
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+// ParseResultTime parses a time string as returned by Hive and Presto, e.g. "2020-01-01 00:00:00.000" or
+// "2020-01-01 00:00:00.000 Asia/Tokyo", into a time in UTC.  A time without a zone is taken as UTC.
+func ParseResultTime(s string) (time.Time, error) {
+	for _, layout := range resultTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	// Presto appends the zone name, e.g. "2020-01-01 00:00:00.000 Asia/Tokyo".
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		if loc, err := time.LoadLocation(s[i+1:]); err == nil {
+			t, err := time.ParseInLocation(resultTimeLayouts[0], s[:i], loc)
+			if err == nil {
+				return t.UTC(), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time string %s", s)
+}
+
+func convertResultValue(c ResultColumn, v interface{}, dest reflect.Value) error {
+	if b, ok := v.([]byte); ok && dest.Kind() != reflect.Interface && !(dest.Kind() == reflect.Slice && dest.Type().Elem().Kind() == reflect.Uint8) {
+		v = string(b)
+	}
+	if v == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+	switch dest.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(dest.Type().Elem())
+		err := convertResultValue(c, v, p.Elem())
+		if err != nil {
+			return err
+		}
+		dest.Set(p)
+		return nil
+	case reflect.Interface:
+		nv := normalizeResultValue(c, v)
+		if s, ok := nv.(string); ok && (c.BaseType() == "array" || c.BaseType() == "map") {
+			// Hive returns complex types as JSON strings.
+			var js interface{}
+			if json.Unmarshal([]byte(s), &js) == nil {
+				nv = js
+			}
+		}
+		if !reflect.TypeOf(nv).AssignableTo(dest.Type()) {
+			return fmt.Errorf("cannot assign %T to %s", nv, dest.Type().String())
+		}
+		dest.Set(reflect.ValueOf(nv))
+		return nil
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			dest.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		switch v := v.(type) {
+		case bool:
+			dest.SetBool(v)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			dest.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch v := v.(type) {
+		case int64:
+			i = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return fmt.Errorf("%d overflows %s", v, dest.Type().String())
+			}
+			i = int64(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return fmt.Errorf("%g is not an integer", v)
+			}
+			i = int64(v)
+		case string:
+			var err error
+			i, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot convert %T to %s", v, dest.Type().String())
+		}
+		if dest.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, dest.Type().String())
+		}
+		dest.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch v := v.(type) {
+		case int64:
+			if v < 0 {
+				return fmt.Errorf("%d overflows %s", v, dest.Type().String())
+			}
+			u = uint64(v)
+		case uint64:
+			u = v
+		case string:
+			var err error
+			u, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot convert %T to %s", v, dest.Type().String())
+		}
+		if dest.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, dest.Type().String())
+		}
+		dest.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch v := v.(type) {
+		case float64:
+			dest.SetFloat(v)
+			return nil
+		case float32:
+			dest.SetFloat(float64(v))
+			return nil
+		case int64:
+			dest.SetFloat(float64(v))
+			return nil
+		case uint64:
+			dest.SetFloat(float64(v))
+			return nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+			dest.SetFloat(f)
+			return nil
+		}
+	case reflect.Struct:
+		if dest.Type() != timeType {
+			return fmt.Errorf("unsupported field type %s", dest.Type().String())
+		}
+		switch v := v.(type) {
+		case string:
+			t, err := ParseResultTime(v)
+			if err != nil {
+				return err
+			}
+			dest.Set(reflect.ValueOf(t))
+			return nil
+		case int64:
+			dest.Set(reflect.ValueOf(time.Unix(v, 0).UTC()))
+			return nil
+		case uint64:
+			dest.Set(reflect.ValueOf(time.Unix(int64(v), 0).UTC()))
+			return nil
+		case float64:
+			sec, frac := math.Modf(v)
+			dest.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*1e9)).UTC()))
+			return nil
+		}
+	case reflect.Slice:
+		switch v := v.(type) {
+		case []byte:
+			if dest.Type().Elem().Kind() == reflect.Uint8 {
+				dest.SetBytes(append([]byte(nil), v...))
+				return nil
+			}
+		case string:
+			if dest.Type().Elem().Kind() == reflect.Uint8 {
+				dest.SetBytes([]byte(v))
+				return nil
+			}
+			return json.Unmarshal([]byte(v), dest.Addr().Interface())
+		case []interface{}:
+			rv := reflect.MakeSlice(dest.Type(), len(v), len(v))
+			for i, e := range v {
+				err := convertResultValue(ResultColumn{}, e, rv.Index(i))
+				if err != nil {
+					return fmt.Errorf("[%d]: %s", i, err.Error())
+				}
+			}
+			dest.Set(rv)
+			return nil
+		}
+	case reflect.Map:
+		switch v := v.(type) {
+		case string:
+			return json.Unmarshal([]byte(v), dest.Addr().Interface())
+		case map[interface{}]interface{}:
+			rv := reflect.MakeMapWithSize(dest.Type(), len(v))
+			for k, e := range v {
+				rk := reflect.New(dest.Type().Key()).Elem()
+				err := convertResultValue(ResultColumn{}, k, rk)
+				if err != nil {
+					return fmt.Errorf("key %v: %s", k, err.Error())
+				}
+				re := reflect.New(dest.Type().Elem()).Elem()
+				err = convertResultValue(ResultColumn{}, e, re)
+				if err != nil {
+					return fmt.Errorf("[%v]: %s", k, err.Error())
+				}
+				rv.SetMapIndex(rk, re)
+			}
+			dest.Set(rv)
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported field type %s", dest.Type().String())
+	}
+	return fmt.Errorf("cannot convert %T to %s", v, dest.Type().String())
+}
+
+// JobResultScan decodes each row of the job result into the struct pointed to by dest and calls fn.
+// The columns are taken from the `hive_result_schema` of the job; see ResultDecoder for how they are mapped.
+func (client *TDClient) JobResultScan(jobId string, dest interface{}, fn func() error) error {
+	return client.JobResultScanContext(context.Background(), jobId, dest, fn)
+}
+
+func (client *TDClient) JobResultScanContext(ctx context.Context, jobId string, dest interface{}, fn func() error) error {
+	job, err := client.ShowJobContext(ctx, jobId)
+	if err != nil {
+		return err
+	}
+	decoder, err := NewResultDecoder(job.HiveResultSchema)
+	if err != nil {
+		return &APIError{
+			Type:    InvalidResponseError,
+			Message: "Invalid result schema",
+			Cause:   err,
+		}
+	}
+	return client.JobResultEachContext(ctx, jobId, func(row interface{}) error {
+		err := decoder.Decode(row, dest)
+		if err != nil {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,173 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type testResultRow struct {
+	ID      int64             `td:"id"`
+	Name    string            `td:"name"`
+	Score   *float64          `td:"score"`
+	Tags    []string          `td:"tags"`
+	Attrs   map[string]int    `td:"attrs"`
+	Time    time.Time         `td:"time"`
+	Created time.Time         `td:"created_at"`
+	Active  bool              // matched by the field name
+	Extra   map[string]string `td:"-"`
+}
+
+var testResultSchema = []interface{}{
+	[]interface{}{"id", "bigint"},
+	[]interface{}{"name", "varchar"},
+	[]interface{}{"score", "double"},
+	[]interface{}{"tags", "array(varchar)"},
+	[]interface{}{"attrs", "map(varchar,bigint)"},
+	[]interface{}{"time", "bigint"},
+	[]interface{}{"created_at", "timestamp"},
+	[]interface{}{"ACTIVE", "boolean"},
+	[]interface{}{"ignored", "varchar"},
+}
+
+// decodeMessagePack round-trips the value so the cells have the types the codec yields.
+func decodeMessagePack(t *testing.T, v interface{}) interface{} {
+	b := bytes.Buffer{}
+	err := codec.NewEncoder(&b, &codec.MsgpackHandle{}).Encode(v)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	retval := (interface{})(nil)
+	err = codec.NewDecoder(&b, &codec.MsgpackHandle{}).Decode(&retval)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return retval
+}
+
+func TestResultDecoder(t *testing.T) {
+	decoder, err := NewResultDecoder(testResultSchema)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	row := decodeMessagePack(t, []interface{}{
+		int64(1), "alice", nil, []interface{}{"a", "b"}, map[string]interface{}{"x": 1},
+		int64(1420070400), "2015-01-01 00:00:00.123", true, "x",
+	})
+	result := testResultRow{}
+	err = decoder.Decode(row, &result)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := testResultRow{
+		ID:      1,
+		Name:    "alice",
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]int{"x": 1},
+		Time:    time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+		Created: time.Date(2015, 1, 1, 0, 0, 0, 123000000, time.UTC),
+		Active:  true,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestResultDecoderMismatch(t *testing.T) {
+	decoder, err := NewResultDecoder(testResultSchema)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	row := decodeMessagePack(t, []interface{}{
+		"one", "alice", 1.5, nil, nil, nil, nil, nil, nil,
+	})
+	err = decoder.Decode(row, &testResultRow{})
+	if err == nil || err.Error() != "column id (bigint): strconv.ParseInt: parsing \"one\": invalid syntax" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = decoder.Decode(decodeMessagePack(t, []interface{}{1}), &testResultRow{})
+	if err == nil {
+		t.Fatal("expected an error for the wrong number of columns")
+	}
+	missing := struct {
+		Foo string `td:"foo"`
+	}{}
+	err = decoder.Decode(row, &missing)
+	if err == nil {
+		t.Fatal("expected an error for the missing column")
+	}
+}
+
+func TestParseResultTime(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skip(err.Error())
+	}
+	expected := time.Date(2019, 12, 31, 15, 0, 0, 0, time.UTC)
+	for _, s := range []string{
+		"2019-12-31 15:00:00",
+		"2019-12-31 15:00:00.000 UTC",
+		"2020-01-01 00:00:00.000 +0900",
+		"2020-01-01T00:00:00+09:00",
+		"2020-01-01 00:00:00.000 Asia/Tokyo",
+	} {
+		parsed, err := ParseResultTime(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err.Error())
+		} else if !parsed.Equal(expected) || parsed.Location() != time.UTC {
+			t.Errorf("%s: unexpected time %s", s, parsed)
+		}
+	}
+	if _, err := ParseResultTime("2020-01-01 00:00:00.000 Nowhere/City"); err == nil {
+		t.Fatal("expected an error for the unknown zone")
+	}
+}
+
+func TestJobResultScan(t *testing.T) {
+	result := bytes.Buffer{}
+	enc := codec.NewEncoder(&result, &codec.MsgpackHandle{})
+	enc.Encode([]interface{}{1})
+	enc.Encode([]interface{}{2})
+	transport := &SequenceTransport{Responses: [][]byte{
+		showJobResponse("success", ""),
+		result.Bytes(),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	row := struct {
+		Count int `td:"_col0"`
+	}{}
+	sum := 0
+	err = client.JobResultScan("9999999", &row, func() error {
+		sum += row.Count
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if sum != 3 {
+		t.Fatalf("unexpected sum: %d", sum)
+	}
+}
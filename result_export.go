@@ -0,0 +1,343 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is the format ResultExporter writes the rows in.
+type ExportFormat string
+
+const (
+	ExportCSV       ExportFormat = "csv"   // RFC 4180 CSV with a header row.
+	ExportTSV       ExportFormat = "tsv"   // Tab-separated values with a header row; tabs, newlines and backslashes are escaped with a backslash.
+	ExportJSONLines ExportFormat = "jsonl" // A JSON object per line keyed by the column names.
+)
+
+// ResultExporter writes the rows of a job result, as passed to the reader of JobResultEach, to an io.Writer.
+//
+// The cells are rendered the same way in every format: NULL becomes an empty field in CSV and TSV and null in JSON Lines,
+// binary values are encoded in base64, and arrays and maps are written as JSON text in CSV and TSV, or nested in JSON Lines.
+// Floating point values that JSON cannot represent are written as "NaN", "Infinity" and "-Infinity".
+//
+// A ResultExporter is not safe for concurrent use.
+type ResultExporter struct {
+	format  ExportFormat
+	decoder *ResultDecoder
+	w       *bufio.Writer
+	csv     *csv.Writer
+	buf     bytes.Buffer
+	json    *json.Encoder
+	fields  []string
+	header  bool
+}
+
+// NewResultExporter creates a ResultExporter writing to w the result described by ShowJobResult.HiveResultSchema.
+func NewResultExporter(w io.Writer, format ExportFormat, hiveResultSchema []interface{}) (*ResultExporter, error) {
+	decoder, err := NewResultDecoder(hiveResultSchema)
+	if err != nil {
+		return nil, err
+	}
+	e := &ResultExporter{
+		format:  format,
+		decoder: decoder,
+		w:       bufio.NewWriter(w),
+		fields:  make([]string, len(decoder.Columns)),
+	}
+	switch format {
+	case ExportCSV:
+		e.csv = csv.NewWriter(e.w)
+	case ExportTSV, ExportJSONLines:
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	e.json = json.NewEncoder(&e.buf)
+	e.json.SetEscapeHTML(false)
+	return e, nil
+}
+
+// WriteRow writes the row, preceded by the header row for CSV and TSV.
+func (e *ResultExporter) WriteRow(row interface{}) error {
+	cells, ok := row.([]interface{})
+	if !ok {
+		return fmt.Errorf("row is not an array: %T", row)
+	}
+	if len(cells) != len(e.decoder.Columns) {
+		return fmt.Errorf("row has %d columns while the schema has %d", len(cells), len(e.decoder.Columns))
+	}
+	err := e.writeHeader()
+	if err != nil {
+		return err
+	}
+	switch e.format {
+	case ExportCSV:
+		for i, cell := range cells {
+			e.fields[i], err = e.text(i, cell)
+			if err != nil {
+				return err
+			}
+		}
+		return e.csv.Write(e.fields)
+	case ExportTSV:
+		for i, cell := range cells {
+			e.fields[i], err = e.text(i, cell)
+			if err != nil {
+				return err
+			}
+			e.fields[i] = escapeTSV(e.fields[i])
+		}
+		return e.writeTSV(e.fields)
+	default:
+		return e.writeJSONLine(cells)
+	}
+}
+
+func (e *ResultExporter) writeHeader() error {
+	if e.header || e.format == ExportJSONLines {
+		return nil
+	}
+	e.header = true
+	for i, c := range e.decoder.Columns {
+		e.fields[i] = c.Name
+	}
+	if e.format == ExportCSV {
+		return e.csv.Write(e.fields)
+	}
+	for i := range e.fields {
+		e.fields[i] = escapeTSV(e.fields[i])
+	}
+	return e.writeTSV(e.fields)
+}
+
+// Flush writes the header row if no row has been written, and flushes the buffered output.
+func (e *ResultExporter) Flush() error {
+	err := e.writeHeader()
+	if err != nil {
+		return err
+	}
+	if e.csv != nil {
+		e.csv.Flush()
+		err = e.csv.Error()
+		if err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
+
+// value converts the cell into the value written out, parsing the JSON text Hive returns for complex types.
+func (e *ResultExporter) value(column int, cell interface{}) interface{} {
+	v := e.decoder.Value(column, cell)
+	if s, ok := v.(string); ok {
+		switch e.decoder.Columns[column].BaseType() {
+		case "array", "map", "row", "struct":
+			var js interface{}
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			if dec.Decode(&js) == nil {
+				return js
+			}
+		}
+	}
+	return exportValue(v)
+}
+
+// exportValue replaces the values JSON cannot represent, recursing into arrays and maps.
+func exportValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return formatFloat(v)
+		}
+	case float32:
+		return exportValue(float64(v))
+	case []interface{}:
+		for i, e := range v {
+			v[i] = exportValue(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = exportValue(e)
+		}
+	}
+	return v
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// text renders the cell as a CSV or TSV field.
+func (e *ResultExporter) text(column int, cell interface{}) (string, error) {
+	switch v := e.value(column, cell).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return formatFloat(v), nil
+	default:
+		b, err := e.marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
+
+// marshal encodes the value into JSON without the trailing newline.
+func (e *ResultExporter) marshal(v interface{}) ([]byte, error) {
+	e.buf.Reset()
+	err := e.json.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")), nil
+}
+
+func (e *ResultExporter) writeJSONLine(cells []interface{}) error {
+	e.w.WriteByte('{')
+	for i, cell := range cells {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		name, err := e.marshal(e.decoder.Columns[i].Name)
+		if err != nil {
+			return err
+		}
+		e.w.Write(name)
+		e.w.WriteByte(':')
+		value, err := e.marshal(e.value(i, cell))
+		if err != nil {
+			return err
+		}
+		e.w.Write(value)
+	}
+	e.w.WriteByte('}')
+	return e.w.WriteByte('\n')
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func escapeTSV(s string) string {
+	return tsvEscaper.Replace(s)
+}
+
+func (e *ResultExporter) writeTSV(fields []string) error {
+	_, err := e.w.WriteString(strings.Join(fields, "\t"))
+	if err != nil {
+		return err
+	}
+	return e.w.WriteByte('\n')
+}
+
+// ExportJobResult writes the result of the job to w in the format, with the column names taken from the job.
+func (client *TDClient) ExportJobResult(jobId string, format ExportFormat, w io.Writer) error {
+	return client.ExportJobResultContext(context.Background(), jobId, format, w)
+}
+
+func (client *TDClient) ExportJobResultContext(ctx context.Context, jobId string, format ExportFormat, w io.Writer) error {
+	job, err := client.ShowJobContext(ctx, jobId)
+	if err != nil {
+		return err
+	}
+	exporter, err := NewResultExporter(w, format, job.HiveResultSchema)
+	if err != nil {
+		return err
+	}
+	err = client.JobResultEachContext(ctx, jobId, exporter.WriteRow)
+	if err != nil {
+		return err
+	}
+	return exporter.Flush()
+}
+
+// ExportJobResultFile writes the result of the job to the gzip-compressed file at path through WriteGzipFile.
+func (client *TDClient) ExportJobResultFile(jobId string, format ExportFormat, path string) error {
+	return client.ExportJobResultFileContext(context.Background(), jobId, format, path)
+}
+
+func (client *TDClient) ExportJobResultFileContext(ctx context.Context, jobId string, format ExportFormat, path string) error {
+	return WriteGzipFile(path, func(w io.Writer) error {
+		return client.ExportJobResultContext(ctx, jobId, format, w)
+	})
+}
+
+// WriteGzipFile compresses the output of write into the file at path.  The output goes to a temporary file
+// in the same directory, which is renamed to path once complete, so the file never appears half-written
+// and an existing file is left intact if write fails.
+func WriteGzipFile(path string, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = write(gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
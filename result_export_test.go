@@ -0,0 +1,175 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+var testExportSchema = []interface{}{
+	[]interface{}{"id", "bigint"},
+	[]interface{}{"name", "varchar"},
+	[]interface{}{"score", "double"},
+	[]interface{}{"tags", "array<varchar>"},
+	[]interface{}{"attrs", "map<varchar,bigint>"},
+	[]interface{}{"raw", "varbinary"},
+}
+
+var testExportRows = []interface{}{
+	[]interface{}{1, "alice, \"a\"\tb\nc", 1.5, []interface{}{"x", "y"}, map[string]interface{}{"k": 1}, []byte{0xff, 0x00}},
+	[]interface{}{2, nil, math.NaN(), `["<z>"]`, `{"n":12345678901234567890}`, nil},
+}
+
+func exportRows(t *testing.T, format ExportFormat) string {
+	b := bytes.Buffer{}
+	exporter, err := NewResultExporter(&b, format, testExportSchema)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, row := range testExportRows {
+		err := exporter.WriteRow(decodeMessagePack(t, row))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	err = exporter.Flush()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return b.String()
+}
+
+func TestResultExporter(t *testing.T) {
+	expected := map[ExportFormat]string{
+		ExportCSV: "id,name,score,tags,attrs,raw\n" +
+			"1,\"alice, \"\"a\"\"\tb\nc\",1.5,\"[\"\"x\"\",\"\"y\"\"]\",\"{\"\"k\"\":1}\",/wA=\n" +
+			"2,,NaN,\"[\"\"<z>\"\"]\",\"{\"\"n\"\":12345678901234567890}\",\n",
+		ExportTSV: "id\tname\tscore\ttags\tattrs\traw\n" +
+			"1\talice, \"a\"\\tb\\nc\t1.5\t[\"x\",\"y\"]\t{\"k\":1}\t/wA=\n" +
+			"2\t\tNaN\t[\"<z>\"]\t{\"n\":12345678901234567890}\t\n",
+		ExportJSONLines: `{"id":1,"name":"alice, \"a\"\tb\nc","score":1.5,"tags":["x","y"],"attrs":{"k":1},"raw":"/wA="}` + "\n" +
+			`{"id":2,"name":null,"score":"NaN","tags":["<z>"],"attrs":{"n":12345678901234567890},"raw":null}` + "\n",
+	}
+	for format, e := range expected {
+		if s := exportRows(t, format); s != e {
+			t.Errorf("%s: unexpected output:\n%s", format, s)
+		}
+	}
+	_, err := NewResultExporter(ioutil.Discard, "xml", testExportSchema)
+	if err == nil {
+		t.Fatal("expected error for the unsupported format")
+	}
+}
+
+func TestResultExporterEmpty(t *testing.T) {
+	b := bytes.Buffer{}
+	exporter, err := NewResultExporter(&b, ExportTSV, testExportSchema[:2])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = exporter.Flush()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if b.String() != "id\tname\n" {
+		t.Fatalf("unexpected output: %q", b.String())
+	}
+	if exporter.WriteRow([]interface{}{1}) == nil {
+		t.Fatal("expected an error for the wrong number of columns")
+	}
+}
+
+func TestExportJobResultFile(t *testing.T) {
+	result := bytes.Buffer{}
+	enc := codec.NewEncoder(&result, &codec.MsgpackHandle{})
+	enc.Encode([]interface{}{1})
+	enc.Encode([]interface{}{2})
+	transport := &SequenceTransport{Responses: [][]byte{
+		showJobResponse("success", ""),
+		result.Bytes(),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "result.csv.gz")
+	err = client.ExportJobResultFile("9999999", ExportCSV, path)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	content := readGzipFile(t, path)
+	if content != "_col0\n1\n2\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return string(content)
+}
+
+func TestWriteGzipFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.gz")
+	err := WriteGzipFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "original")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	failure := errors.New("failure")
+	err = WriteGzipFile(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("expected the failure, got %v", err)
+	}
+	if content := readGzipFile(t, path); content != "original" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(files) != 1 {
+		t.Fatalf("temporary file left behind: %d files", len(files))
+	}
+}
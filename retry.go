@@ -0,0 +1,219 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how requests that failed for transient reasons are retried.
+//
+// A request is retried only if it is safe to replay: GET requests always are, while
+// PUT and POST requests are replayed only by the API calls that are known to be
+// idempotent, that is Import with a unique id, UploadBulkImportPart and SubmitQuery
+// with a DomainKey.  The request body is re-read through Blob.Reader() on every attempt.
+//
+// Zero values of the fields fall back to the corresponding value of DefaultRetryPolicy.
+type RetryPolicy struct {
+	MaxAttempts int           // Maximum number of attempts including the first one.
+	BaseBackoff time.Duration // Wait before the first retry. Doubled on every subsequent retry.
+	MaxBackoff  time.Duration // Upper bound of the wait computed from BaseBackoff.
+	Jitter      float64       // Fraction (0 to 1) of the wait that is randomized. Negative value disables jitter.
+	StatusCodes []int         // HTTP status codes that are considered transient.
+	Methods     []string      // HTTP methods eligible for retry.
+}
+
+// DefaultRetryPolicy is the policy used to fill in the fields left unspecified in Settings.Retry.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseBackoff: 500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.5,
+	StatusCodes: []int{429, 500, 502, 503, 504},
+	Methods:     []string{"GET", "PUT", "POST"},
+}
+
+func (policy *RetryPolicy) maxAttempts() int {
+	if policy.MaxAttempts == 0 {
+		return DefaultRetryPolicy.MaxAttempts
+	}
+	return policy.MaxAttempts
+}
+
+func (policy *RetryPolicy) allowsMethod(method string) bool {
+	methods := policy.Methods
+	if methods == nil {
+		methods = DefaultRetryPolicy.Methods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *RetryPolicy) transientStatus(statusCode int) bool {
+	statusCodes := policy.StatusCodes
+	if statusCodes == nil {
+		statusCodes = DefaultRetryPolicy.StatusCodes
+	}
+	for _, c := range statusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry tells whether the outcome of an attempt is worth another try.
+func (policy *RetryPolicy) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return isTransientError(err)
+	}
+	return policy.transientStatus(resp.StatusCode)
+}
+
+// backoff returns the time to wait before the next attempt; attempt is the 1-origin number of the attempt that has just failed.
+func (policy *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	base := policy.BaseBackoff
+	if base == 0 {
+		base = DefaultRetryPolicy.BaseBackoff
+	}
+	max := policy.MaxBackoff
+	if max == 0 {
+		max = DefaultRetryPolicy.MaxBackoff
+	}
+	jitter := policy.Jitter
+	if jitter == 0 {
+		jitter = DefaultRetryPolicy.Jitter
+	} else if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	wait := base
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	wait -= time.Duration(jitter * rand.Float64() * float64(wait))
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && retryAfter > wait {
+			wait = retryAfter
+		}
+	}
+	return wait
+}
+
+// parseRetryAfter parses the value of Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// isTransientError tells whether the error returned by the transport may go away by retrying.
+// Only the failures known to be transient are retried: timeouts, connections refused, reset or dropped partway,
+// and temporary DNS failures.  Certificate verification failures, cancellation and any other error are not.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certificateInvalidErr) {
+		return false
+	}
+	// *url.Error implements net.Error whatever it wraps, so only its cause is looked at.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// transientErrors are the causes of the transport errors retried by isTransientError.
+var transientErrors = []error{
+	io.EOF,
+	io.ErrUnexpectedEOF,
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EPIPE,
+	syscall.ETIMEDOUT,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
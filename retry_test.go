@@ -0,0 +1,205 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// FlakyTransport fails with the given status codes (0 meaning a connection error) before returning ResponseBytes.
+type FlakyTransport struct {
+	Failures      []int
+	ResponseBytes []byte
+	Bodies        []string
+}
+
+func (t *FlakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		t.Bodies = append(t.Bodies, string(body))
+	} else {
+		t.Bodies = append(t.Bodies, "")
+	}
+	statusCode := 200
+	body := t.ResponseBytes
+	if len(t.Failures) > 0 {
+		statusCode = t.Failures[0]
+		t.Failures = t.Failures[1:]
+		if statusCode == 0 {
+			return nil, syscall.ECONNRESET
+		}
+		body = []byte(`{"error":"unavailable"}`)
+	}
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts: 3,
+	BaseBackoff: time.Millisecond,
+	MaxBackoff:  time.Millisecond,
+}
+
+func TestRetryGet(t *testing.T) {
+	transport := &FlakyTransport{Failures: []int{503, 0}, ResponseBytes: []byte(`{"status":"ok"}`)}
+	client, err := NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	status, err := client.ServerStatus()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if status.Status != "ok" {
+		t.Fatalf("unexpected status: %s", status.Status)
+	}
+	if len(transport.Bodies) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(transport.Bodies))
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	transport := &FlakyTransport{Failures: []int{503, 503, 503}, ResponseBytes: []byte(`{"status":"ok"}`)}
+	client, err := NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(transport.Bodies) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(transport.Bodies))
+	}
+}
+
+func TestRetryImport(t *testing.T) {
+	blob := InMemoryBlob("payload")
+	response := []byte(`{"unique_id":"uid","database":"db","table":"tbl","md5_hex":"","elapsed_time":0.1}`)
+
+	transport := &FlakyTransport{Failures: []int{500}, ResponseBytes: response}
+	client, _ := NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	_, err := client.Import("db", "tbl", "msgpack.gz", blob, "uid")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(transport.Bodies) != 2 || transport.Bodies[1] != "payload" {
+		t.Fatalf("expected the blob to be sent again, got %v", transport.Bodies)
+	}
+
+	transport = &FlakyTransport{Failures: []int{500}, ResponseBytes: response}
+	client, _ = NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	_, err = client.Import("db", "tbl", "msgpack.gz", blob, "")
+	if err == nil {
+		t.Fatal("import without unique id must not be retried")
+	}
+	if len(transport.Bodies) != 1 {
+		t.Fatalf("expected 1 attempt, got %d", len(transport.Bodies))
+	}
+}
+
+func TestRetrySubmitQuery(t *testing.T) {
+	response := []byte(`{"job":"9999999","job_id":"9999999","database":"sample_datasets"}`)
+
+	transport := &FlakyTransport{Failures: []int{502}, ResponseBytes: response}
+	client, _ := NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	_, err := client.SubmitQuery("sample_datasets", Query{Type: "presto", Query: "SELECT 1"})
+	if err == nil {
+		t.Fatal("query without domain key must not be retried")
+	}
+
+	transport = &FlakyTransport{Failures: []int{502}, ResponseBytes: response}
+	client, _ = NewTDClient(Settings{Transport: transport, Retry: testRetryPolicy})
+	_, err = client.SubmitQuery("sample_datasets", Query{Type: "presto", Query: "SELECT 1", DomainKey: "key"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(transport.Bodies) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(transport.Bodies))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: -1}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if d := policy.backoff(i+1, nil); d != e {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, e, d)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": {"10"}}}
+	if d := policy.backoff(1, resp); d != 10*time.Second {
+		t.Errorf("expected Retry-After to be honored, got %s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	d, ok := parseRetryAfter("Wed, 21 Oct 2015 07:28:30 GMT", now)
+	if !ok || d != 30*time.Second {
+		t.Errorf("unexpected result: %s %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("expected failure")
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, err := range []error{
+		syscall.ECONNRESET,
+		io.ErrUnexpectedEOF,
+		&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: no route to host")},
+		&net.DNSError{Err: "server misbehaving", Name: "api.treasuredata.com", IsTemporary: true},
+		&url.Error{Op: "Get", URL: "https://api.treasuredata.com", Err: io.EOF},
+	} {
+		if !isTransientError(err) {
+			t.Errorf("expected %v to be transient", err)
+		}
+	}
+	for _, err := range []error{
+		errors.New("unsupported protocol scheme"),
+		context.Canceled,
+		&net.DNSError{Err: "no such host", Name: "api.treasuredata.com", IsNotFound: true},
+		&url.Error{Op: "Get", URL: "https://api.treasuredata.com", Err: x509.UnknownAuthorityError{}},
+		&url.Error{Op: "Get", URL: "ftp://api.treasuredata.com", Err: errors.New("unsupported protocol scheme")},
+	} {
+		if isTransientError(err) {
+			t.Errorf("expected %v not to be transient", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	spoolChunkSuffix    = ".chunk"
+	spoolMetadataSuffix = ".json"
+)
+
+// Spool is a directory holding the chunks that could not be imported, so that they can be sent later by Replay.
+//
+// Each chunk is stored in the file <unique id>.chunk, along with the metadata file <unique id>.json naming the database,
+// the table and the format.  The metadata file is written last, so a chunk is not visible until it is complete.
+type Spool struct {
+	Dir string
+}
+
+// SpoolEntry describes a chunk stored in a Spool.
+type SpoolEntry struct {
+	Database  string    `json:"database"`
+	Table     string    `json:"table"`
+	Format    string    `json:"format"`
+	UniqueId  string    `json:"unique_id"`
+	Records   int       `json:"records"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenSpool creates the directory if it does not exist and returns the Spool on it.
+func OpenSpool(dir string) (*Spool, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &Spool{Dir: dir}, nil
+}
+
+func (s *Spool) chunkPath(entry *SpoolEntry) string {
+	return filepath.Join(s.Dir, entry.UniqueId+spoolChunkSuffix)
+}
+
+func (s *Spool) metadataPath(entry *SpoolEntry) string {
+	return filepath.Join(s.Dir, entry.UniqueId+spoolMetadataSuffix)
+}
+
+// Write stores the batch in the spool.  A unique id is generated if the batch has none.
+func (s *Spool) Write(batch *LogBatch) error {
+	entry := &SpoolEntry{
+		Database:  batch.Database,
+		Table:     batch.Table,
+		Format:    batch.Format,
+		UniqueId:  batch.UniqueId,
+		Records:   batch.Records,
+		CreatedAt: time.Now().UTC(),
+	}
+	if entry.UniqueId == "" {
+		entry.UniqueId = newUniqueId()
+	}
+	if strings.ContainsAny(entry.UniqueId, `/\.`) {
+		return fmt.Errorf("invalid unique id for spool: %s", entry.UniqueId)
+	}
+	r, err := batch.Blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	err = s.writeFile(s.chunkPath(entry), r)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(s.metadataPath(entry), bytes.NewReader(metadata))
+}
+
+// writeFile writes the file through a temporary file so that it never appears half-written.
+func (s *Spool) writeFile(path string, r io.Reader) error {
+	f, err := ioutil.TempFile(s.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Entries lists the chunks in the spool, oldest first.
+func (s *Spool) Entries() ([]*SpoolEntry, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*SpoolEntry{}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), spoolMetadataSuffix) || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(s.Dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entry := &SpoolEntry{}
+		err = json.Unmarshal(b, entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spool metadata %s: %s", file.Name(), err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// Blob returns the content of the chunk, which is read from the file on demand rather than held in memory.
+func (s *Spool) Blob(entry *SpoolEntry) (Blob, error) {
+	path := s.chunkPath(entry)
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileBlob(path), nil
+}
+
+// Remove deletes the chunk from the spool.
+func (s *Spool) Remove(entry *SpoolEntry) error {
+	err := os.Remove(s.metadataPath(entry))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(s.chunkPath(entry))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Replay imports the spooled chunks with their original unique ids and removes the ones that have been imported.
+// The server discards a chunk that has already been imported with the same unique id, so a chunk is never loaded twice
+// even if it was actually received before the failure.  Replay stops at the first failure and returns the number of
+// chunks imported so far.
+func (s *Spool) Replay(ctx context.Context, client *TDClient) (int, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		blob, err := s.Blob(entry)
+		if err != nil {
+			return i, err
+		}
+		_, err = client.ImportContext(ctx, entry.Database, entry.Table, entry.Format, blob, entry.UniqueId)
+		if err != nil {
+			return i, err
+		}
+		err = s.Remove(entry)
+		if err != nil {
+			return i + 1, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,141 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSpoolReplay(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open spool: %s", err.Error())
+	}
+	for _, uniqueId := range []string{"0123456789abcdef0123456789abcdef", ""} {
+		err = spool.Write(&LogBatch{Database: "db", Table: "tbl", Format: "msgpack.gz", UniqueId: uniqueId, Records: 1, Blob: InMemoryBlob("chunk")})
+		if err != nil {
+			t.Fatalf("failed to write spool: %s", err.Error())
+		}
+	}
+	entries, err := spool.Entries()
+	if err != nil {
+		t.Fatalf("failed to list spool: %s", err.Error())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	blob, err := spool.Blob(entries[0])
+	if err != nil {
+		t.Fatalf("failed to read spool: %s", err.Error())
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		t.Fatalf("failed to read spool: %s", err.Error())
+	}
+	chunk, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("failed to read spool: %s", err.Error())
+	}
+	if string(chunk) != "chunk" {
+		t.Fatalf("unexpected chunk: %s", chunk)
+	}
+
+	transport := &ImportTransport{StatusCode: 503}
+	client, err := NewTDClient(Settings{Transport: transport, Retry: &RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	n, err := spool.Replay(context.Background(), client)
+	if err == nil || n != 0 {
+		t.Fatalf("expected a failure, got %d, %v", n, err)
+	}
+	transport.StatusCode = 0
+	n, err = spool.Replay(context.Background(), client)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 chunks replayed, got %d", n)
+	}
+	paths := transport.paths()
+	if paths[len(paths)-2] != "/v3/table/import_with_id/db/tbl/0123456789abcdef0123456789abcdef/msgpack.gz" && paths[len(paths)-1] != "/v3/table/import_with_id/db/tbl/0123456789abcdef0123456789abcdef/msgpack.gz" {
+		t.Fatalf("original unique id is not used: %v", paths)
+	}
+	entries, err = spool.Entries()
+	if err != nil {
+		t.Fatalf("failed to list spool: %s", err.Error())
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the spool to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestLoggerSpool(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open spool: %s", err.Error())
+	}
+	client, err := NewTDClient(Settings{Transport: &ImportTransport{StatusCode: 400}})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	logger := client.NewLogger(&LoggerOptions{Spool: spool})
+	err = logger.Post("db", "tbl", map[string]interface{}{"i": 0})
+	if err != nil {
+		t.Fatalf("failed to post: %s", err.Error())
+	}
+	err = logger.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	entries, err := spool.Entries()
+	if err != nil {
+		t.Fatalf("failed to list spool: %s", err.Error())
+	}
+	if len(entries) != 1 || entries[0].Table != "tbl" || entries[0].Format != "msgpack.gz" || len(entries[0].UniqueId) != 32 {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+}
+
+func TestSpoolReplayJSON(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open spool: %s", err.Error())
+	}
+	chunk := `{"time":1,"v":"a"}` + "\n"
+	err = spool.Write(&LogBatch{Database: "db", Table: "tbl", Format: "json", Records: 1, Blob: InMemoryBlob(chunk)})
+	if err != nil {
+		t.Fatalf("failed to write spool: %s", err.Error())
+	}
+	transport := &ImportTransport{}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	n, err := spool.Replay(context.Background(), client)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if n != 1 || len(transport.Bodies) != 1 || transport.Bodies[0] != chunk {
+		t.Fatalf("unexpected chunks replayed: %d, %q", n, transport.Bodies)
+	}
+}
@@ -20,6 +20,7 @@ package td_client
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/tls"
 	"crypto/x509"
@@ -45,6 +46,8 @@ const (
 	ForbiddenError
 	AlreadyExistsError
 	NotFoundError
+	InvalidResponseError  // The response could not be parsed.
+	ChecksumMismatchError // The checksum reported by the server differs from that of the uploaded data.
 )
 
 const (
@@ -55,7 +58,7 @@ const (
 )
 
 const (
-	CLIENT_VERSION = "0.4.0"
+	CLIENT_VERSION = "0.5.0"
 )
 
 const (
@@ -65,11 +68,29 @@ const (
 	TDAPIDateTimeNumericZone = "2006-01-02 15:04:05 -0700"
 )
 
+// Sentinel errors matched by APIError through errors.Is.
+var (
+	ErrNotFound          = errors.New("not found")          // Type is NotFoundError.
+	ErrAlreadyExists     = errors.New("already exists")     // Type is AlreadyExistsError.
+	ErrRateLimited       = errors.New("rate limited")       // The server responded with 429.
+	ErrServerUnavailable = errors.New("server unavailable") // The server responded with 5xx.
+	ErrInvalidResponse   = errors.New("invalid response")   // Type is InvalidResponseError.
+	ErrChecksumMismatch  = errors.New("checksum mismatch")  // Type is ChecksumMismatchError.
+)
+
 // APIError represents an error that has occurred during the API call.
+//
+// Use errors.Is with the sentinel errors such as ErrNotFound to tell the kind of the error,
+// and errors.As to get at the details.  Unwrap returns Cause.
 type APIError struct {
-	Type    int
-	Message string
-	Cause   error
+	Type       int
+	Message    string
+	Cause      error
+	StatusCode int    // HTTP status code of the response, or 0 if there was none.
+	RequestId  string // Value of the X-Request-Id response header.
+	Endpoint   string // Host the request was routed to.
+	Operation  string // Name of the API call, e.g. "SubmitQuery".
+	Body       []byte // Raw body of the error response.
 }
 
 func stringizeAPIErrorType(type_ int) string {
@@ -84,10 +105,19 @@ func stringizeAPIErrorType(type_ int) string {
 		return "AlreadyExistsError"
 	case NotFoundError:
 		return "NotFoundError"
+	case InvalidResponseError:
+		return "InvalidResponseError"
+	case ChecksumMismatchError:
+		return "ChecksumMismatchError"
 	}
 	return "Unknown"
 }
 
+// TypeName returns the name of Type, e.g. "NotFoundError".
+func (e *APIError) TypeName() string {
+	return stringizeAPIErrorType(e.Type)
+}
+
 func (e *APIError) Error() string {
 	retval := fmt.Sprintf("%s: %s", stringizeAPIErrorType(e.Type), e.Message)
 	if e.Cause != nil {
@@ -96,6 +126,29 @@ func (e *APIError) Error() string {
 	return retval
 }
 
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether the error is of the kind denoted by the sentinel error.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Type == NotFoundError
+	case ErrAlreadyExists:
+		return e.Type == AlreadyExistsError
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerUnavailable:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	case ErrInvalidResponse:
+		return e.Type == InvalidResponseError
+	case ErrChecksumMismatch:
+		return e.Type == ChecksumMismatchError
+	}
+	return false
+}
+
 // EndpointRouter is expected to return the host name most suitable for the passed request URI
 type EndpointRouter interface {
 	Route(requestUri string) string
@@ -111,20 +164,38 @@ type EndpointRouter interface {
 //
 // Transport allows you to take more control over the communication.
 //
+// Retry enables retrying the requests that failed with a transient error.  See RetryPolicy for what is retried.
+//
+// Interceptors wrap every request sent through the transport, the first one being the outermost.  See Interceptor.
+//
+// RateLimits throttles the requests on the client side per endpoint chosen by the Router, e.g. DefaultRouter.DefaultEndpoint and DefaultRouter.ImportEndpoint.  The limit keyed by "" applies to the endpoints not listed.  See RateLimit.
+//
+// Credentials supplies the API key on every request in place of ApiKey, allowing the key to be rotated.  When a request is rejected with 401,
+// the key is re-fetched and the request is retried once if the key has changed.  See CredentialProvider.
+//
+// DebugLog records every request with its status, latency and response size.  DebugLogBodies adds the request and response bodies to the records, with the API key, passwords and the returned API keys redacted.
+//
 // `Ssl` option was removed from client options.
 // td-client-go no longer support `Ssl` option since Treasure Data permits only HTTPS access after September 1, 2020.
 type Settings struct {
-	ApiKey            string            // Treasure Data Account API key
-	UserAgent         string            // (Optional) Name that will appear as the User-Agent HTTP header
-	Router            EndpointRouter    // (Optional) Endpoint router
-	ConnectionTimeout time.Duration     // (Optional) Connection timeout
-	ReadTimeout       time.Duration     // (Optional) Read timeout.
-	SendTimeout       time.Duration     // (Optional) Send timeout.
-	RootCAs           *x509.CertPool    // (Optional) Specify the CA certificates.
-	Port              int               // (Optional) Port number.
-	Proxy             interface{}       // (Optional) HTTP proxy to use.
-	Transport         http.RoundTripper // (Optional) Overrides the transport used to establish the connection.
-	Headers           map[string]string // (Optional) Additional headers that will be sent to the endpoint.
+	ApiKey            string               // Treasure Data Account API key
+	Credentials       CredentialProvider   // (Optional) Provider of the API key overriding ApiKey.
+	UserAgent         string               // (Optional) Name that will appear as the User-Agent HTTP header
+	Router            EndpointRouter       // (Optional) Endpoint router
+	ConnectionTimeout time.Duration        // (Optional) Connection timeout
+	ReadTimeout       time.Duration        // (Optional) Read timeout.
+	SendTimeout       time.Duration        // (Optional) Send timeout.
+	RootCAs           *x509.CertPool       // (Optional) Specify the CA certificates.
+	Port              int                  // (Optional) Port number.
+	Proxy             interface{}          // (Optional) HTTP proxy to use.
+	Transport         http.RoundTripper    // (Optional) Overrides the transport used to establish the connection.
+	Headers           map[string]string    // (Optional) Additional headers that will be sent to the endpoint.
+	Retry             *RetryPolicy         // (Optional) Retry policy for transient failures. nil disables retrying.
+	StrictDecoding    bool                 // (Optional) Reject the responses containing unknown keys. Meant for tests.
+	Interceptors      []Interceptor        // (Optional) Middleware applied to every request.
+	DebugLog          DebugLogger          // (Optional) Logger of the API traffic, such as *slog.Logger.
+	DebugLogBodies    bool                 // (Optional) Dump the request and response bodies to DebugLog.
+	RateLimits        map[string]RateLimit // (Optional) Client-side limits on the requests keyed by the endpoint.
 }
 
 // A FixedEndpointRouter instance represents an EndpointRouter that always routes the request to the same endpoint.
@@ -158,7 +229,7 @@ var DefaultRouter = V3EndpointRouter{
 
 // TDClient represents a context used to talk to the Treasure Data API.
 type TDClient struct {
-	apiKey            string
+	credentials       CredentialProvider
 	userAgent         string
 	router            EndpointRouter
 	ssl               bool
@@ -168,7 +239,11 @@ type TDClient struct {
 	readTimeout       time.Duration
 	sendTimeout       time.Duration
 	transport         http.RoundTripper
+	roundTrip         RoundTripFunc
 	headers           map[string]string
+	retryPolicy       *RetryPolicy
+	rateLimiters      *rateLimiters
+	strictDecoding    bool
 	mpCodec           *codec.MsgpackHandle
 }
 
@@ -180,16 +255,19 @@ type Blob interface {
 }
 
 // Used in internal schema, marking the field as optional as well as providing the default.
+//
+// Deprecated: the responses are now decoded into structs with `td` tags and Optional is no longer used.
 type Optional struct {
 	V       interface{}
 	Default interface{}
 }
 
 // Used in internal schema, marking the field so that it will be unmarshaled by the specified function.
+//
+// Deprecated: the responses are now decoded into structs with `td` tags and ConverterFunc is no longer used.
 type ConverterFunc func(string) (interface{}, error)
 
 var timeType = reflect.TypeOf(time.Time{})
-var optionalType = reflect.TypeOf(Optional{})
 
 // InMemoryBlob is a Blob which stores the entire data as a byte array.
 type InMemoryBlob []byte
@@ -210,6 +288,8 @@ func (b InMemoryBlob) MD5Sum() ([]byte, error) {
 }
 
 // EmbeddedJSON is a factory used internally that makes a ConverterFunc function that returns the specified type.
+//
+// Deprecated: the responses are now decoded into structs with `td` tags and EmbeddedJSON is no longer used.
 func EmbeddedJSON(expectedTypeProto interface{}) ConverterFunc {
 	expectedType := reflect.TypeOf(expectedTypeProto)
 	return func(jsStr string) (interface{}, error) {
@@ -245,7 +325,7 @@ func (client *TDClient) buildUrl(requestUri string, params url.Values) *url.URL
 	}
 }
 
-func (client *TDClient) newRequest(method string, requestUri string, params url.Values, body Blob) (*http.Request, error) {
+func (client *TDClient) newRequest(ctx context.Context, apiKey string, method string, requestUri string, params url.Values, header http.Header, body Blob) (*http.Request, error) {
 	getParams := (url.Values)(nil)
 	contentType := "application/octet-stream"
 	if method == "POST" {
@@ -268,7 +348,8 @@ func (client *TDClient) newRequest(method string, requestUri string, params url.
 		}
 	}
 	url := client.buildUrl(requestUri, getParams).String()
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		method,
 		url,
 		reader,
@@ -285,49 +366,114 @@ func (client *TDClient) newRequest(method string, requestUri string, params url.
 	for k, v := range client.headers {
 		req.Header.Set(k, v)
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
 	req.Header.Set("Date", time.Now().Format(time.RFC822))
 	req.Header.Set("User-Agent", client.userAgent)
-	req.Header.Set("Authorization", "TD1 "+client.apiKey)
+	req.Header.Set("Authorization", "TD1 "+apiKey)
 	return req, nil
 }
 
-func (client *TDClient) get(requestUri string, params url.Values) (*http.Response, error) {
-	req, err := client.newRequest("GET", requestUri, params, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := client.transport.RoundTrip(req)
-	if err != nil {
-		return nil, err
-	}
-	return resp, nil
+// send issues the request on behalf of the operation, retrying it according to the retry policy if replayable is true.
+func (client *TDClient) send(ctx context.Context, operation string, method string, requestUri string, params url.Values, body Blob, replayable bool) (*http.Response, error) {
+	return client.sendWithHeader(ctx, operation, method, requestUri, params, nil, body, replayable)
 }
 
-func (client *TDClient) post(requestUri string, params url.Values) (*http.Response, error) {
-	req, err := client.newRequest("POST", requestUri, params, nil)
-	if err != nil {
-		return nil, err
+// sendWithHeader is send adding the header to the request.
+func (client *TDClient) sendWithHeader(ctx context.Context, operation string, method string, requestUri string, params url.Values, header http.Header, body Blob, replayable bool) (*http.Response, error) {
+	maxAttempts := 1
+	if replayable && client.retryPolicy != nil && client.retryPolicy.allowsMethod(method) {
+		maxAttempts = client.retryPolicy.maxAttempts()
 	}
-	resp, err := client.transport.RoundTrip(req)
-	if err != nil {
-		return nil, err
+	limiter := client.rateLimiters.get(client.router.Route(requestUri))
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		apiKey, err := client.credentials.APIKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if limiter != nil {
+			err := limiter.acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		req, err := client.newRequest(withRequestError(context.WithValue(context.WithValue(ctx, operationKey{}, operation), attemptKey{}, attempt)), apiKey, method, requestUri, params, header, body)
+		if err != nil {
+			if limiter != nil {
+				limiter.release()
+			}
+			return nil, err
+		}
+		resp, err := client.roundTrip(operation, req)
+		if resp != nil && resp.Request == nil {
+			resp.Request = req
+		}
+		if limiter != nil {
+			if err != nil {
+				limiter.release()
+			} else {
+				limiter.observe(resp)
+				resp.Body = &limitedBody{ReadCloser: resp.Body, limiter: limiter}
+			}
+		}
+		// the request rejected for the credentials has not been processed, so it is safe to send again unless the body cannot be replayed.
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !reauthenticated && (body == nil || replayable) && client.refreshCredentials(ctx, apiKey) {
+			reauthenticated = true
+			maxAttempts++
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			continue
+		}
+		if attempt >= maxAttempts || !client.retryPolicy.shouldRetry(ctx, resp, err) {
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		wait := client.retryPolicy.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return resp, nil
 }
 
-func (client *TDClient) put(requestUri string, stream Blob) (*http.Response, error) {
-	req, err := client.newRequest("PUT", requestUri, nil, stream)
-	if err != nil {
-		return nil, err
+func (client *TDClient) get(ctx context.Context, operation string, requestUri string, params url.Values) (*http.Response, error) {
+	return client.send(ctx, operation, "GET", requestUri, params, nil, true)
+}
+
+func (client *TDClient) post(ctx context.Context, operation string, requestUri string, params url.Values) (*http.Response, error) {
+	return client.send(ctx, operation, "POST", requestUri, params, nil, false)
+}
+
+func (client *TDClient) put(ctx context.Context, operation string, requestUri string, stream Blob, replayable bool) (*http.Response, error) {
+	return client.send(ctx, operation, "PUT", requestUri, nil, stream, replayable)
+}
+
+// newAPIError creates an APIError describing the response.
+func newAPIError(resp *http.Response, type_ int, message string, cause error) *APIError {
+	retval := &APIError{
+		Type:       type_,
+		Message:    message,
+		Cause:      cause,
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get("X-Request-Id"),
 	}
-	resp, err := client.transport.RoundTrip(req)
-	if err != nil {
-		return nil, err
+	if resp.Request != nil {
+		retval.Endpoint = resp.Request.URL.Hostname()
+		retval.Operation, _ = resp.Request.Context().Value(operationKey{}).(string)
+		recordRequestError(resp, retval)
 	}
-	return resp, nil
+	return retval
 }
 
 func (client *TDClient) buildError(resp *http.Response, type_ int, message string, cause error) error {
@@ -378,11 +524,9 @@ func (client *TDClient) buildError(resp *http.Response, type_ int, message strin
 	} else {
 		message = fmt.Sprintf("%d: %s: %s", statusCode, message, errorMessage)
 	}
-	return &APIError{
-		Type:    type_,
-		Message: message,
-		Cause:   cause,
-	}
+	retval := newAPIError(resp, type_, message, cause)
+	retval.Body = body
+	return retval
 }
 
 func stringizeType(type_ reflect.Type) string {
@@ -404,221 +548,20 @@ func stringizeType(type_ reflect.Type) string {
 	}
 }
 
-func integralType(type_ reflect.Type) bool {
-	switch type_.Kind() {
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		return true
-	default:
-		return false
-	}
-}
-
-func defaultFor(type_ reflect.Type) interface{} {
-	switch type_.Kind() {
-	case reflect.Bool:
-		return false
-	case reflect.String:
-		return ""
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		return 0
-	case reflect.Float32, reflect.Float64:
-		return 0.
-	case reflect.Slice, reflect.Array:
-		return []interface{}{}
-	case reflect.Map:
-		return map[string]interface{}{}
-	default:
-		return nil
-	}
-}
-
-func (client *TDClient) validateAndCoerceInner(path string, v interface{}, ev reflect.Value) (interface{}, error) {
-	gottenType := (reflect.Type)(nil)
-	if v != nil {
-		gottenType = reflect.TypeOf(v)
-	}
-	if ev.Type().Kind() == reflect.Interface {
-		// XXX: is this really good?
-		ev = ev.Elem()
-	}
-	expectedType := ev.Type()
-	expectedJsonType := expectedType
-	optional := false
-	defaultValue := (interface{})(nil)
-	if expectedType == optionalType {
-		optional = true
-		_ev := ev.Interface().(Optional)
-		ev = reflect.ValueOf(_ev.V)
-		defaultValue = _ev.Default
-		expectedType = ev.Type()
-		expectedJsonType = expectedType
-	}
-	if expectedType.Kind() == reflect.Struct || expectedType.Kind() == reflect.Func {
-		expectedJsonType = reflect.TypeOf("")
-	}
-	if gottenType == nil {
-		if optional {
-			if defaultValue == nil {
-				defaultValue = defaultFor(expectedType)
-			}
-			return defaultValue, nil
-		}
-		return nil, fmt.Errorf("%s may not be null", path)
-	}
-	if expectedJsonType.Kind() != gottenType.Kind() {
-		if gottenType.Kind() == reflect.Float64 && integralType(expectedJsonType) {
-			v = reflect.ValueOf(v).Convert(expectedJsonType).Interface()
-		} else if gottenType.Kind() == reflect.Map && expectedJsonType.Kind() == reflect.String {
-			jsonString, err := json.Marshal(v)
-			if err != nil {
-				return nil, fmt.Errorf("%s is failed parse map to string %s", path, err.Error())
-			}
-			v = string(jsonString)
-		} else {
-			return nil, fmt.Errorf("type mismatch (%s != %s) for %s", stringizeType(gottenType), stringizeType(expectedJsonType), path)
-		}
-	}
-	switch expectedType.Kind() {
-	case reflect.Func:
-		res := ev.Call([]reflect.Value{reflect.ValueOf(v)})
-		v = res[0].Interface()
-		err := res[1].Interface()
-		// if !ok {
-		// 	return nil, errors.New(fmt.Sprintf("unsupported type %s in the schema for %s", expectedType.String(), path))
-		// }
-		// v, err = _ev(v.(string))
-		if err != nil {
-			return nil, err.(error)
-		}
-	case reflect.Struct:
-		if expectedType == timeType {
-			sv := v.(string)
-			if sv == "" {
-				if !optional {
-					return nil, fmt.Errorf("%s may not be empty", path)
-				} else {
-					v = defaultValue
-				}
-			} else {
-				_v, err := time.Parse(time.RFC3339, sv)
-				if err != nil {
-					_v, err = time.Parse(TDAPIDateTime, sv)
-					if err != nil {
-						_v, err = time.Parse(TDAPIDateTimeNumericZone, sv)
-						if err != nil {
-							return nil, fmt.Errorf("invalid time string %s for %s", sv, path)
-						}
-					}
-				}
-				v = _v.UTC()
-			}
-		} else {
-			return nil, fmt.Errorf("unsupported type %s in the schema for %s", expectedType.String(), path)
-		}
-	case reflect.Slice:
-		_path := make([]byte, len(path), len(path)+16)
-		copy(_path, path)
-		_path = append(_path, '[')
-		h := len(_path)
-		_v := v.([]interface{})
-		rv := reflect.MakeSlice(expectedType, len(_v), len(_v))
-		if ev.Len() == 0 {
-			for i, ve := range _v {
-				rv.Index(i).Set(reflect.ValueOf(ve))
-			}
-		} else {
-			eve := ev.Index(0)
-			for i, ve := range _v {
-				_path = _path[0:h]
-				_path = append(_path, strconv.Itoa(i)...)
-				_path = append(_path, ']')
-				rve, err := client.validateAndCoerceInner(string(_path), ve, eve)
-				if err != nil {
-					return nil, err
-				}
-				rv.Index(i).Set(reflect.ValueOf(rve))
-			}
-		}
-		v = rv.Interface()
-	case reflect.Map:
-		_path := make([]byte, len(path), len(path)+1+16)
-		copy(_path, path)
-		if path != "/" {
-			_path = append(_path, '/')
-		}
-		h := len(_path)
-		_v := v.(map[string]interface{})
-		for k := range _v {
-			if !ev.MapIndex(reflect.ValueOf(k)).IsValid() {
-				return nil, fmt.Errorf("unknown key %s under %s", k, path)
-			}
-		}
-		rv := reflect.MakeMap(expectedType)
-		for _, _k := range ev.MapKeys() {
-			k := _k.String()
-			eve := ev.MapIndex(_k)
-			evt := eve.Type()
-			if evt.Kind() == reflect.Interface {
-				eve = eve.Elem()
-				evt = eve.Type()
-			}
-			ve, ok := _v[k]
-			if !ok {
-				if evt == optionalType {
-					ve = eve.Interface().(Optional).Default
-				} else {
-					return nil, fmt.Errorf("missing key %s under %s", k, path)
-				}
-			}
-			_path = _path[0:h]
-			_path = append(_path, k...)
-			rve, err := client.validateAndCoerceInner(string(_path), ve, eve)
-			if err != nil {
-				return nil, err
-			}
-			rv.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(rve))
-		}
-		v = rv.Interface()
-	}
-	return v, nil
-}
-
-func (client *TDClient) validateAndCoerce(js map[string]interface{}, schema map[string]interface{}) (map[string]interface{}, error) {
-	retval, err := client.validateAndCoerceInner("/", js, reflect.ValueOf(schema))
-	if err == nil {
-		return retval.(map[string]interface{}), err // TA: reasonably safe
-	} else {
-		return nil, err
-	}
-}
-
-func (client *TDClient) checkedJson(resp *http.Response, schema map[string]interface{}) (map[string]interface{}, error) {
+func (client *TDClient) checkedJson(resp *http.Response, dest interface{}) error {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, &APIError{
-			Type:    GenericError,
-			Message: "failed to read response",
-			Cause:   err,
-		}
+		return newAPIError(resp, GenericError, "failed to read response", err)
 	}
-	js := make(map[string]interface{})
-	err = json.Unmarshal(body, &js)
+	js, err := parseJSON(body)
 	if err != nil {
-		return nil, &APIError{
-			Type:    GenericError,
-			Message: "failed to parse response: " + string(body),
-			Cause:   err,
-		}
+		return newAPIError(resp, InvalidResponseError, "failed to parse response: "+string(body), err)
 	}
-	js, err = client.validateAndCoerce(js, schema)
+	err = decodeJSON(js, dest, client.strictDecoding)
 	if err != nil {
-		return nil, &APIError{
-			Type:    GenericError,
-			Message: "failed to parse response: " + err.Error(),
-			Cause:   nil,
-		}
+		return newAPIError(resp, InvalidResponseError, "failed to parse response: "+err.Error(), nil)
 	}
-	return js, nil
+	return nil
 }
 
 func (client *TDClient) getMessagePackDecoder(reader io.Reader) *codec.Decoder {
@@ -702,12 +645,20 @@ func NewTDClient(settings Settings) (*TDClient, error) {
 	if router == nil {
 		router = &DefaultRouter
 	}
+	interceptors := settings.Interceptors
+	if settings.DebugLog != nil {
+		interceptors = append(append([]Interceptor(nil), interceptors...), debugLogInterceptor(settings.DebugLog, settings.DebugLogBodies))
+	}
+	credentials := settings.Credentials
+	if credentials == nil {
+		credentials = StaticCredentials(settings.ApiKey)
+	}
 	userAgent := "TD-Client-Go: " + CLIENT_VERSION
 	if settings.UserAgent != "" {
 		userAgent += "; " + settings.UserAgent
 	}
 	return &TDClient{
-		apiKey:            settings.ApiKey,
+		credentials:       credentials,
 		userAgent:         userAgent,
 		router:            router,
 		rootCAs:           settings.RootCAs,
@@ -716,7 +667,11 @@ func NewTDClient(settings Settings) (*TDClient, error) {
 		readTimeout:       settings.ReadTimeout,
 		sendTimeout:       settings.SendTimeout,
 		transport:         transport,
+		roundTrip:         chainInterceptors(transport, interceptors),
 		headers:           settings.Headers,
+		retryPolicy:       settings.Retry,
+		rateLimiters:      newRateLimiters(settings.RateLimits),
+		strictDecoding:    settings.StrictDecoding,
 		mpCodec:           &codec.MsgpackHandle{},
 	}, nil
 }
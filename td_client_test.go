@@ -20,144 +20,178 @@ package td_client
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 )
 
 var UTC, _ = time.LoadLocation("UTC")
 
+type testSchemaH struct {
+	I string `td:"i"`
+}
+
+type testSchemaE struct {
+	F time.Time     `td:"f"`
+	G []interface{} `td:"g"`
+	H []testSchemaH `td:"h"`
+}
+
+type testSchemaC struct {
+	D float64     `td:"d"`
+	E testSchemaE `td:"e"`
+}
+
+type testSchema struct {
+	A int         `td:"a"`
+	B string      `td:"b"`
+	C testSchemaC `td:"c"`
+	O string      `td:"o,optional,default=?"`
+	S []string    `td:"s,optional,json"`
+}
+
+func decodeTestJSON(js string, dest interface{}, strict bool) error {
+	v, err := parseJSON([]byte(js))
+	if err != nil {
+		return err
+	}
+	return decodeJSON(v, dest, strict)
+}
+
 func TestCheckSchemaSuccess(t *testing.T) {
-	client := &TDClient{}
-	var retval map[string]interface{}
-	var err error
-	retval, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": 123,
-			"b": "str",
-			"c": map[string]interface{}{
-				"d": 1.0,
-				"e": map[string]interface{}{
-					"f": "2014-01-01T10:23:45+09:00",
-					"g": []interface{}{
-						"a",
-						"b",
-					},
-					"h": []interface{}{
-						map[string]interface{}{
-							"i": "j",
-						},
-					},
-				},
-			},
-		},
-		map[string]interface{}{
-			"a": 0,
-			"b": "",
-			"c": map[string]interface{}{
-				"d": 0.,
-				"e": map[string]interface{}{
-					"f": time.Time{},
-					"g": []interface{}{
-						"",
-					},
-					"h": []map[string]string{
-						{
-							"i": "",
-						},
-					},
-				},
-			},
+	retval := testSchema{}
+	err := decodeTestJSON(`{
+		"a": 123,
+		"b": "str",
+		"c": {
+			"d": 1.0,
+			"e": {
+				"f": "2014-01-01T10:23:45+09:00",
+				"g": ["a", "b"],
+				"h": [{"i": "j"}]
+			}
 		},
-	)
+		"s": "[\"x\"]"
+	}`, &retval, true)
 	if err != nil {
 		t.Log(err.Error())
 		t.FailNow()
 	}
-	if retval["a"].(int) != 123 {
+	if retval.A != 123 {
+		t.Fail()
+	}
+	if retval.B != "str" {
+		t.Fail()
+	}
+	if retval.C.D != 1.0 {
 		t.Fail()
 	}
-	if retval["b"].(string) != "str" {
+	if retval.C.E.F != time.Date(2014, 1, 1, 1, 23, 45, 0, UTC) {
 		t.Fail()
 	}
-	if retval["c"].(map[string]interface{})["d"].(float64) != 1.0 {
+	if !reflect.DeepEqual(retval.C.E.G, []interface{}{"a", "b"}) {
 		t.Fail()
 	}
-	if retval["c"].(map[string]interface{})["e"].(map[string]interface{})["f"].(time.Time) != time.Date(2014, 1, 1, 1, 23, 45, 0, UTC) {
+	if !reflect.DeepEqual(retval.C.E.H, []testSchemaH{{"j"}}) {
 		t.Fail()
 	}
-	if !reflect.DeepEqual(retval["c"].(map[string]interface{})["e"].(map[string]interface{})["g"].([]interface{}), []interface{}{"a", "b"}) {
+	if retval.O != "?" {
+		t.Fail()
+	}
+	if !reflect.DeepEqual(retval.S, []string{"x"}) {
 		t.Fail()
 	}
 }
 
 func TestCheckSchemaFail(t *testing.T) {
-	client := &TDClient{}
-
 	var err error
-	_, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": 0,
-			"b": "str",
-		},
-		map[string]interface{}{
-			"a": 0,
-			"b": 0,
-		},
-	)
+	err = decodeTestJSON(`{"a": 0, "b": "str"}`, &struct {
+		A int `td:"a"`
+		B int `td:"b"`
+	}{}, false)
 	if err == nil {
 		t.Fail()
 	}
-	_, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": 0,
-			"b": "str",
-		},
-		map[string]interface{}{
-			"a": 0.,
-			"b": "",
-		},
-	)
+	err = decodeTestJSON(`{"a": 0, "b": {}}`, &struct {
+		A float64 `td:"a"`
+		B int     `td:"b"`
+	}{}, false)
 	if err == nil {
 		t.Fail()
 	}
-	_, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": 0,
-			"b": map[string]interface{}{},
-		},
-		map[string]interface{}{
-			"a": 0.,
-			"b": "",
-		},
-	)
+	err = decodeTestJSON(`{"a": [0]}`, &struct {
+		A string `td:"a"`
+	}{}, false)
 	if err == nil {
 		t.Fail()
 	}
-	_, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": []interface{}{0.},
-		},
-		map[string]interface{}{
-			"a": "",
-		},
-	)
+	err = decodeTestJSON(`{"a": [0, "x"]}`, &struct {
+		A []int `td:"a"`
+	}{}, false)
 	if err == nil {
 		t.Fail()
 	}
-	_, err = client.validateAndCoerce(
-		map[string]interface{}{
-			"a": []interface{}{0., 0},
-		},
-		map[string]interface{}{
-			"a": []interface{}{""},
-		},
-	)
+	err = decodeTestJSON(`{"a": null}`, &struct {
+		A string `td:"a"`
+	}{}, false)
+	if err == nil {
+		t.Fail()
+	}
+	err = decodeTestJSON(`{}`, &struct {
+		A string `td:"a"`
+	}{}, false)
 	if err == nil {
 		t.Fail()
 	}
+	err = decodeTestJSON(`{"a": "yesterday"}`, &struct {
+		A time.Time `td:"a"`
+	}{}, false)
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestCheckSchemaUnknownKey(t *testing.T) {
+	dest := struct {
+		A int      `td:"a"`
+		_ struct{} `td:"b,optional"`
+	}{}
+	err := decodeTestJSON(`{"a": 1, "b": 2, "c": 3}`, &dest, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if dest.A != 1 {
+		t.Fail()
+	}
+	err = decodeTestJSON(`{"a": 1, "b": 2}`, &dest, true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = decodeTestJSON(`{"a": 1, "b": 2, "c": 3}`, &dest, true)
+	if err == nil || err.Error() != "unknown key c under /" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckSchemaTimeFormats(t *testing.T) {
+	expected := time.Date(2016, 7, 26, 8, 14, 46, 0, UTC)
+	for _, s := range []string{"2016-07-26T08:14:46Z", "2016-07-26 08:14:46 UTC", "2016-07-26 17:14:46 +0900"} {
+		dest := struct {
+			T time.Time `td:"t"`
+		}{}
+		err := decodeTestJSON(`{"t": "`+s+`"}`, &dest, false)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !dest.T.Equal(expected) {
+			t.Errorf("unexpected time for %s: %s", s, dest.T)
+		}
+	}
 }
 
 type DummyTransport struct {
@@ -191,3 +225,134 @@ func TestServerStatus(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type ContextCheckingTransport struct {
+	DummyTransport
+}
+
+func (t *ContextCheckingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	return t.DummyTransport.RoundTrip(req)
+}
+
+func TestServerStatusContextCanceled(t *testing.T) {
+	client, err := NewTDClient(Settings{Transport: &ContextCheckingTransport{DummyTransport{[]byte(`{"status":"ok"}`)}}})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	status, err := client.ServerStatusContext(ctx)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if status.Status != "ok" {
+		t.Fatalf("unexpected status: %s", status.Status)
+	}
+	cancel()
+	_, err = client.ServerStatusContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestServerStatusUnknownKey(t *testing.T) {
+	transport := &DummyTransport{[]byte(`{"status":"ok","version":"v3"}`)}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	status, err := client.ServerStatus()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if status.Status != "ok" {
+		t.Fatalf("unexpected status: %s", status.Status)
+	}
+	client, err = NewTDClient(Settings{Transport: transport, StrictDecoding: true})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ServerStatus()
+	if err == nil {
+		t.Fatalf("expected an error for the unknown key")
+	}
+}
+
+// StatusTransport responds with the status code and the body, and X-Request-Id set to "req-1".
+type StatusTransport struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (t *StatusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:     strconv.Itoa(t.StatusCode) + " " + http.StatusText(t.StatusCode),
+		StatusCode: t.StatusCode,
+		Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"req-1"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(t.Body)),
+		ContentLength: int64(len(t.Body)),
+		Request:       req,
+	}, nil
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	sentinels := []error{ErrNotFound, ErrAlreadyExists, ErrRateLimited, ErrServerUnavailable, ErrInvalidResponse, ErrChecksumMismatch}
+	tests := []struct {
+		statusCode int
+		body       string
+		expected   error
+	}{
+		{404, `{"error":"Job 1 does not exist"}`, ErrNotFound},
+		{409, `{"error":"Database db already exists"}`, ErrAlreadyExists},
+		{429, `{"error":"Too many requests"}`, ErrRateLimited},
+		{503, `{"error":"Service unavailable"}`, ErrServerUnavailable},
+		{200, `{"status":`, ErrInvalidResponse},
+		{422, `{"error":"Unprocessable"}`, nil},
+	}
+	for _, test := range tests {
+		client, err := NewTDClient(Settings{
+			Transport: &StatusTransport{StatusCode: test.statusCode, Body: []byte(test.body)},
+			Router:    &FixedEndpointRouter{Endpoint: "api.example.com"},
+		})
+		if err != nil {
+			t.Fatalf("failed create client: %s", err.Error())
+		}
+		_, err = client.ShowJob("1")
+		apiErr := (*APIError)(nil)
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%d: expected APIError, got %v", test.statusCode, err)
+		}
+		if apiErr.StatusCode != test.statusCode || apiErr.RequestId != "req-1" || apiErr.Endpoint != "api.example.com" || apiErr.Operation != "ShowJob" {
+			t.Errorf("%d: unexpected details: %+v", test.statusCode, apiErr)
+		}
+		if test.statusCode != 200 && string(apiErr.Body) != test.body {
+			t.Errorf("%d: unexpected body: %s", test.statusCode, apiErr.Body)
+		}
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel) != (sentinel == test.expected) {
+				t.Errorf("%d: errors.Is(%v) = %v", test.statusCode, sentinel, !(sentinel == test.expected))
+			}
+		}
+	}
+}
+
+func TestAPIErrorUnwrap(t *testing.T) {
+	transport := &DummyTransport{[]byte{0x91, 0x01}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	cause := errors.New("stop")
+	err = client.JobResultEach("1", func(interface{}) error { return cause })
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected the cause to be unwrapped, got %v", err)
+	}
+	transport.ResponseBytes = []byte{0xc1}
+	err = client.JobResultEach("1", func(interface{}) error { return nil })
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected ErrInvalidResponse, got %v", err)
+	}
+}
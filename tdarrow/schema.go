@@ -0,0 +1,163 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdarrow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+// Schema maps the columns of a job result, as given by ShowJobResult.HiveResultSchema, to an Arrow schema.
+//
+// The Hive and Presto types are mapped as follows, every field being nullable:
+//
+//	tinyint, smallint, int, bigint  int8, int16, int32, int64
+//	real (float), double            float32, float64
+//	boolean                         bool
+//	decimal(p, s)                   decimal128(p, s)
+//	date                            date32
+//	timestamp                       timestamp[us], in UTC if with time zone
+//	varbinary (binary)              binary
+//	array(T), map(K, V)             list<T>, map<K, V>
+//
+// Any other type, such as varchar, json and row, is mapped to utf8, complex values being written as JSON text.
+func Schema(hiveResultSchema []interface{}) (*arrow.Schema, error) {
+	columns, err := td_client.ParseResultSchema(hiveResultSchema)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		type_, err := DataType(c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %s", c.Name, err.Error())
+		}
+		fields[i] = arrow.Field{Name: c.Name, Type: type_, Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// DataType maps a Hive or Presto type, e.g. "array<bigint>" or "map(varchar, double)", to the Arrow type as described in Schema.
+func DataType(type_ string) (arrow.DataType, error) {
+	base, params, err := splitType(strings.ToLower(strings.TrimSpace(type_)))
+	if err != nil {
+		return nil, err
+	}
+	switch base {
+	case "tinyint":
+		return arrow.PrimitiveTypes.Int8, nil
+	case "smallint":
+		return arrow.PrimitiveTypes.Int16, nil
+	case "int", "integer":
+		return arrow.PrimitiveTypes.Int32, nil
+	case "bigint":
+		return arrow.PrimitiveTypes.Int64, nil
+	case "real", "float":
+		return arrow.PrimitiveTypes.Float32, nil
+	case "double":
+		return arrow.PrimitiveTypes.Float64, nil
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean, nil
+	case "date":
+		return arrow.FixedWidthTypes.Date32, nil
+	case "timestamp":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}, nil
+	case "timestamp with time zone":
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, nil
+	case "varbinary", "binary":
+		return arrow.BinaryTypes.Binary, nil
+	case "decimal":
+		precision, scale := int64(38), int64(0)
+		if len(params) >= 1 {
+			precision, err = strconv.ParseInt(params[0], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid precision in %s", type_)
+			}
+		}
+		if len(params) >= 2 {
+			scale, err = strconv.ParseInt(params[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scale in %s", type_)
+			}
+		}
+		return &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)}, nil
+	case "array":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("invalid array type %s", type_)
+		}
+		elem, err := DataType(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return arrow.ListOf(elem), nil
+	case "map":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("invalid map type %s", type_)
+		}
+		key, err := DataType(params[0])
+		if err != nil {
+			return nil, err
+		}
+		item, err := DataType(params[1])
+		if err != nil {
+			return nil, err
+		}
+		return arrow.MapOf(key, item), nil
+	}
+	return arrow.BinaryTypes.String, nil
+}
+
+// splitType splits a type into the base name and the parameters, e.g. "map(varchar, array(bigint))" into "map" and
+// {"varchar", "array(bigint)"}.  The precision of a timestamp is dropped, leaving "timestamp" or "timestamp with time zone".
+func splitType(type_ string) (base string, params []string, err error) {
+	i := strings.IndexAny(type_, "(<")
+	if i < 0 {
+		return type_, nil, nil
+	}
+	base = strings.TrimSpace(type_[:i])
+	depth, start, end := 0, i+1, -1
+	for j := i; j < len(type_) && end < 0; j++ {
+		switch type_[j] {
+		case '(', '<':
+			depth++
+		case ')', '>':
+			depth--
+			if depth == 0 {
+				end = j
+			}
+		case ',':
+			if depth == 1 {
+				params = append(params, strings.TrimSpace(type_[start:j]))
+				start = j + 1
+			}
+		}
+	}
+	if end < 0 {
+		return "", nil, fmt.Errorf("unbalanced brackets in %s", type_)
+	}
+	params = append(params, strings.TrimSpace(type_[start:end]))
+	if rest := strings.TrimSpace(type_[end+1:]); rest != "" {
+		base += " " + rest
+	}
+	return base, params, nil
+}
@@ -0,0 +1,224 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tdarrow converts job results into Apache Arrow record batches and Parquet files.
+//
+// It is a separate module so that the client itself does not depend on Arrow.
+// The MessagePack result of a job is decoded as it is downloaded, and handed over in record
+// batches of Config.BatchSize rows, so the memory used stays bounded whatever the size of the result:
+//
+//	err := tdarrow.ReadJobResult(ctx, client, jobId, tdarrow.Config{}, func(rec arrow.Record) error {
+//		...
+//	})
+//
+// WriteParquet writes the whole result into a Parquet file in the same way.  See Schema for how
+// the column types are mapped.
+package tdarrow
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	td_client "github.com/treasure-data/td-client-go"
+	"github.com/ugorji/go/codec"
+)
+
+// DefaultBatchSize is the number of the rows in a record batch by default.
+const DefaultBatchSize = 8192
+
+// Config holds the options of the conversion.
+type Config struct {
+	BatchSize         int                       // (Optional) Number of the rows in a record batch. Defaults to DefaultBatchSize.
+	Allocator         memory.Allocator          // (Optional) Allocator of the record batches. Defaults to memory.DefaultAllocator.
+	ParquetProperties *parquet.WriterProperties // (Optional) Properties of the Parquet file written by WriteParquet. Defaults to Snappy compression.
+}
+
+// Reader is an array.RecordReader decoding the MessagePack stream of a job result into record batches.
+//
+// The record returned by Record is valid until the next call to Next or Release; call Retain on it to keep it longer.
+type Reader struct {
+	refs      int64
+	schema    *arrow.Schema
+	decoder   *td_client.ResultDecoder
+	dec       *codec.Decoder
+	builder   *array.RecordBuilder
+	batchSize int
+	rec       arrow.Record
+	done      bool
+	err       error
+}
+
+// NewReader creates a Reader decoding r, the result of JobResult in the msgpack format,
+// with the columns described by ShowJobResult.HiveResultSchema.
+func NewReader(r io.Reader, hiveResultSchema []interface{}, cfg Config) (*Reader, error) {
+	schema, err := Schema(hiveResultSchema)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := td_client.NewResultDecoder(hiveResultSchema)
+	if err != nil {
+		return nil, err
+	}
+	mem := cfg.Allocator
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Reader{
+		refs:      1,
+		schema:    schema,
+		decoder:   decoder,
+		dec:       codec.NewDecoder(r, &codec.MsgpackHandle{}),
+		builder:   array.NewRecordBuilder(mem, schema),
+		batchSize: batchSize,
+	}, nil
+}
+
+func (r *Reader) Retain() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+func (r *Reader) Release() {
+	if atomic.AddInt64(&r.refs, -1) == 0 {
+		if r.rec != nil {
+			r.rec.Release()
+			r.rec = nil
+		}
+		r.builder.Release()
+	}
+}
+
+func (r *Reader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next decodes the next record batch, returning false at the end of the result or on an error.
+func (r *Reader) Next() bool {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	if r.done || r.err != nil {
+		return false
+	}
+	n := 0
+	for n < r.batchSize {
+		row := (interface{})(nil)
+		err := r.dec.Decode(&row)
+		if err != nil {
+			if err == io.EOF {
+				r.done = true
+				break
+			}
+			r.err = &td_client.APIError{
+				Type:    td_client.InvalidResponseError,
+				Message: "Invalid MessagePack stream",
+				Cause:   err,
+			}
+			return false
+		}
+		err = r.appendRow(row)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		n++
+	}
+	if n == 0 {
+		return false
+	}
+	r.rec = r.builder.NewRecord()
+	return true
+}
+
+func (r *Reader) Record() arrow.Record {
+	return r.rec
+}
+
+// Err returns the error that stopped the decoding, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// ReadJobResult downloads the result of the job, passing every record batch to fn.
+// The record is released once fn returns; call Retain on it to keep it longer.
+func ReadJobResult(ctx context.Context, client *td_client.TDClient, jobId string, cfg Config, fn func(rec arrow.Record) error) error {
+	job, err := client.ShowJobContext(ctx, jobId)
+	if err != nil {
+		return err
+	}
+	return readJobResult(ctx, client, job, cfg, fn)
+}
+
+func readJobResult(ctx context.Context, client *td_client.TDClient, job *td_client.ShowJobResult, cfg Config, fn func(rec arrow.Record) error) error {
+	return client.JobResultContext(ctx, job.Id, "msgpack", func(body io.Reader) error {
+		r, err := NewReader(body, job.HiveResultSchema, cfg)
+		if err != nil {
+			return err
+		}
+		defer r.Release()
+		for r.Next() {
+			err := fn(r.Record())
+			if err != nil {
+				return err
+			}
+		}
+		return r.Err()
+	})
+}
+
+// WriteParquet downloads the result of the job into a Parquet file written to w, each record batch making a row group.
+// w is closed at the end if it is an io.Closer.
+func WriteParquet(ctx context.Context, client *td_client.TDClient, jobId string, w io.Writer, cfg Config) error {
+	job, err := client.ShowJobContext(ctx, jobId)
+	if err != nil {
+		return err
+	}
+	schema, err := Schema(job.HiveResultSchema)
+	if err != nil {
+		return err
+	}
+	props := cfg.ParquetProperties
+	if props == nil {
+		options := []parquet.WriterProperty{parquet.WithCompression(compress.Codecs.Snappy)}
+		if cfg.Allocator != nil {
+			options = append(options, parquet.WithAllocator(cfg.Allocator))
+		}
+		props = parquet.NewWriterProperties(options...)
+	}
+	fw, err := pqarrow.NewFileWriter(schema, w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return err
+	}
+	err = readJobResult(ctx, client, job, cfg, fw.Write)
+	closeErr := fw.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,158 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdarrow
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	td_client "github.com/treasure-data/td-client-go"
+	"github.com/treasure-data/td-client-go/tdtest"
+)
+
+func TestDataType(t *testing.T) {
+	for type_, expected := range map[string]string{
+		"bigint":                        "int64",
+		"INTEGER":                       "int32",
+		"real":                          "float32",
+		"varchar(10)":                   "utf8",
+		"decimal(10, 2)":                "decimal(10, 2)",
+		"timestamp(3) with time zone":   "timestamp[us, tz=UTC]",
+		"array<bigint>":                 "list<item: int64, nullable>",
+		"map(varchar, array(double))":   "map<utf8, list<item: float64, nullable>, items_nullable>",
+		"row(a bigint, b varchar)":      "utf8",
+		"struct<a:int,b:array<string>>": "utf8",
+		"date":                          "date32",
+		"varbinary":                     "binary",
+	} {
+		dt, err := DataType(type_)
+		if err != nil {
+			t.Errorf("%s: %s", type_, err.Error())
+			continue
+		}
+		if dt.String() != expected {
+			t.Errorf("%s: unexpected type %s", type_, dt.String())
+		}
+	}
+	if _, err := DataType("array(bigint"); err == nil {
+		t.Fatal("expected error for the unbalanced brackets")
+	}
+}
+
+func newJob(t *testing.T) (*td_client.TDClient, string) {
+	server := tdtest.NewServer()
+	t.Cleanup(server.Close)
+	server.HandleQuery = func(job *tdtest.Job) {
+		job.Schema = [][2]string{
+			{"id", "bigint"},
+			{"name", "varchar"},
+			{"score", "double"},
+			{"price", "decimal(10,2)"},
+			{"tags", "array<varchar>"},
+			{"attrs", "map<varchar,bigint>"},
+			{"created_at", "timestamp"},
+		}
+		job.Rows = [][]interface{}{
+			{1, "alice", 1.5, "12.34", []interface{}{"x", "y"}, map[string]interface{}{"k": 1}, "2020-01-02 03:04:05.678"},
+			{2, nil, nil, nil, `["z"]`, `{"a":2,"b":3}`, nil},
+			{3, "carol", 2, "0.10", nil, nil, "2020-01-03 00:00:00.000"},
+		}
+	}
+	client, err := td_client.NewTDClient(server.Settings())
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	err = client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	jobId, err := client.SubmitQuery("db", td_client.Query{Type: "presto", Query: "SELECT * FROM t"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.WaitJob(jobId, &td_client.WaitJobOptions{Polling: &td_client.ConstantPolling{Interval: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	return client, jobId
+}
+
+func TestReadJobResult(t *testing.T) {
+	client, jobId := newJob(t)
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+	rows := []int64{}
+	err := ReadJobResult(context.Background(), client, jobId, Config{BatchSize: 2, Allocator: mem}, func(rec arrow.Record) error {
+		rows = append(rows, rec.NumRows())
+		if rec.Column(0).(*array.Int64).Value(0) == 1 {
+			if s := rec.Column(1).(*array.String).Value(0); s != "alice" {
+				t.Errorf("unexpected name: %s", s)
+			}
+			if !rec.Column(1).IsNull(1) || !rec.Column(3).IsNull(1) {
+				t.Error("NULL is not preserved")
+			}
+			if s := rec.Column(3).(*array.Decimal128).ValueStr(0); s != "12.34" {
+				t.Errorf("unexpected price: %s", s)
+			}
+			if s := rec.Column(4).(*array.List).String(); s != `[["x" "y"] ["z"]]` {
+				t.Errorf("unexpected tags: %s", s)
+			}
+			if s := rec.Column(5).(*array.Map).String(); s != `[{["k"] [1]} {["a" "b"] [2 3]}]` {
+				t.Errorf("unexpected attrs: %s", s)
+			}
+			ts := rec.Column(6).(*array.Timestamp).Value(0).ToTime(arrow.Microsecond)
+			if !ts.Equal(time.Date(2020, 1, 2, 3, 4, 5, 678000000, time.UTC)) {
+				t.Errorf("unexpected created_at: %s", ts)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(rows) != 2 || rows[0] != 2 || rows[1] != 1 {
+		t.Fatalf("unexpected batches: %v", rows)
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	client, jobId := newJob(t)
+	b := bytes.Buffer{}
+	err := WriteParquet(context.Background(), client, jobId, &b, Config{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(b.Bytes()), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer table.Release()
+	if table.NumRows() != 3 || table.NumCols() != 7 {
+		t.Fatalf("unexpected table: %d rows, %d columns", table.NumRows(), table.NumCols())
+	}
+	if tz := table.Schema().Field(6).Type.(*arrow.TimestampType); tz.Unit != arrow.Microsecond {
+		t.Fatalf("unexpected type: %s", tz)
+	}
+}
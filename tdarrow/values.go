@@ -0,0 +1,315 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdarrow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+func (r *Reader) appendRow(row interface{}) error {
+	cells, ok := row.([]interface{})
+	if !ok {
+		return fmt.Errorf("row is not an array: %T", row)
+	}
+	if len(cells) != len(r.decoder.Columns) {
+		return fmt.Errorf("row has %d columns while the schema has %d", len(cells), len(r.decoder.Columns))
+	}
+	for i, cell := range cells {
+		err := appendValue(r.builder.Field(i), r.decoder.Value(i, cell))
+		if err != nil {
+			c := r.decoder.Columns[i]
+			return fmt.Errorf("column %s (%s): %s", c.Name, c.Type, err.Error())
+		}
+	}
+	return nil
+}
+
+// appendValue appends the value, as normalized by ResultDecoder.Value, to the builder.
+func appendValue(b array.Builder, v interface{}) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int8Builder:
+		i, err := toInt(v, math.MinInt8, math.MaxInt8)
+		if err != nil {
+			return err
+		}
+		b.Append(int8(i))
+	case *array.Int16Builder:
+		i, err := toInt(v, math.MinInt16, math.MaxInt16)
+		if err != nil {
+			return err
+		}
+		b.Append(int16(i))
+	case *array.Int32Builder:
+		i, err := toInt(v, math.MinInt32, math.MaxInt32)
+		if err != nil {
+			return err
+		}
+		b.Append(int32(i))
+	case *array.Int64Builder:
+		i, err := toInt(v, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		b.Append(i)
+	case *array.Float32Builder:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		b.Append(float32(f))
+	case *array.Float64Builder:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+	case *array.BooleanBuilder:
+		switch v := v.(type) {
+		case bool:
+			b.Append(v)
+		case string:
+			x, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			b.Append(x)
+		default:
+			return fmt.Errorf("cannot convert %T to boolean", v)
+		}
+	case *array.StringBuilder:
+		s, err := toText(v)
+		if err != nil {
+			return err
+		}
+		b.Append(s)
+	case *array.BinaryBuilder:
+		switch v := v.(type) {
+		case []byte:
+			b.Append(v)
+		case string:
+			b.AppendString(v)
+		default:
+			return fmt.Errorf("cannot convert %T to binary", v)
+		}
+	case *array.Decimal128Builder:
+		s, err := toText(v)
+		if err != nil {
+			return err
+		}
+		dt := b.Type().(*arrow.Decimal128Type)
+		n, err := decimal128.FromString(s, dt.Precision, dt.Scale)
+		if err != nil {
+			return err
+		}
+		b.Append(n)
+	case *array.Date32Builder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		b.Append(arrow.Date32FromTime(t))
+	case *array.TimestampBuilder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		ts, err := arrow.TimestampFromTime(t, b.Type().(*arrow.TimestampType).Unit)
+		if err != nil {
+			return err
+		}
+		b.Append(ts)
+	case *array.MapBuilder:
+		m, err := toMap(v)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.Append(true)
+		for _, k := range keys {
+			err := appendValue(b.KeyBuilder(), k)
+			if err != nil {
+				return fmt.Errorf("key %s: %s", k, err.Error())
+			}
+			err = appendValue(b.ItemBuilder(), m[k])
+			if err != nil {
+				return fmt.Errorf("[%s]: %s", k, err.Error())
+			}
+		}
+	case *array.ListBuilder:
+		elems, err := toList(v)
+		if err != nil {
+			return err
+		}
+		b.Append(true)
+		for i, e := range elems {
+			err := appendValue(b.ValueBuilder(), e)
+			if err != nil {
+				return fmt.Errorf("[%d]: %s", i, err.Error())
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
+
+func toInt(v interface{}, min int64, max int64) (int64, error) {
+	var i int64
+	switch v := v.(type) {
+	case int64:
+		i = v
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", v)
+		}
+		i = int64(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%g is not an integer", v)
+		}
+		i = int64(v)
+	case json.Number:
+		return toInt(string(v), min, max)
+	case string:
+		var err error
+		i, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("cannot convert %T to an integer", v)
+	}
+	if i < min || i > max {
+		return 0, fmt.Errorf("%d is out of range", i)
+	}
+	return i, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to a float", v)
+}
+
+// toText renders the value as a string, complex values as JSON.
+func toText(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// toTime converts a time string as returned by Hive and Presto, or the UNIX time.
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case string:
+		return td_client.ParseResultTime(v)
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case uint64:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", v)
+}
+
+// decodeJSON parses the JSON text Hive returns for complex types.
+func decodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	retval := (interface{})(nil)
+	err := dec.Decode(&retval)
+	return retval, err
+}
+
+func toList(v interface{}) ([]interface{}, error) {
+	if s, ok := v.(string); ok {
+		js, err := decodeJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		v = js
+	}
+	if l, ok := v.([]interface{}); ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a list", v)
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	if s, ok := v.(string); ok {
+		js, err := decodeJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		v = js
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a map", v)
+}
@@ -0,0 +1,249 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tdotel instruments TDClient with OpenTelemetry tracing and metrics.
+//
+// It is a separate module so that the client itself does not depend on OpenTelemetry.
+// The instrumentation is an Interceptor added to the settings of the client:
+//
+//	interceptor, err := tdotel.NewInterceptor(tdotel.Config{})
+//	settings.Interceptors = append(settings.Interceptors, interceptor)
+//
+// Every attempt to send a request of an API call is recorded as a client span named after
+// the operation, e.g. "td.SubmitQuery", carrying the database, table and job id found in the
+// request path, the HTTP status, the size of the uploaded body of Import and
+// UploadBulkImportPart, and the number of rows decoded by JobResultEach and Tail.
+// The span ends when the response body is closed, so it covers the download of the result.
+// The W3C trace context of the span is injected into the request headers.
+//
+// The following metrics are recorded, each with the td.operation attribute:
+//
+//	td.client.request.duration  histogram of the time taken by a request in seconds
+//	td.client.request.retries   number of the requests retried under the retry policy
+//	td.client.request.errors    number of the failed requests by error.type, which is the
+//	                            name of the APIError type the API call returned, or
+//	                            TransportError for a request failed without a response
+package tdotel
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/treasure-data/td-client-go/tdotel"
+
+// Attribute keys set on the spans and the metrics.
+const (
+	OperationKey  = attribute.Key("td.operation")
+	DatabaseKey   = attribute.Key("td.database")
+	TableKey      = attribute.Key("td.table")
+	JobIdKey      = attribute.Key("td.job_id")
+	BulkImportKey = attribute.Key("td.bulk_import")
+	ScheduleKey   = attribute.Key("td.schedule")
+	AttemptKey    = attribute.Key("td.attempt")
+	RowsKey       = attribute.Key("td.rows")
+	MethodKey     = attribute.Key("http.request.method")
+	StatusCodeKey = attribute.Key("http.response.status_code")
+	BodySizeKey   = attribute.Key("http.request.body.size")
+	ServerAddrKey = attribute.Key("server.address")
+	ErrorTypeKey  = attribute.Key("error.type")
+)
+
+// transportError is the error.type of the requests that failed without a response.
+const transportError = "TransportError"
+
+// Config stores the providers used by the instrumentation.  The global ones are used for those left nil.
+type Config struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	Propagator     propagation.TextMapPropagator
+}
+
+type instrumentation struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	duration   metric.Float64Histogram
+	retries    metric.Int64Counter
+	errors     metric.Int64Counter
+}
+
+// NewInterceptor creates the Interceptor recording the spans and the metrics of the requests.
+func NewInterceptor(cfg Config) (td_client.Interceptor, error) {
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	if cfg.Propagator == nil {
+		cfg.Propagator = otel.GetTextMapPropagator()
+	}
+	meter := cfg.MeterProvider.Meter(instrumentationName)
+	duration, err := meter.Float64Histogram(
+		"td.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time taken by a request to the Treasure Data API, including the transfer of the response body."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	retries, err := meter.Int64Counter(
+		"td.client.request.retries",
+		metric.WithDescription("Number of the requests to the Treasure Data API retried after a transient failure."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter(
+		"td.client.request.errors",
+		metric.WithDescription("Number of the failed requests to the Treasure Data API."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	i := &instrumentation{
+		tracer:     cfg.TracerProvider.Tracer(instrumentationName),
+		propagator: cfg.Propagator,
+		duration:   duration,
+		retries:    retries,
+		errors:     errors,
+	}
+	return i.intercept, nil
+}
+
+func (i *instrumentation) intercept(next td_client.RoundTripFunc) td_client.RoundTripFunc {
+	return func(operation string, req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		attempt := td_client.RequestAttempt(ctx)
+		attrs := append([]attribute.KeyValue{
+			OperationKey.String(operation),
+			MethodKey.String(req.Method),
+			ServerAddrKey.String(req.URL.Hostname()),
+			AttemptKey.Int(attempt),
+		}, pathAttributes(req.URL.Path)...)
+		if req.Method == "PUT" && req.ContentLength > 0 {
+			attrs = append(attrs, BodySizeKey.Int64(req.ContentLength))
+		}
+		ctx, span := i.tracer.Start(ctx, "td."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		req = req.WithContext(ctx)
+		i.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		op := metric.WithAttributes(OperationKey.String(operation))
+		if attempt > 1 {
+			i.retries.Add(ctx, 1, op)
+		}
+		startedAt := time.Now()
+		resp, err := next(operation, req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			i.errors.Add(ctx, 1, metric.WithAttributes(OperationKey.String(operation), ErrorTypeKey.String(transportError)))
+			i.duration.Record(ctx, time.Since(startedAt).Seconds(), op)
+			span.End()
+			return nil, err
+		}
+		span.SetAttributes(StatusCodeKey.Int(resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		resp.Body = &spanBody{
+			ReadCloser: resp.Body,
+			end: func() {
+				if rows, ok := td_client.DecodedRows(ctx); ok {
+					span.SetAttributes(RowsKey.Int64(rows))
+				}
+				// the API call has built the error from the response before closing the body.
+				if apiErr := td_client.RequestError(ctx); apiErr != nil {
+					span.SetAttributes(ErrorTypeKey.String(apiErr.TypeName()))
+					span.SetStatus(codes.Error, apiErr.Error())
+					i.errors.Add(ctx, 1, metric.WithAttributes(OperationKey.String(operation), ErrorTypeKey.String(apiErr.TypeName())))
+				}
+				i.duration.Record(ctx, time.Since(startedAt).Seconds(), op)
+				span.End()
+			},
+		}
+		return resp, nil
+	}
+}
+
+// spanBody ends the span when the response body is closed.
+type spanBody struct {
+	io.ReadCloser
+	once sync.Once
+	end  func()
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.end)
+	return err
+}
+
+// pathAttributes extracts the names of the resources from the request path, e.g. /v3/table/show/DB/TABLE.
+func pathAttributes(path string) []attribute.KeyValue {
+	segments := strings.Split(strings.TrimPrefix(path, "/v3/"), "/")
+	for i, s := range segments {
+		if v, err := url.QueryUnescape(s); err == nil {
+			segments[i] = v
+		}
+	}
+	if len(segments) < 3 {
+		return nil
+	}
+	category, action, args := segments[0], segments[1], segments[2:]
+	switch category {
+	case "table":
+		if len(args) >= 2 {
+			return []attribute.KeyValue{DatabaseKey.String(args[0]), TableKey.String(args[1])}
+		}
+		return []attribute.KeyValue{DatabaseKey.String(args[0])}
+	case "database":
+		return []attribute.KeyValue{DatabaseKey.String(args[0])}
+	case "job":
+		if action == "issue" {
+			if len(args) >= 2 {
+				return []attribute.KeyValue{DatabaseKey.String(args[1])}
+			}
+			return nil
+		}
+		return []attribute.KeyValue{JobIdKey.String(args[0])}
+	case "export":
+		if len(args) >= 2 {
+			return []attribute.KeyValue{DatabaseKey.String(args[0]), TableKey.String(args[1])}
+		}
+	case "bulk_import":
+		if action == "create" && len(args) >= 3 {
+			return []attribute.KeyValue{BulkImportKey.String(args[0]), DatabaseKey.String(args[1]), TableKey.String(args[2])}
+		}
+		return []attribute.KeyValue{BulkImportKey.String(args[0])}
+	case "schedule":
+		return []attribute.KeyValue{ScheduleKey.String(args[0])}
+	}
+	return nil
+}
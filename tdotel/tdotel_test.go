@@ -0,0 +1,233 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdotel
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+	"github.com/treasure-data/td-client-go/tdtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// counterValues sums the data points of the counter by the value of the attribute.
+func counterValues(t *testing.T, reader sdkmetric.Reader, name string, key attribute.Key) map[string]int64 {
+	rm := metricdata.ResourceMetrics{}
+	err := reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	retval := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				v, _ := dp.Attributes.Value(key)
+				retval[v.AsString()] += dp.Value
+			}
+		}
+	}
+	return retval
+}
+
+func TestInterceptor(t *testing.T) {
+	server := tdtest.NewServer()
+	defer server.Close()
+	recorder := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	interceptor, err := NewInterceptor(Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		Propagator:     propagation.TraceContext{},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	traceparents := []string{}
+	failures := 1
+	settings := server.Settings()
+	settings.Retry = &td_client.RetryPolicy{BaseBackoff: time.Millisecond, Jitter: -1}
+	settings.Interceptors = []td_client.Interceptor{
+		interceptor,
+		func(next td_client.RoundTripFunc) td_client.RoundTripFunc {
+			return func(operation string, req *http.Request) (*http.Response, error) {
+				traceparents = append(traceparents, req.Header.Get("traceparent"))
+				if operation == "ServerStatus" && failures > 0 {
+					failures--
+					return nil, syscall.ECONNRESET
+				}
+				if operation == "ListDatabases" {
+					// a broken body on 200 makes the API call fail with InvalidResponseError.
+					return &http.Response{
+						Status: "200 OK", StatusCode: 200,
+						Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+						Header: http.Header{"Content-Type": {"application/json"}},
+						Body:   ioutil.NopCloser(strings.NewReader("{")),
+					}, nil
+				}
+				return next(operation, req)
+			}
+		},
+	}
+	client, err := td_client.NewTDClient(settings)
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+
+	_, err = client.ServerStatus()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.CreateLogTable("db", "t")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	var partSize int64
+	w := client.NewRecordWriter(nil, func(part td_client.Blob, n int) error {
+		partSize, _ = part.Size()
+		_, err := client.Import("db", "t", "msgpack.gz", part, "")
+		return err
+	})
+	for i := 0; i < 3; i++ {
+		err = w.Write(map[string]interface{}{"i": i, "time": 1420070400})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.Tail("db", "t", 0, time.Time{}, time.Time{}, func(interface{}) error { return nil })
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.ShowJob("12345")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	_, err = client.ListDatabases()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	spans := recorder.Ended()
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	if len(spans) != 8 {
+		t.Fatalf("unexpected spans: %v", names)
+	}
+	for i, span := range spans {
+		if traceparents[i] == "" || traceparents[i][36:52] != span.SpanContext().SpanID().String() {
+			t.Errorf("%s: trace context not propagated: %q", span.Name(), traceparents[i])
+		}
+	}
+	if spans[0].Name() != "td.ServerStatus" || spans[0].Status().Code != codes.Error {
+		t.Errorf("unexpected span: %s %v", spans[0].Name(), spans[0].Status())
+	}
+	if v, _ := spanAttribute(spans[1], AttemptKey); v.AsInt64() != 2 {
+		t.Errorf("unexpected attempt: %v", v.AsInt64())
+	}
+	imp := spans[4]
+	if v, _ := spanAttribute(imp, TableKey); imp.Name() != "td.Import" || v.AsString() != "t" {
+		t.Errorf("unexpected span: %s %s", imp.Name(), v.AsString())
+	}
+	if v, _ := spanAttribute(imp, BodySizeKey); v.AsInt64() != partSize {
+		t.Errorf("unexpected body size: %d", v.AsInt64())
+	}
+	tail := spans[5]
+	if v, _ := spanAttribute(tail, RowsKey); tail.Name() != "td.Tail" || v.AsInt64() != 3 {
+		t.Errorf("unexpected span: %s %d", tail.Name(), v.AsInt64())
+	}
+	show := spans[6]
+	if v, _ := spanAttribute(show, JobIdKey); v.AsString() != "12345" {
+		t.Errorf("unexpected job id: %s", v.AsString())
+	}
+	if v, _ := spanAttribute(show, StatusCodeKey); v.AsInt64() != 404 || show.Status().Code != codes.Error {
+		t.Errorf("unexpected status: %d", v.AsInt64())
+	}
+	if v, _ := spanAttribute(spans[7], ErrorTypeKey); v.AsString() != "InvalidResponseError" || spans[7].Status().Code != codes.Error {
+		t.Errorf("unexpected error type: %s", v.AsString())
+	}
+
+	retries := counterValues(t, reader, "td.client.request.retries", OperationKey)
+	if len(retries) != 1 || retries["ServerStatus"] != 1 {
+		t.Errorf("unexpected retries: %v", retries)
+	}
+	errorTypes := counterValues(t, reader, "td.client.request.errors", ErrorTypeKey)
+	if len(errorTypes) != 3 || errorTypes["TransportError"] != 1 || errorTypes["NotFoundError"] != 1 || errorTypes["InvalidResponseError"] != 1 {
+		t.Errorf("unexpected errors: %v", errorTypes)
+	}
+}
+
+func TestPathAttributes(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []attribute.KeyValue
+	}{
+		{"/v3/system/server_status", nil},
+		{"/v3/job/issue/presto/db", []attribute.KeyValue{DatabaseKey.String("db")}},
+		{"/v3/job/result/123", []attribute.KeyValue{JobIdKey.String("123")}},
+		{"/v3/table/import_with_id/db/t/uid/msgpack.gz", []attribute.KeyValue{DatabaseKey.String("db"), TableKey.String("t")}},
+		{"/v3/bulk_import/create/bi/db/t", []attribute.KeyValue{BulkImportKey.String("bi"), DatabaseKey.String("db"), TableKey.String("t")}},
+		{"/v3/bulk_import/upload_part/bi/p1", []attribute.KeyValue{BulkImportKey.String("bi")}},
+		{"/v3/schedule/run/a+b/now", []attribute.KeyValue{ScheduleKey.String("a b")}},
+	}
+	for _, test := range tests {
+		actual := pathAttributes(test.path)
+		if len(actual) != len(test.expected) {
+			t.Errorf("%s: unexpected attributes %v", test.path, actual)
+			continue
+		}
+		for i := range actual {
+			if actual[i] != test.expected[i] {
+				t.Errorf("%s: unexpected attributes %v", test.path, actual)
+			}
+		}
+	}
+}
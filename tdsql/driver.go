@@ -0,0 +1,183 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tdsql provides a database/sql driver for Treasure Data, registered as "td":
+//
+//	db, err := sql.Open("td", "td://1234%2Fabcdef@api.treasuredata.com/sample_datasets?engine=presto")
+//
+// Every query is issued as a job through SubmitQuery, and the rows are streamed from the
+// MessagePack result of the job once it has succeeded.  The columns are named and typed after
+// the `hive_result_schema` of the job.  A job that finished with `error` or `killed` status is
+// reported as *td_client.JobError.
+//
+// The `?` placeholders are replaced with the literals of the arguments before the query is
+// issued, escaped according to the engine.  Named arguments and transactions are not supported.
+package tdsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+func init() {
+	sql.Register("td", &Driver{})
+}
+
+// Driver is the database/sql driver for Treasure Data.
+type Driver struct{}
+
+// Open opens a connection to the data source named as described in ParseDSN.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+// OpenConnector parses the data source name as described in ParseDSN.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(*cfg)
+}
+
+type connector struct {
+	client *td_client.TDClient
+	cfg    Config
+}
+
+// NewConnector creates a driver.Connector for sql.OpenDB from the configuration.
+func NewConnector(cfg Config) (driver.Connector, error) {
+	if cfg.Database == "" {
+		return nil, errors.New("no database specified")
+	}
+	if cfg.Engine != "" && cfg.Engine != Presto && cfg.Engine != Hive {
+		return nil, errors.New("unsupported engine: " + cfg.Engine)
+	}
+	client, err := td_client.NewTDClient(cfg.Settings)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{client: client, cfg: cfg}, nil
+}
+
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	return &conn{client: c.client, cfg: &c.cfg}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// conn holds no server-side state; every query is an independent job.
+type conn struct {
+	client *td_client.TDClient
+	cfg    *Config
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+// run issues the query and waits for the job to succeed.
+func (c *conn) run(ctx context.Context, query string, args []driver.NamedValue) (*td_client.ShowJobResult, error) {
+	engine := c.cfg.engine()
+	query, err := interpolate(query, engine, args)
+	if err != nil {
+		return nil, err
+	}
+	jobId, err := c.client.SubmitQueryContext(ctx, c.cfg.Database, td_client.Query{
+		Type:       engine,
+		Query:      query,
+		Priority:   -1,
+		RetryLimit: -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.client.WaitJobContext(ctx, jobId, &td_client.WaitJobOptions{Polling: c.cfg.Polling})
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	job, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(ctx, c.client, job)
+}
+
+// ExecContext issues the query and reports the number of records of the job as the rows affected.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	job, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(job.NumRecords), nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return len(placeholders(s.query, s.conn.cfg.engine()))
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	retval := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		retval[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return retval
+}
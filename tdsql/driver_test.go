@@ -0,0 +1,221 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+	"github.com/treasure-data/td-client-go/tdtest"
+)
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("td://1234%2Fabcdef@api.treasuredata.co.jp:8443/sample_datasets?engine=hive&poll_interval=2s")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if cfg.Settings.ApiKey != "1234/abcdef" || cfg.Database != "sample_datasets" || cfg.Engine != Hive || cfg.Settings.Port != 8443 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.Settings.Router.Route("/v3/job/list") != "api.treasuredata.co.jp" {
+		t.Fatalf("unexpected router: %+v", cfg.Settings.Router)
+	}
+	if cfg.Polling.Next(1) != 2*time.Second {
+		t.Fatalf("unexpected polling: %+v", cfg.Polling)
+	}
+	cfg, err = ParseDSN("td://@/db?apikey=1234/abcdef")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if cfg.Settings.ApiKey != "1234/abcdef" || cfg.Settings.Router != nil || cfg.engine() != Presto {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	for _, dsn := range []string{
+		"mysql://key@host/db",
+		"td://host/db",
+		"td://key@host/",
+		"td://key@host/db?engine=spark",
+		"td://key@host/db?poll_interval=x",
+	} {
+		if _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("expected error for %s", dsn)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	args := func(values ...driver.Value) []driver.NamedValue {
+		return namedValues(values)
+	}
+	tests := []struct {
+		engine   string
+		query    string
+		args     []driver.NamedValue
+		expected string
+	}{
+		{Presto, "SELECT 1", nil, "SELECT 1"},
+		{Presto, "SELECT * FROM t WHERE a = ? AND b = ?", args(int64(1), "it's"), "SELECT * FROM t WHERE a = 1 AND b = 'it''s'"},
+		{Presto, "SELECT '?', \"?\" -- ?\n, ? /* ? */", args(nil), "SELECT '?', \"?\" -- ?\n, NULL /* ? */"},
+		{Presto, "SELECT ?, ?, ?", args(true, 1.5, []byte{0xde, 0xad}), "SELECT TRUE, 1.5, X'dead'"},
+		{Presto, "SELECT ?", args(time.Date(2015, 1, 2, 12, 0, 0, 0, time.FixedZone("JST", 9*3600))), "SELECT TIMESTAMP '2015-01-02 03:00:00.000'"},
+		{Hive, "SELECT 'it\\'s?', ?", args(`a'b\c`), `SELECT 'it\'s?', 'a\'b\\c'`},
+		{Hive, "SELECT `?`, ?", args([]byte("A")), "SELECT `?`, unhex('41')"},
+	}
+	for _, test := range tests {
+		actual, err := interpolate(test.query, test.engine, test.args)
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err.Error())
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+	}
+	if _, err := interpolate("SELECT ?", Presto, nil); err == nil {
+		t.Error("expected error for missing argument")
+	}
+	if _, err := interpolate("SELECT ?", Presto, []driver.NamedValue{{Name: "a", Ordinal: 1, Value: int64(1)}}); err == nil {
+		t.Error("expected error for named argument")
+	}
+}
+
+func openTestDB(t *testing.T, server *tdtest.Server) *sql.DB {
+	client, err := td_client.NewTDClient(server.Settings())
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	err = client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	connector, err := NewConnector(Config{
+		Settings: server.Settings(),
+		Database: "db",
+		Polling:  &td_client.ConstantPolling{Interval: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to create connector: %s", err.Error())
+	}
+	return sql.OpenDB(connector)
+}
+
+func TestQuery(t *testing.T) {
+	server := tdtest.NewServer()
+	defer server.Close()
+	server.HandleQuery = func(job *tdtest.Job) {
+		if job.Query == "SELECT broken" {
+			job.Statuses = []string{"running", "error"}
+			job.StdErr = "syntax error"
+			return
+		}
+		job.Schema = [][2]string{{"name", "varchar"}, {"cnt", "bigint"}, {"time", "timestamp"}, {"tags", "array(varchar)"}}
+		job.Rows = [][]interface{}{
+			{"a", 1, "2015-01-01 00:00:00.000", []interface{}{"x"}},
+			{job.Query, nil, nil, nil},
+		}
+	}
+	db := openTestDB(t, server)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name, cnt FROM t WHERE name = ?", "o'clock")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(columns) != 4 || columns[1].Name() != "cnt" || columns[1].DatabaseTypeName() != "BIGINT" || columns[2].ScanType().String() != "time.Time" {
+		t.Fatalf("unexpected columns: %+v", columns)
+	}
+	var (
+		name string
+		cnt  sql.NullInt64
+		ts   *time.Time
+		tags sql.NullString
+	)
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	err = rows.Scan(&name, &cnt, &ts, &tags)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if name != "a" || cnt.Int64 != 1 || !ts.Equal(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)) || tags.String != `["x"]` {
+		t.Fatalf("unexpected row: %s %v %v %v", name, cnt, ts, tags)
+	}
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	err = rows.Scan(&name, &cnt, &ts, &tags)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if name != "SELECT name, cnt FROM t WHERE name = 'o''clock'" || cnt.Valid || ts != nil || tags.Valid {
+		t.Fatalf("unexpected row: %s %v %v %v", name, cnt, ts, tags)
+	}
+	if rows.Next() {
+		t.Fatal("too many rows")
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err().Error())
+	}
+
+	_, err = db.Query("SELECT broken")
+	if jobErr, ok := err.(*td_client.JobError); !ok || jobErr.StdErr != "syntax error" {
+		t.Fatalf("expected JobError, got %v", err)
+	}
+
+	result, err := db.Exec("INSERT INTO t SELECT 1")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if n, _ := result.RowsAffected(); n != 2 {
+		t.Fatalf("unexpected rows affected: %d", n)
+	}
+}
+
+func TestQueryCloseEarly(t *testing.T) {
+	server := tdtest.NewServer()
+	defer server.Close()
+	server.HandleQuery = func(job *tdtest.Job) {
+		job.Schema = [][2]string{{"n", "bigint"}}
+		for i := 0; i < 10000; i++ {
+			job.Rows = append(job.Rows, []interface{}{i})
+		}
+	}
+	db := openTestDB(t, server)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT n FROM t")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if !rows.Next() {
+		t.Fatalf("no rows: %v", rows.Err())
+	}
+	err = rows.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,108 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdsql
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+const (
+	Presto = "presto"
+	Hive   = "hive"
+)
+
+// Config stores the parameters of the connections made by the driver.
+type Config struct {
+	Settings td_client.Settings        // Settings of the underlying TDClient.
+	Database string                    // Database the queries are issued against.
+	Engine   string                    // (Optional) Presto or Hive. Presto is used if empty.
+	Polling  td_client.PollingStrategy // (Optional) Polling schedule of the job status. td_client.DefaultPolling is used if nil.
+}
+
+// ParseDSN parses the data source name of the form
+//
+//	td://APIKEY@ENDPOINT[:PORT]/DATABASE[?engine=presto|hive][&poll_interval=DURATION]
+//
+// The slash in the API key must be escaped as %2F, or the key can be given as the apikey parameter instead.
+// The endpoint may be omitted, e.g. td://APIKEY@/DATABASE, to use td_client.DefaultRouter.
+func ParseDSN(dsn string) (*Config, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "td" {
+		return nil, fmt.Errorf("unsupported scheme %q in DSN", u.Scheme)
+	}
+	cfg := &Config{
+		Database: strings.TrimPrefix(u.Path, "/"),
+	}
+	if cfg.Database == "" || strings.Contains(cfg.Database, "/") {
+		return nil, fmt.Errorf("invalid database %q in DSN", u.Path)
+	}
+	if u.User != nil {
+		cfg.Settings.ApiKey = u.User.Username()
+	}
+	params := u.Query()
+	if v := params.Get("apikey"); v != "" {
+		cfg.Settings.ApiKey = v
+	}
+	if cfg.Settings.ApiKey == "" {
+		return nil, errors.New("no API key in DSN")
+	}
+	if u.Host != "" {
+		host, port := u.Host, ""
+		if h, p, err := net.SplitHostPort(u.Host); err == nil {
+			host, port = h, p
+		}
+		cfg.Settings.Router = &td_client.FixedEndpointRouter{Endpoint: host}
+		if port != "" {
+			cfg.Settings.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q in DSN", port)
+			}
+		}
+	}
+	cfg.Engine = params.Get("engine")
+	if cfg.Engine != "" && cfg.Engine != Presto && cfg.Engine != Hive {
+		return nil, fmt.Errorf("unsupported engine %q in DSN", cfg.Engine)
+	}
+	if v := params.Get("poll_interval"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid poll_interval %q in DSN", v)
+		}
+		cfg.Polling = &td_client.ConstantPolling{Interval: interval}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) engine() string {
+	if cfg.Engine == "" {
+		return Presto
+	}
+	return cfg.Engine
+}
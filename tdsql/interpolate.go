@@ -0,0 +1,126 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdsql
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholders returns the offsets of the `?` placeholders in the query,
+// skipping those in string literals, quoted identifiers and comments.
+func placeholders(query string, engine string) []int {
+	retval := []int{}
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '?':
+			retval = append(retval, i)
+		case '\'', '"', '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				// Hive allows escaping the quote with a backslash; Presto doubles it, which is just two adjacent literals here.
+				if query[i] == '\\' && engine == Hive {
+					i++
+				}
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				for i < len(query) && query[i] != '\n' {
+					i++
+				}
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				end := strings.Index(query[i+2:], "*/")
+				if end < 0 {
+					return retval
+				}
+				i += end + 3
+			}
+		}
+	}
+	return retval
+}
+
+// interpolate replaces the placeholders in the query with the literals of the arguments.
+func interpolate(query string, engine string, args []driver.NamedValue) (string, error) {
+	offsets := placeholders(query, engine)
+	if len(offsets) != len(args) {
+		return "", fmt.Errorf("query has %d placeholders while %d arguments are given", len(offsets), len(args))
+	}
+	if len(args) == 0 {
+		return query, nil
+	}
+	b := strings.Builder{}
+	prev := 0
+	for i, offset := range offsets {
+		if args[i].Name != "" {
+			return "", errors.New("named arguments are not supported")
+		}
+		literal, err := quote(args[i].Value, engine)
+		if err != nil {
+			return "", fmt.Errorf("argument %d: %s", args[i].Ordinal, err.Error())
+		}
+		b.WriteString(query[prev:offset])
+		b.WriteString(literal)
+		prev = offset + 1
+	}
+	b.WriteString(query[prev:])
+	return b.String(), nil
+}
+
+func quoteString(s string, engine string) string {
+	if engine == Hive {
+		s = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+	} else {
+		s = strings.Replace(s, `'`, `''`, -1)
+	}
+	return "'" + s + "'"
+}
+
+// quote renders the value as an SQL literal of the engine.
+func quote(v driver.Value, engine string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case string:
+		return quoteString(v, engine), nil
+	case []byte:
+		if engine == Hive {
+			return "unhex('" + hex.EncodeToString(v) + "')", nil
+		}
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		return "TIMESTAMP '" + v.UTC().Format("2006-01-02 15:04:05.000") + "'", nil
+	}
+	return "", fmt.Errorf("unsupported type %T", v)
+}
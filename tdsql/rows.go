@@ -0,0 +1,195 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+	"github.com/ugorji/go/codec"
+)
+
+// rows streams the MessagePack result of the job, which is downloaded by a goroutine into a pipe.
+type rows struct {
+	decoder *td_client.ResultDecoder
+	body    *io.PipeReader
+	stream  *codec.Decoder
+	cancel  context.CancelFunc
+	done    chan error
+	err     error
+}
+
+func newRows(ctx context.Context, client *td_client.TDClient, job *td_client.ShowJobResult) (*rows, error) {
+	decoder, err := td_client.NewResultDecoder(job.HiveResultSchema)
+	if err != nil {
+		return nil, &td_client.APIError{
+			Type:    td_client.InvalidResponseError,
+			Message: "Invalid result schema",
+			Cause:   err,
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	r := &rows{
+		decoder: decoder,
+		body:    pr,
+		stream:  codec.NewDecoder(pr, &codec.MsgpackHandle{}),
+		cancel:  cancel,
+		done:    make(chan error, 1),
+	}
+	go func() {
+		err := client.JobResultContext(ctx, job.Id, "msgpack", func(body io.Reader) error {
+			_, err := io.Copy(pw, body)
+			return err
+		})
+		pw.CloseWithError(err)
+		r.done <- err
+	}()
+	return r, nil
+}
+
+func (r *rows) Columns() []string {
+	retval := make([]string, len(r.decoder.Columns))
+	for i, c := range r.decoder.Columns {
+		retval[i] = c.Name
+	}
+	return retval
+}
+
+// wait stops the download and returns its error.
+func (r *rows) wait() error {
+	if r.done != nil {
+		r.cancel()
+		r.body.Close()
+		r.err = <-r.done
+		r.done = nil
+	}
+	return r.err
+}
+
+func (r *rows) Close() error {
+	r.wait()
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done == nil {
+		return io.EOF
+	}
+	row := (interface{})(nil)
+	err := r.stream.Decode(&row)
+	if err != nil {
+		downloadErr := r.wait()
+		if err == io.EOF {
+			return io.EOF
+		}
+		if downloadErr != nil {
+			return downloadErr
+		}
+		return &td_client.APIError{
+			Type:    td_client.InvalidResponseError,
+			Message: "Invalid MessagePack stream",
+			Cause:   err,
+		}
+	}
+	cells, ok := row.([]interface{})
+	if !ok || len(cells) != len(r.decoder.Columns) {
+		r.wait()
+		return fmt.Errorf("row does not match the result schema: %v", row)
+	}
+	for i, cell := range cells {
+		dest[i], err = driverValue(r.decoder.Columns[i], r.decoder.Value(i, cell))
+		if err != nil {
+			r.wait()
+			return fmt.Errorf("column %s (%s): %s", r.decoder.Columns[i].Name, r.decoder.Columns[i].Type, err.Error())
+		}
+	}
+	return nil
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.decoder.Columns[index].BaseType())
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return scanType(r.decoder.Columns[index])
+}
+
+var (
+	int64Type     = reflect.TypeOf(int64(0))
+	float64Type   = reflect.TypeOf(float64(0))
+	boolType      = reflect.TypeOf(false)
+	stringType    = reflect.TypeOf("")
+	bytesType     = reflect.TypeOf([]byte(nil))
+	timeType      = reflect.TypeOf(time.Time{})
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+func scanType(c td_client.ResultColumn) reflect.Type {
+	switch c.BaseType() {
+	case "tinyint", "smallint", "int", "integer", "bigint":
+		return int64Type
+	case "real", "float", "double":
+		return float64Type
+	case "boolean":
+		return boolType
+	case "varchar", "char", "string", "decimal", "json", "array", "map", "row", "struct":
+		return stringType
+	case "varbinary", "binary":
+		return bytesType
+	case "timestamp", "date":
+		return timeType
+	}
+	return interfaceType
+}
+
+// driverValue converts the value given by ResultDecoder.Value into one of the types database/sql accepts.
+// Arrays and maps are rendered as JSON, and timestamps that fail to parse are passed as strings.
+func driverValue(c td_client.ResultColumn, v interface{}) (driver.Value, error) {
+	switch v := v.(type) {
+	case nil, int64, float64, bool, []byte:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case uint64:
+		return nil, fmt.Errorf("%d overflows int64", v)
+	case string:
+		if scanType(c) == timeType {
+			t, err := td_client.ParseResultTime(v)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return v, nil
+	case []interface{}, map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
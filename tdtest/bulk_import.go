@@ -0,0 +1,250 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type bulkImport struct {
+	name         string
+	database     string
+	table        string
+	status       string
+	frozen       bool
+	parts        map[string][]byte
+	jobId        string
+	records      []map[string]interface{}
+	errorRecords int
+	errorParts   int
+}
+
+func (bi *bulkImport) json() map[string]interface{} {
+	js := map[string]interface{}{
+		"name":          bi.name,
+		"database":      bi.database,
+		"table":         bi.table,
+		"status":        bi.status,
+		"upload_frozen": bi.frozen,
+		"job_id":        nil,
+		"valid_records": nil,
+		"error_records": nil,
+		"valid_parts":   nil,
+		"error_parts":   nil,
+	}
+	if bi.jobId != "" {
+		js["job_id"] = bi.jobId
+	}
+	if bi.status == "ready" || bi.status == "committed" {
+		js["valid_records"] = len(bi.records)
+		js["error_records"] = bi.errorRecords
+		js["valid_parts"] = len(bi.parts) - bi.errorParts
+		js["error_parts"] = bi.errorParts
+	}
+	return js
+}
+
+func (s *Server) bulkImport(w http.ResponseWriter, name string) *bulkImport {
+	bi, ok := s.bulkImports[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Bulk import session '"+name+"' does not exist")
+		return nil
+	}
+	return bi
+}
+
+func writeBulkImportResult(w http.ResponseWriter, bi *bulkImport) {
+	writeJSON(w, map[string]interface{}{"name": bi.name, "bulk_import": bi.name})
+}
+
+func (s *Server) listBulkImports(w http.ResponseWriter, r *request) {
+	bulkImports := []interface{}{}
+	for _, name := range sortedKeys(s.bulkImports) {
+		bulkImports = append(bulkImports, s.bulkImports[name].json())
+	}
+	writeJSON(w, map[string]interface{}{"bulk_imports": bulkImports})
+}
+
+func (s *Server) showBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	writeJSON(w, bi.json())
+}
+
+func (s *Server) createBulkImport(w http.ResponseWriter, r *request) {
+	name := r.args[0]
+	if _, ok := s.bulkImports[name]; ok {
+		writeError(w, http.StatusConflict, "Bulk import session '"+name+"' already exists")
+		return
+	}
+	if s.table(w, r.args[1], r.args[2]) == nil {
+		return
+	}
+	bi := &bulkImport{
+		name:     name,
+		database: r.args[1],
+		table:    r.args[2],
+		status:   "uploading",
+		parts:    map[string][]byte{},
+	}
+	s.bulkImports[name] = bi
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) deleteBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	delete(s.bulkImports, bi.name)
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) listBulkImportParts(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	parts := []string{}
+	for name := range bi.parts {
+		parts = append(parts, name)
+	}
+	sort.Strings(parts)
+	writeJSON(w, map[string]interface{}{"name": bi.name, "bulk_import": bi.name, "parts": parts})
+}
+
+func (s *Server) uploadBulkImportPart(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	if bi.frozen || bi.status != "uploading" {
+		writeError(w, http.StatusConflict, "Bulk import session '"+bi.name+"' does not accept parts")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bi.parts[r.args[1]] = body
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) deleteBulkImportPart(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	if _, ok := bi.parts[r.args[1]]; !ok {
+		writeError(w, http.StatusNotFound, "Part '"+r.args[1]+"' does not exist")
+		return
+	}
+	delete(bi.parts, r.args[1])
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) freezeBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	bi.frozen = true
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) unfreezeBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	bi.frozen = false
+	writeBulkImportResult(w, bi)
+}
+
+func (s *Server) performBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	if bi.status != "uploading" && bi.status != "ready" {
+		writeError(w, http.StatusConflict, "Bulk import session '"+bi.name+"' cannot be performed in status "+bi.status)
+		return
+	}
+	job := s.newJob("bulk_import", bi.database, "")
+	job.bulkImport = bi.name
+	bi.status = "performing"
+	bi.jobId = job.Id
+	writeJSON(w, map[string]interface{}{"name": bi.name, "bulk_import": bi.name, "job_id": job.Id})
+}
+
+// bulkImportPerformed decodes the parts once the perform job has finished.  Parts that cannot be decoded count as error parts.
+func (s *Server) bulkImportPerformed(job *Job) {
+	bi, ok := s.bulkImports[job.bulkImport]
+	if !ok || bi.jobId != job.Id {
+		return
+	}
+	if job.Status != "success" {
+		bi.status = "uploading"
+		return
+	}
+	bi.records, bi.errorParts = nil, 0
+	names := []string{}
+	for name := range bi.parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		format := "msgpack.gz"
+		if !strings.HasSuffix(name, ".gz") && strings.HasSuffix(name, ".msgpack") {
+			format = "msgpack"
+		}
+		records, err := decodeRecords(format, bi.parts[name])
+		if err != nil {
+			bi.errorParts++
+			continue
+		}
+		bi.records = append(bi.records, records...)
+	}
+	bi.status = "ready"
+}
+
+func (s *Server) commitBulkImport(w http.ResponseWriter, r *request) {
+	bi := s.bulkImport(w, r.args[0])
+	if bi == nil {
+		return
+	}
+	if bi.status != "ready" {
+		writeError(w, http.StatusConflict, "Bulk import session '"+bi.name+"' is not ready")
+		return
+	}
+	t := s.table(w, bi.database, bi.table)
+	if t == nil {
+		return
+	}
+	t.records = append(t.records, bi.records...)
+	t.importedAt = s.now()
+	bi.status = "committed"
+	writeBulkImportResult(w, bi)
+}
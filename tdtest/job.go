@@ -0,0 +1,307 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Job is the state of a job held by Server.
+//
+// Status advances to the next element of Statuses every time the status of the job is polled
+// through JobStatus or ShowJob.  Rows are served as the result once the job has succeeded.
+type Job struct {
+	Id         string
+	Type       string
+	Database   string
+	Query      string
+	Status     string
+	Statuses   []string        // Statuses the job goes through after Status. Defaults to running and success.
+	Schema     [][2]string     // Result columns as pairs of the name and the type, e.g. {"cnt", "bigint"}.
+	Rows       [][]interface{} // Result rows.
+	StdErr     string          // Reported in the debug section of ShowJob.
+	ResultUrl  string
+	Priority   int
+	RetryLimit int
+	DomainKey  string
+	CreatedAt  time.Time
+	StartAt    time.Time
+	EndAt      time.Time
+
+	scheduledAt time.Time
+	schedule    string
+	bulkImport  string
+}
+
+// Job returns the job with the id, or nil if it does not exist.  The job must not be modified while requests are in flight.
+func (s *Server) Job(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+func (s *Server) newJob(type_ string, db string, query string) *Job {
+	job := &Job{
+		Id:        strconv.Itoa(s.nextJobId),
+		Type:      type_,
+		Database:  db,
+		Query:     query,
+		Status:    "queued",
+		Statuses:  []string{"running", "success"},
+		CreatedAt: s.now(),
+	}
+	s.nextJobId++
+	s.jobs[job.Id] = job
+	return job
+}
+
+func (s *Server) job(w http.ResponseWriter, id string) *Job {
+	job, ok := s.jobs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Job "+id+" does not exist")
+		return nil
+	}
+	return job
+}
+
+func finished(status string) bool {
+	return status == "success" || status == "error" || status == "killed"
+}
+
+// advance moves the job to the next status.
+func (s *Server) advance(job *Job) {
+	if finished(job.Status) || len(job.Statuses) == 0 {
+		return
+	}
+	job.Status, job.Statuses = job.Statuses[0], job.Statuses[1:]
+	now := s.now()
+	if job.StartAt.IsZero() && job.Status != "queued" {
+		job.StartAt = now
+	}
+	if finished(job.Status) {
+		job.EndAt = now
+		if job.bulkImport != "" {
+			s.bulkImportPerformed(job)
+		}
+	}
+}
+
+func (job *Job) duration() interface{} {
+	if job.StartAt.IsZero() {
+		return nil
+	}
+	if job.EndAt.IsZero() {
+		return int(time.Since(job.StartAt).Seconds())
+	}
+	return int(job.EndAt.Sub(job.StartAt).Seconds())
+}
+
+func (job *Job) numRecords() interface{} {
+	if job.Status != "success" {
+		return nil
+	}
+	return len(job.Rows)
+}
+
+func (job *Job) hiveResultSchema() interface{} {
+	if job.Schema == nil {
+		return nil
+	}
+	schema := make([][]string, len(job.Schema))
+	for i, c := range job.Schema {
+		schema[i] = []string{c[0], c[1]}
+	}
+	b, _ := json.Marshal(schema)
+	return string(b)
+}
+
+func (s *Server) jobJSON(job *Job) map[string]interface{} {
+	return map[string]interface{}{
+		"job_id":             job.Id,
+		"type":               job.Type,
+		"database":           job.Database,
+		"user_name":          s.UserName,
+		"status":             job.Status,
+		"query":              job.Query,
+		"url":                s.URL + "/jobs/" + job.Id,
+		"duration":           job.duration(),
+		"created_at":         formatTime(job.CreatedAt),
+		"updated_at":         formatTime(job.CreatedAt),
+		"start_at":           formatTime(job.StartAt),
+		"end_at":             formatTime(job.EndAt),
+		"cpu_time":           nil,
+		"result_size":        nil,
+		"num_records":        job.numRecords(),
+		"result":             job.ResultUrl,
+		"priority":           job.Priority,
+		"retry_limit":        job.RetryLimit,
+		"hive_result_schema": job.hiveResultSchema(),
+		"organization":       nil,
+	}
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *request) {
+	jobs := []interface{}{}
+	for id := s.nextJobId - 1; id > 0; id-- {
+		job, ok := s.jobs[strconv.Itoa(id)]
+		if !ok {
+			continue
+		}
+		if status := r.params.Get("status"); status != "" && job.Status != status {
+			continue
+		}
+		if v := r.params.Get("slower_than"); v != "" {
+			slowerThan, _ := strconv.Atoi(v)
+			if duration, ok := job.duration().(int); !ok || duration <= slowerThan {
+				continue
+			}
+		}
+		jobs = append(jobs, s.jobJSON(job))
+	}
+	count := len(jobs)
+	from, to := 0, count-1
+	if v := r.params.Get("from"); v != "" {
+		from, _ = strconv.Atoi(v)
+	}
+	if v := r.params.Get("to"); v != "" {
+		to, _ = strconv.Atoi(v)
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to >= count {
+		to = count - 1
+	}
+	if from > to {
+		jobs = []interface{}{}
+	} else {
+		jobs = jobs[from : to+1]
+	}
+	writeJSON(w, map[string]interface{}{"jobs": jobs, "count": count, "from": from, "to": to})
+}
+
+func (s *Server) showJob(w http.ResponseWriter, r *request) {
+	job := s.job(w, r.args[0])
+	if job == nil {
+		return
+	}
+	s.advance(job)
+	js := s.jobJSON(job)
+	js["debug"] = map[string]interface{}{"cmdout": "", "stderr": job.StdErr}
+	writeJSON(w, js)
+}
+
+func (s *Server) jobStatus(w http.ResponseWriter, r *request) {
+	job := s.job(w, r.args[0])
+	if job == nil {
+		return
+	}
+	s.advance(job)
+	writeJSON(w, map[string]interface{}{
+		"job_id":      job.Id,
+		"status":      job.Status,
+		"created_at":  formatTime(job.CreatedAt),
+		"updated_at":  formatTime(job.CreatedAt),
+		"start_at":    formatTime(job.StartAt),
+		"end_at":      formatTime(job.EndAt),
+		"duration":    job.duration(),
+		"cpu_time":    nil,
+		"result_size": nil,
+		"num_records": job.numRecords(),
+	})
+}
+
+func (s *Server) jobResult(w http.ResponseWriter, r *request) {
+	job := s.job(w, r.args[0])
+	if job == nil {
+		return
+	}
+	if job.Status != "success" {
+		writeError(w, http.StatusUnprocessableEntity, "Job "+job.Id+" has not succeeded")
+		return
+	}
+	format := r.params.Get("format")
+	switch format {
+	case "msgpack":
+		rows := make([]interface{}, len(job.Rows))
+		for i, row := range job.Rows {
+			rows[i] = row
+		}
+		writeMessagePack(w, rows)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		for _, row := range job.Rows {
+			b, err := json.Marshal(row)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.Write(append(b, '\n'))
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "Unsupported format: "+format)
+	}
+}
+
+func (s *Server) killJob(w http.ResponseWriter, r *request) {
+	job := s.job(w, r.args[0])
+	if job == nil {
+		return
+	}
+	formerStatus := job.Status
+	if !finished(job.Status) {
+		job.Status, job.Statuses, job.EndAt = "killed", nil, s.now()
+	}
+	writeJSON(w, map[string]interface{}{"job_id": job.Id, "status": job.Status, "former_status": formerStatus})
+}
+
+func (s *Server) issueJob(w http.ResponseWriter, r *request) {
+	if s.database(w, r.args[1]) == nil {
+		return
+	}
+	domainKey := r.params.Get("domain_key")
+	if domainKey != "" {
+		for _, job := range s.jobs {
+			if job.DomainKey == domainKey {
+				writeError(w, http.StatusConflict, "Domain key "+domainKey+" has already been used by job "+job.Id)
+				return
+			}
+		}
+	}
+	job := s.newJob(r.args[0], r.args[1], r.params.Get("query"))
+	job.ResultUrl = r.params.Get("result")
+	job.Priority, _ = strconv.Atoi(r.params.Get("priority"))
+	job.RetryLimit, _ = strconv.Atoi(r.params.Get("retry_limit"))
+	job.DomainKey = domainKey
+	if s.HandleQuery != nil {
+		s.HandleQuery(job)
+	}
+	writeJSON(w, map[string]interface{}{"job": job.Id, "job_id": job.Id, "database": job.Database})
+}
+
+func (s *Server) runExport(w http.ResponseWriter, r *request) {
+	if s.table(w, r.args[0], r.args[1]) == nil {
+		return
+	}
+	job := s.newJob("export", r.args[0], "")
+	writeJSON(w, map[string]interface{}{"job": job.Id, "job_id": job.Id, "database": job.Database})
+}
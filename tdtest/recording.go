@@ -0,0 +1,325 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const scrubbed = "<SCRUBBED>"
+
+// Interaction is a pair of a request and its response stored in a cassette.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request stored in a cassette.  All the fields but Header are matched on replay.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Params  string      `json:"params,omitempty"`   // Query or form parameters, sorted by key.
+	BodyMD5 string      `json:"body_md5,omitempty"` // MD5 of the body other than form parameters.
+	Header  http.Header `json:"header,omitempty"`
+}
+
+func (r *RecordedRequest) matches(other *RecordedRequest) bool {
+	return r.Method == other.Method && r.Path == other.Path && r.Params == other.Params && r.BodyMD5 == other.BodyMD5
+}
+
+// RecordedResponse is a response stored in a cassette.
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // "base64" if the body is not valid UTF-8.
+}
+
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// RecordingTransport records the interactions with the API to a cassette file, or replays them from it.
+//
+// In record mode, the requests are sent through Transport and every interaction is appended to
+// the file as it happens.  The API key in the Authorization header, the API keys and passwords
+// in the parameters and the API keys in the response bodies are scrubbed.
+//
+// In replay mode, no request goes out; each request is answered with the first unused recorded
+// interaction having the same method, path and parameters, so repeated requests such as the
+// polls of a job status are replayed in the recorded order.
+type RecordingTransport struct {
+	Transport http.RoundTripper // Transport used in record mode. http.DefaultTransport is used if nil.
+	path      string
+	replay    bool
+	mu        sync.Mutex
+	cassette  cassette
+	used      []bool
+}
+
+// NewRecorder creates a RecordingTransport in record mode writing to the cassette at path, which is truncated.
+func NewRecorder(path string, transport http.RoundTripper) (*RecordingTransport, error) {
+	t := &RecordingTransport{Transport: transport, path: path}
+	err := t.save()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewReplayer creates a RecordingTransport in replay mode reading the cassette at path.
+func NewReplayer(path string) (*RecordingTransport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &RecordingTransport{path: path, replay: true}
+	err = json.Unmarshal(b, &t.cassette)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %s", path, err.Error())
+	}
+	t.used = make([]bool, len(t.cassette.Interactions))
+	return t, nil
+}
+
+// Interactions returns the interactions recorded or loaded so far.
+func (t *RecordingTransport) Interactions() []*Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Interaction(nil), t.cassette.Interactions...)
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, body, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.replay {
+		return t.replayRequest(req, recorded)
+	}
+	if body != nil {
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	interaction := &Interaction{
+		Request:  *recorded,
+		Response: recordResponse(resp, respBody, apiKeyOf(req)),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	return resp, t.save()
+}
+
+// save writes the cassette through a temporary file; it must be called with t.mu held.
+func (t *RecordingTransport) save() error {
+	b, err := json.MarshalIndent(&t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(t.path), ".cassette-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), t.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (t *RecordingTransport) replayRequest(req *http.Request, recorded *RecordedRequest) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, interaction := range t.cassette.Interactions {
+		if t.used[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		t.used[i] = true
+		body := []byte(interaction.Response.Body)
+		if interaction.Response.BodyEncoding == "base64" {
+			var err error
+			body, err = base64.StdEncoding.DecodeString(interaction.Response.Body)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction for %s %s %s in %s", recorded.Method, recorded.Path, recorded.Params, t.path)
+}
+
+func apiKeyOf(req *http.Request) string {
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "TD1 ")
+}
+
+// recordRequest returns the matched part of the request, along with the body read to compute it.
+func recordRequest(req *http.Request) (*RecordedRequest, []byte, error) {
+	recorded := &RecordedRequest{Method: req.Method, Path: req.URL.Path, Header: http.Header{}}
+	for _, k := range []string{"Content-Type", "User-Agent", "Authorization"} {
+		if v := req.Header.Get(k); v != "" {
+			recorded.Header.Set(k, v)
+		}
+	}
+	if recorded.Header.Get("Authorization") != "" {
+		recorded.Header.Set("Authorization", "TD1 "+scrubbed)
+	}
+	params := req.URL.Query()
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			form, err := url.ParseQuery(string(body))
+			if err != nil {
+				return nil, nil, err
+			}
+			for k, v := range form {
+				params[k] = v
+			}
+		} else if len(body) > 0 {
+			md5Sum := md5.Sum(body)
+			recorded.BodyMD5 = hex.EncodeToString(md5Sum[:])
+		}
+	}
+	for _, k := range []string{"apikey", "password"} {
+		if _, ok := params[k]; ok {
+			params.Set(k, scrubbed)
+		}
+	}
+	recorded.Params = params.Encode()
+	return recorded, body, nil
+}
+
+func recordResponse(resp *http.Response, body []byte, apiKey string) RecordedResponse {
+	header := http.Header{}
+	for _, k := range []string{"Content-Type", "Retry-After"} {
+		if v, ok := resp.Header[k]; ok {
+			header[k] = v
+		}
+	}
+	recorded := RecordedResponse{StatusCode: resp.StatusCode, Header: header}
+	if strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		body = scrubJSON(body)
+	}
+	if apiKey != "" {
+		body = bytes.Replace(body, []byte(apiKey), []byte(scrubbed), -1)
+	}
+	if utf8.Valid(body) {
+		recorded.Body = string(body)
+	} else {
+		recorded.Body = base64.StdEncoding.EncodeToString(body)
+		recorded.BodyEncoding = "base64"
+	}
+	return recorded
+}
+
+// scrubJSON replaces the values of the apikey and apikeys fields.
+func scrubJSON(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if dec.Decode(&v) != nil {
+		return body
+	}
+	changed := false
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				switch k {
+				case "apikey":
+					v[k] = scrubbed
+					changed = true
+				case "apikeys":
+					if keys, ok := e.([]interface{}); ok {
+						for i := range keys {
+							keys[i] = scrubbed
+						}
+						changed = true
+					}
+				default:
+					walk(e)
+				}
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	if !changed {
+		return body
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return b
+}
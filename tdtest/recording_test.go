@@ -0,0 +1,102 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+// runWorkflow submits a query and returns the rows of its result.
+func runWorkflow(t *testing.T, client *td_client.TDClient) []interface{} {
+	err := client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	rows := []interface{}{}
+	_, err = client.RunQuery("db", td_client.Query{Type: "presto", Query: "SELECT 1"}, func(row interface{}) error {
+		rows = append(rows, row)
+		return nil
+	}, &td_client.WaitJobOptions{Polling: &td_client.ConstantPolling{Interval: time.Millisecond}})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	return rows
+}
+
+func TestRecordingTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	server := NewServer()
+	server.ApiKey = "secret-key"
+	server.HandleQuery = func(job *Job) {
+		job.Schema = [][2]string{{"_col0", "bigint"}}
+		job.Rows = [][]interface{}{{1}}
+	}
+	recorder, err := NewRecorder(path, server.Transport())
+	if err != nil {
+		t.Fatalf("failed to create recorder: %s", err.Error())
+	}
+	client, err := td_client.NewTDClient(td_client.Settings{ApiKey: "secret-key", Router: server.Router(), Transport: recorder})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	recordedRows := runWorkflow(t, client)
+	server.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %s", err.Error())
+	}
+	if strings.Contains(string(b), "secret-key") {
+		t.Fatalf("API key is not scrubbed: %s", b)
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %s", err.Error())
+	}
+	if len(replayer.Interactions()) != len(recorder.Interactions()) {
+		t.Fatalf("expected %d interactions, got %d", len(recorder.Interactions()), len(replayer.Interactions()))
+	}
+	client, err = td_client.NewTDClient(td_client.Settings{ApiKey: "another-key", Router: server.Router(), Transport: replayer})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	replayedRows := runWorkflow(t, client)
+	if len(replayedRows) != 1 || len(recordedRows) != 1 {
+		t.Fatalf("unexpected rows: %v, %v", recordedRows, replayedRows)
+	}
+	_, err = client.ListDatabases()
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+		t.Fatalf("expected a replay miss, got %v", err)
+	}
+}
+
+func TestScrubJSON(t *testing.T) {
+	b := scrubJSON([]byte(`{"name":"user","apikey":"k1","user":{"apikeys":["k2","k3"]},"job_id":12345678901234}`))
+	s := string(b)
+	if strings.Contains(s, "k1") || strings.Contains(s, "k2") || strings.Contains(s, "k3") || !strings.Contains(s, "12345678901234") {
+		t.Fatalf("unexpected result: %s", s)
+	}
+}
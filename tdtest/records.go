@@ -0,0 +1,129 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+func msgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	handle.MapType = mapStringInterfaceType
+	return handle
+}
+
+func writeMessagePack(w http.ResponseWriter, values []interface{}) {
+	buf := bytes.Buffer{}
+	enc := codec.NewEncoder(&buf, msgpackHandle())
+	for _, v := range values {
+		err := enc.Encode(v)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-msgpack")
+	w.Write(buf.Bytes())
+}
+
+// decodeRecords decodes the records in "msgpack" or "msgpack.gz" format.
+func decodeRecords(format string, body []byte) ([]map[string]interface{}, error) {
+	var r io.Reader = bytes.NewReader(body)
+	switch format {
+	case "msgpack":
+	case "msgpack.gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	dec := codec.NewDecoder(r, msgpackHandle())
+	records := []map[string]interface{}{}
+	for {
+		record := map[string]interface{}{}
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := record["time"]; !ok {
+			return nil, fmt.Errorf("record without time column: %v", record)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *Server) importRecords(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	uniqueId, format := "", r.args[2]
+	if len(r.args) == 4 {
+		uniqueId, format = r.args[2], r.args[3]
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	records, err := decodeRecords(format, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key := r.args[0] + "." + r.args[1] + "." + uniqueId
+	if uniqueId == "" || !s.uniqueIds[key] {
+		t.records = append(t.records, records...)
+		t.importedAt = s.now()
+		if uniqueId != "" {
+			s.uniqueIds[key] = true
+		}
+	}
+	md5Sum := md5.Sum(body)
+	retval := map[string]interface{}{
+		"database":     r.args[0],
+		"table":        r.args[1],
+		"md5_hex":      hex.EncodeToString(md5Sum[:]),
+		"elapsed_time": 0.0,
+	}
+	if uniqueId != "" {
+		retval["unique_id"] = uniqueId
+	}
+	writeJSON(w, retval)
+}
+
+var mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
@@ -0,0 +1,213 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+type schedule struct {
+	id         int
+	name       string
+	cron       string
+	type_      string
+	query      string
+	timezone   string
+	delay      int
+	database   string
+	priority   int
+	retryLimit int
+	result     string
+	createdAt  time.Time
+}
+
+func (sc *schedule) update(params map[string][]string) {
+	get := func(key string) (string, bool) {
+		v, ok := params[key]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return v[0], true
+	}
+	if v, ok := get("cron"); ok {
+		sc.cron = v
+	}
+	if v, ok := get("type"); ok {
+		sc.type_ = v
+	}
+	if v, ok := get("query"); ok {
+		sc.query = v
+	}
+	if v, ok := get("timezone"); ok {
+		sc.timezone = v
+	}
+	if v, ok := get("delay"); ok {
+		sc.delay, _ = strconv.Atoi(v)
+	}
+	if v, ok := get("database"); ok {
+		sc.database = v
+	}
+	if v, ok := get("priority"); ok {
+		sc.priority, _ = strconv.Atoi(v)
+	}
+	if v, ok := get("retry_limit"); ok {
+		sc.retryLimit, _ = strconv.Atoi(v)
+	}
+	if v, ok := get("result"); ok {
+		sc.result = v
+	}
+}
+
+func (s *Server) scheduleJSON(sc *schedule) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        sc.name,
+		"cron":        sc.cron,
+		"type":        sc.type_,
+		"query":       sc.query,
+		"timezone":    sc.timezone,
+		"delay":       sc.delay,
+		"database":    sc.database,
+		"user_name":   s.UserName,
+		"priority":    sc.priority,
+		"retry_limit": sc.retryLimit,
+		"result":      sc.result,
+		"created_at":  formatTime(sc.createdAt),
+	}
+}
+
+func (s *Server) scheduleResultJSON(sc *schedule) map[string]interface{} {
+	js := s.scheduleJSON(sc)
+	js["id"] = sc.id
+	js["start"] = nil
+	return js
+}
+
+func (s *Server) schedule(w http.ResponseWriter, name string) *schedule {
+	sc, ok := s.schedules[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Schedule '"+name+"' does not exist")
+		return nil
+	}
+	return sc
+}
+
+func (s *Server) listSchedules(w http.ResponseWriter, r *request) {
+	schedules := []interface{}{}
+	for _, name := range sortedKeys(s.schedules) {
+		js := s.scheduleJSON(s.schedules[name])
+		js["next_time"] = nil
+		schedules = append(schedules, js)
+	}
+	writeJSON(w, map[string]interface{}{"schedules": schedules})
+}
+
+func (s *Server) createSchedule(w http.ResponseWriter, r *request) {
+	name := r.args[0]
+	if _, ok := s.schedules[name]; ok {
+		writeError(w, http.StatusConflict, "Schedule '"+name+"' already exists")
+		return
+	}
+	sc := &schedule{
+		id:        s.nextSchedId,
+		name:      name,
+		type_:     "hive",
+		timezone:  "UTC",
+		createdAt: s.now(),
+	}
+	sc.update(r.params)
+	s.nextSchedId++
+	s.schedules[name] = sc
+	writeJSON(w, s.scheduleResultJSON(sc))
+}
+
+func (s *Server) deleteSchedule(w http.ResponseWriter, r *request) {
+	sc := s.schedule(w, r.args[0])
+	if sc == nil {
+		return
+	}
+	delete(s.schedules, sc.name)
+	js := s.scheduleJSON(sc)
+	delete(js, "priority")
+	delete(js, "retry_limit")
+	delete(js, "result")
+	writeJSON(w, js)
+}
+
+func (s *Server) updateSchedule(w http.ResponseWriter, r *request) {
+	sc := s.schedule(w, r.args[0])
+	if sc == nil {
+		return
+	}
+	sc.update(r.params)
+	writeJSON(w, s.scheduleResultJSON(sc))
+}
+
+func (s *Server) runSchedule(w http.ResponseWriter, r *request) {
+	sc := s.schedule(w, r.args[0])
+	if sc == nil {
+		return
+	}
+	scheduledAt, err := time.Parse(td_client.TDAPIDateTime, r.args[1])
+	if err != nil {
+		scheduledAt, err = time.Parse(time.RFC3339, r.args[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid time: "+r.args[1])
+			return
+		}
+	}
+	num := 1
+	if v := r.params.Get("num"); v != "" {
+		num, _ = strconv.Atoi(v)
+	}
+	jobs := []interface{}{}
+	for i := 0; i < num; i++ {
+		job := s.newJob(sc.type_, sc.database, sc.query)
+		job.ResultUrl = sc.result
+		job.Priority = sc.priority
+		job.RetryLimit = sc.retryLimit
+		job.schedule = sc.name
+		job.scheduledAt = scheduledAt
+		if s.HandleQuery != nil {
+			s.HandleQuery(job)
+		}
+		jobs = append(jobs, map[string]interface{}{"job_id": job.Id, "type": job.Type, "scheduled_at": formatTime(scheduledAt)})
+	}
+	writeJSON(w, map[string]interface{}{"jobs": jobs})
+}
+
+func (s *Server) scheduleHistory(w http.ResponseWriter, r *request) {
+	if s.schedule(w, r.args[0]) == nil {
+		return
+	}
+	history := []interface{}{}
+	for id := s.nextJobId - 1; id > 0; id-- {
+		job, ok := s.jobs[strconv.Itoa(id)]
+		if !ok || job.schedule != r.args[0] {
+			continue
+		}
+		js := s.jobJSON(job)
+		js["scheduled_at"] = formatTime(job.scheduledAt)
+		history = append(history, js)
+	}
+	writeJSON(w, map[string]interface{}{"history": history, "count": len(history), "from": 0, "to": len(history)})
+}
@@ -0,0 +1,573 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tdtest provides an in-process fake of the Treasure Data v3 API for tests.
+//
+// The fake keeps databases, tables, jobs, schedules, result destinations and bulk imports
+// in memory and serves them over HTTPS through net/http/httptest:
+//
+//	server := tdtest.NewServer()
+//	defer server.Close()
+//	client, err := td_client.NewTDClient(server.Settings())
+//
+// Records sent by Import or committed by a bulk import are stored in the table and can be
+// read back with Tail or Server.Records.  Jobs go through the statuses given in Job.Statuses,
+// advancing one step every time their status is polled, and serve Job.Rows as their result.
+//
+// RecordingTransport records the interactions with the real API into a cassette file and
+// replays them, for the tests that need the actual responses without the network.
+package tdtest
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+// Server is a fake Treasure Data API server.
+//
+// The exported fields must be set before the first request.
+type Server struct {
+	URL         string
+	ApiKey      string         // (Optional) API key the requests must carry. Any key is accepted if empty.
+	UserName    string         // (Optional) Name of the user reported as the owner of jobs and schedules.
+	HandleQuery func(job *Job) // (Optional) Called with every job issued by SubmitQuery to set its statuses and result. It must not call the methods of Server.
+
+	server      *httptest.Server
+	mu          sync.Mutex
+	now         func() time.Time
+	databases   map[string]*database
+	nextTableId int
+	jobs        map[string]*Job
+	nextJobId   int
+	results     map[string]string
+	schedules   map[string]*schedule
+	nextSchedId int
+	bulkImports map[string]*bulkImport
+	uniqueIds   map[string]bool
+}
+
+type database struct {
+	name      string
+	createdAt time.Time
+	updatedAt time.Time
+	tables    map[string]*table
+}
+
+type table struct {
+	id         int
+	name       string
+	type_      string
+	schema     string
+	expireDays int
+	records    []map[string]interface{}
+	createdAt  time.Time
+	updatedAt  time.Time
+	importedAt time.Time
+}
+
+// NewServer starts a Server.  Close must be called to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		UserName:    "tdtest",
+		now:         time.Now,
+		databases:   map[string]*database{},
+		jobs:        map[string]*Job{},
+		nextJobId:   1,
+		nextTableId: 1,
+		nextSchedId: 1,
+		results:     map[string]string{},
+		schedules:   map[string]*schedule{},
+		bulkImports: map[string]*bulkImport{},
+		uniqueIds:   map[string]bool{},
+	}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Router returns the EndpointRouter that routes every request to the server.
+func (s *Server) Router() td_client.EndpointRouter {
+	return &td_client.FixedEndpointRouter{Endpoint: strings.TrimPrefix(s.URL, "https://")}
+}
+
+// RootCAs returns the certificate pool that trusts the certificate of the server.
+func (s *Server) RootCAs() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.server.Certificate())
+	return pool
+}
+
+// Transport returns an http.RoundTripper that trusts the certificate of the server, for use as Settings.Transport.
+func (s *Server) Transport() http.RoundTripper {
+	return s.server.Client().Transport
+}
+
+// Settings returns the Settings of a TDClient talking to the server.
+func (s *Server) Settings() td_client.Settings {
+	return td_client.Settings{
+		ApiKey:  s.ApiKey,
+		Router:  s.Router(),
+		RootCAs: s.RootCAs(),
+	}
+}
+
+// Records returns a copy of the records stored in the table, or nil if the table does not exist.
+func (s *Server) Records(db string, tableName string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[db]
+	if !ok {
+		return nil
+	}
+	t, ok := d.tables[tableName]
+	if !ok {
+		return nil
+	}
+	return append([]map[string]interface{}(nil), t.records...)
+}
+
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(td_client.TDAPIDateTime)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	b, _ := json.Marshal(map[string]interface{}{"error": message, "text": message, "severity": "error"})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
+
+// request holds the decoded parts of a request.
+type request struct {
+	*http.Request
+	args   []string
+	params url.Values
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.ApiKey != "" && req.Header.Get("Authorization") != "TD1 "+s.ApiKey {
+		writeError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+	// TDClient puts the query-escaped segments into URL.Path, so they are unescaped once more here.
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if len(segments) < 3 || segments[0] != "v3" {
+		writeError(w, http.StatusNotFound, "Unknown API: "+req.URL.Path)
+		return
+	}
+	for i, segment := range segments {
+		unescaped, err := url.QueryUnescape(segment)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid path: "+req.URL.Path)
+			return
+		}
+		segments[i] = unescaped
+	}
+	r := &request{Request: req}
+	if req.Method == "POST" {
+		err := req.ParseForm()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.params = req.PostForm
+	} else {
+		r.params = req.URL.Query()
+	}
+	name := segments[1] + "/" + segments[2]
+	r.args = segments[3:]
+	route, ok := routes[name]
+	if !ok || route.method != req.Method || route.args != len(r.args) {
+		writeError(w, http.StatusNotFound, "Unknown API: "+req.Method+" "+req.URL.Path)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	route.handler(s, w, r)
+}
+
+type route struct {
+	method  string
+	args    int
+	handler func(s *Server, w http.ResponseWriter, r *request)
+}
+
+var routes map[string]route
+
+func init() {
+	routes = map[string]route{
+		"system/server_status":    {"GET", 0, (*Server).serverStatus},
+		"account/show":            {"GET", 0, (*Server).showAccount},
+		"database/list":           {"GET", 0, (*Server).listDatabases},
+		"database/create":         {"POST", 1, (*Server).createDatabase},
+		"database/delete":         {"POST", 1, (*Server).deleteDatabase},
+		"table/list":              {"GET", 1, (*Server).listTables},
+		"table/show":              {"GET", 2, (*Server).showTable},
+		"table/create":            {"POST", 3, (*Server).createTable},
+		"table/delete":            {"POST", 2, (*Server).deleteTable},
+		"table/swap":              {"POST", 3, (*Server).swapTable},
+		"table/update":            {"POST", 2, (*Server).updateTable},
+		"table/update-schema":     {"POST", 2, (*Server).updateSchema},
+		"table/tail":              {"POST", 2, (*Server).tail},
+		"table/import":            {"PUT", 3, (*Server).importRecords},
+		"table/import_with_id":    {"PUT", 4, (*Server).importRecords},
+		"job/list":                {"GET", 0, (*Server).listJobs},
+		"job/show":                {"GET", 1, (*Server).showJob},
+		"job/status":              {"GET", 1, (*Server).jobStatus},
+		"job/result":              {"GET", 1, (*Server).jobResult},
+		"job/kill":                {"POST", 1, (*Server).killJob},
+		"job/issue":               {"POST", 2, (*Server).issueJob},
+		"export/run":              {"POST", 2, (*Server).runExport},
+		"result/list":             {"GET", 0, (*Server).listResults},
+		"result/create":           {"POST", 1, (*Server).createResult},
+		"result/delete":           {"POST", 1, (*Server).deleteResult},
+		"schedule/list":           {"GET", 0, (*Server).listSchedules},
+		"schedule/create":         {"POST", 1, (*Server).createSchedule},
+		"schedule/delete":         {"POST", 1, (*Server).deleteSchedule},
+		"schedule/update":         {"POST", 1, (*Server).updateSchedule},
+		"schedule/run":            {"POST", 2, (*Server).runSchedule},
+		"schedule/history":        {"GET", 1, (*Server).scheduleHistory},
+		"bulk_import/list":        {"GET", 0, (*Server).listBulkImports},
+		"bulk_import/show":        {"GET", 1, (*Server).showBulkImport},
+		"bulk_import/create":      {"POST", 3, (*Server).createBulkImport},
+		"bulk_import/delete":      {"POST", 1, (*Server).deleteBulkImport},
+		"bulk_import/list_parts":  {"GET", 1, (*Server).listBulkImportParts},
+		"bulk_import/upload_part": {"PUT", 2, (*Server).uploadBulkImportPart},
+		"bulk_import/delete_part": {"POST", 2, (*Server).deleteBulkImportPart},
+		"bulk_import/freeze":      {"POST", 1, (*Server).freezeBulkImport},
+		"bulk_import/unfreeze":    {"POST", 1, (*Server).unfreezeBulkImport},
+		"bulk_import/perform":     {"POST", 1, (*Server).performBulkImport},
+		"bulk_import/commit":      {"POST", 1, (*Server).commitBulkImport},
+	}
+}
+
+func (s *Server) serverStatus(w http.ResponseWriter, r *request) {
+	writeJSON(w, map[string]interface{}{"status": "ok"})
+}
+
+func (s *Server) showAccount(w http.ResponseWriter, r *request) {
+	storageSize := 0
+	for _, d := range s.databases {
+		for _, t := range d.tables {
+			storageSize += len(t.records)
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"account": map[string]interface{}{
+			"id":               1,
+			"plan":             0,
+			"storage_size":     storageSize,
+			"guaranteed_cores": 0,
+			"maximum_cores":    0,
+			"created_at":       formatTime(time.Unix(0, 0)),
+		},
+	})
+}
+
+func (s *Server) database(w http.ResponseWriter, name string) *database {
+	d, ok := s.databases[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Database '"+name+"' does not exist")
+		return nil
+	}
+	return d
+}
+
+func (s *Server) table(w http.ResponseWriter, db string, name string) *table {
+	d := s.database(w, db)
+	if d == nil {
+		return nil
+	}
+	t, ok := d.tables[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Table '"+name+"' does not exist")
+		return nil
+	}
+	return t
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch m := m.(type) {
+	case map[string]*database:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*table:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*schedule:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*bulkImport:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) listDatabases(w http.ResponseWriter, r *request) {
+	databases := []interface{}{}
+	for _, name := range sortedKeys(s.databases) {
+		d := s.databases[name]
+		count := 0
+		for _, t := range d.tables {
+			count += len(t.records)
+		}
+		databases = append(databases, map[string]interface{}{
+			"name":             d.name,
+			"organization":     nil,
+			"count":            count,
+			"created_at":       formatTime(d.createdAt),
+			"updated_at":       formatTime(d.updatedAt),
+			"permission":       "owner",
+			"delete_protected": false,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"databases": databases})
+}
+
+func (s *Server) createDatabase(w http.ResponseWriter, r *request) {
+	name := r.args[0]
+	if _, ok := s.databases[name]; ok {
+		writeError(w, http.StatusConflict, "Database '"+name+"' already exists")
+		return
+	}
+	now := s.now()
+	s.databases[name] = &database{name: name, createdAt: now, updatedAt: now, tables: map[string]*table{}}
+	writeJSON(w, map[string]interface{}{"database": name})
+}
+
+func (s *Server) deleteDatabase(w http.ResponseWriter, r *request) {
+	if s.database(w, r.args[0]) == nil {
+		return
+	}
+	delete(s.databases, r.args[0])
+	writeJSON(w, map[string]interface{}{"database": r.args[0]})
+}
+
+func (t *table) json() map[string]interface{} {
+	var expireDays interface{}
+	if t.expireDays > 0 {
+		expireDays = t.expireDays
+	}
+	var lastLogTimestamp interface{}
+	for _, record := range t.records {
+		if unixTime, ok := record["time"].(int64); ok {
+			lastLogTimestamp = formatTime(time.Unix(unixTime, 0))
+		}
+	}
+	return map[string]interface{}{
+		"id":                     t.id,
+		"name":                   t.name,
+		"type":                   t.type_,
+		"count":                  len(t.records),
+		"created_at":             formatTime(t.createdAt),
+		"updated_at":             formatTime(t.updatedAt),
+		"counter_updated_at":     formatTime(t.importedAt),
+		"last_log_timestamp":     lastLogTimestamp,
+		"estimated_storage_size": 0,
+		"schema":                 t.schema,
+		"expire_days":            expireDays,
+		"primary_key":            nil,
+		"primary_key_type":       nil,
+		"include_v":              true,
+		"delete_protected":       false,
+	}
+}
+
+func (s *Server) listTables(w http.ResponseWriter, r *request) {
+	d := s.database(w, r.args[0])
+	if d == nil {
+		return
+	}
+	tables := []interface{}{}
+	for _, name := range sortedKeys(d.tables) {
+		tables = append(tables, d.tables[name].json())
+	}
+	writeJSON(w, map[string]interface{}{"database": d.name, "tables": tables})
+}
+
+func (s *Server) showTable(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	writeJSON(w, t.json())
+}
+
+func (s *Server) createTable(w http.ResponseWriter, r *request) {
+	d := s.database(w, r.args[0])
+	if d == nil {
+		return
+	}
+	name := r.args[1]
+	if _, ok := d.tables[name]; ok {
+		writeError(w, http.StatusConflict, "Table '"+name+"' already exists")
+		return
+	}
+	now := s.now()
+	d.tables[name] = &table{id: s.nextTableId, name: name, type_: r.args[2], schema: "[]", createdAt: now, updatedAt: now}
+	s.nextTableId++
+	writeJSON(w, map[string]interface{}{"database": d.name, "table": name, "type": r.args[2]})
+}
+
+func (s *Server) deleteTable(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	delete(s.databases[r.args[0]].tables, t.name)
+	writeJSON(w, map[string]interface{}{"database": r.args[0], "table": t.name, "type": t.type_})
+}
+
+func (s *Server) swapTable(w http.ResponseWriter, r *request) {
+	t1 := s.table(w, r.args[0], r.args[1])
+	if t1 == nil {
+		return
+	}
+	t2 := s.table(w, r.args[0], r.args[2])
+	if t2 == nil {
+		return
+	}
+	t1.records, t2.records = t2.records, t1.records
+	t1.schema, t2.schema = t2.schema, t1.schema
+	writeJSON(w, map[string]interface{}{"database": r.args[0], "table1": t1.name, "table2": t2.name})
+}
+
+func (s *Server) updateTable(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	if v := r.params.Get("expire_days"); v != "" {
+		expireDays, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid expire_days: "+v)
+			return
+		}
+		t.expireDays = expireDays
+	}
+	t.updatedAt = s.now()
+	writeJSON(w, map[string]interface{}{"database": r.args[0], "table": t.name, "type": t.type_})
+}
+
+func (s *Server) updateSchema(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	schema := r.params.Get("schema")
+	var v []interface{}
+	if json.Unmarshal([]byte(schema), &v) != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schema: "+schema)
+		return
+	}
+	t.schema = schema
+	t.updatedAt = s.now()
+	writeJSON(w, map[string]interface{}{"database": r.args[0], "table": t.name, "type": t.type_})
+}
+
+func (s *Server) tail(w http.ResponseWriter, r *request) {
+	t := s.table(w, r.args[0], r.args[1])
+	if t == nil {
+		return
+	}
+	count := 10
+	if v := r.params.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid count: "+v)
+			return
+		}
+		count = n
+	}
+	records := t.records
+	if len(records) > count {
+		records = records[len(records)-count:]
+	}
+	rows := make([]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = record
+	}
+	writeMessagePack(w, rows)
+}
+
+func (s *Server) listResults(w http.ResponseWriter, r *request) {
+	results := []interface{}{}
+	for _, name := range sortedKeys(s.results) {
+		results = append(results, map[string]interface{}{"name": name, "url": s.results[name], "organization": nil})
+	}
+	writeJSON(w, map[string]interface{}{"results": results})
+}
+
+func (s *Server) createResult(w http.ResponseWriter, r *request) {
+	name := r.args[0]
+	if _, ok := s.results[name]; ok {
+		writeError(w, http.StatusConflict, "Result '"+name+"' already exists")
+		return
+	}
+	s.results[name] = r.params.Get("url")
+	writeJSON(w, map[string]interface{}{"name": name})
+}
+
+func (s *Server) deleteResult(w http.ResponseWriter, r *request) {
+	name := r.args[0]
+	if _, ok := s.results[name]; !ok {
+		writeError(w, http.StatusNotFound, "Result '"+name+"' does not exist")
+		return
+	}
+	delete(s.results, name)
+	writeJSON(w, map[string]interface{}{"name": name})
+}
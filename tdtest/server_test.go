@@ -0,0 +1,359 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tdtest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	td_client "github.com/treasure-data/td-client-go"
+)
+
+func newTestClient(t *testing.T, server *Server) *td_client.TDClient {
+	settings := server.Settings()
+	settings.StrictDecoding = true
+	client, err := td_client.NewTDClient(settings)
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	return client
+}
+
+func importRecords(t *testing.T, client *td_client.TDClient, db string, table string, uniqueId string, records ...map[string]interface{}) {
+	w := client.NewRecordWriter(nil, func(part td_client.Blob, n int) error {
+		_, err := client.Import(db, table, "msgpack.gz", part, uniqueId)
+		return err
+	})
+	for _, record := range records {
+		err := w.Write(record)
+		if err != nil {
+			t.Fatalf("failed to write: %s", err.Error())
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+}
+
+func TestDatabasesAndTables(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := newTestClient(t, server)
+
+	status, err := client.ServerStatus()
+	if err != nil || status.Status != "ok" {
+		t.Fatalf("bad request: %v", err)
+	}
+	err = client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.CreateDatabase("db", nil)
+	if apiErr, ok := err.(*td_client.APIError); !ok || apiErr.Type != td_client.AlreadyExistsError {
+		t.Fatalf("expected AlreadyExistsError, got %v", err)
+	}
+	for _, table := range []string{"a", "b"} {
+		err = client.CreateLogTable("db", table)
+		if err != nil {
+			t.Fatalf("bad request: %s", err.Error())
+		}
+	}
+	err = client.UpdateSchema("db", "a", []interface{}{[]string{"v", "string"}})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.UpdateExpire("db", "a", 30)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	importRecords(t, client, "db", "a", "", map[string]interface{}{"time": 1, "v": "x"})
+	err = client.SwapTable("db", "a", "b")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	tables, err := client.ListTables("db")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(*tables) != 2 || (*tables)[0].Name != "a" || (*tables)[0].Count != 0 || (*tables)[0].ExpireDays != 30 || (*tables)[1].Count != 1 || len((*tables)[1].Schema) != 1 {
+		t.Fatalf("unexpected tables: %+v", *tables)
+	}
+	_, err = client.DeleteTable("db", "a")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.ShowTable("db", "a")
+	if apiErr, ok := err.(*td_client.APIError); !ok || apiErr.Type != td_client.NotFoundError {
+		t.Fatalf("expected NotFoundError, got %v", err)
+	}
+	databases, err := client.ListDatabases()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(*databases) != 1 || (*databases)[0].Count != 1 {
+		t.Fatalf("unexpected databases: %+v", *databases)
+	}
+	err = client.DeleteDatabase("db")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.ShowAccount()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+}
+
+func TestImportAndTail(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := newTestClient(t, server)
+	err := client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.CreateLogTable("db", "tbl")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		importRecords(t, client, "db", "tbl", "0123456789abcdef0123456789abcdef", map[string]interface{}{"time": 1, "v": "x"}, map[string]interface{}{"time": 2, "v": "y"})
+	}
+	records := server.Records("db", "tbl")
+	if len(records) != 2 || records[1]["v"] != "y" {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	n := 0
+	err = client.Tail("db", "tbl", 1, time.Time{}, time.Time{}, func(v interface{}) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 record, got %d", n)
+	}
+	// TDClient never sends a negative count, so the invalid ones are posted directly.
+	for _, count := range []string{"-1", "x"} {
+		resp, err := server.server.Client().PostForm(server.URL+"/v3/table/tail/db/tbl", url.Values{"count": {count}, "format": {"msgpack"}})
+		if err != nil {
+			t.Fatalf("bad request: %s", err.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("count %s: unexpected status %d", count, resp.StatusCode)
+		}
+	}
+	_, err = client.Import("db", "missing", "msgpack.gz", td_client.InMemoryBlob(nil), "")
+	if apiErr, ok := err.(*td_client.APIError); !ok || apiErr.Type != td_client.NotFoundError {
+		t.Fatalf("expected NotFoundError, got %v", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.HandleQuery = func(job *Job) {
+		if job.Query == "SELECT broken" {
+			job.Statuses = []string{"running", "error"}
+			job.StdErr = "syntax error"
+			return
+		}
+		job.Schema = [][2]string{{"name", "varchar"}, {"cnt", "bigint"}}
+		job.Rows = [][]interface{}{{"a", 1}, {"b", 2}}
+	}
+	client := newTestClient(t, server)
+	err := client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	polling := &td_client.WaitJobOptions{Polling: &td_client.ConstantPolling{Interval: time.Millisecond}}
+	jobId, err := client.SubmitQuery("db", td_client.Query{Type: "presto", Query: "SELECT name, cnt FROM t"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	job, err := client.WaitJob(jobId, polling)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if job.NumRecords != 2 || len(job.HiveResultSchema) != 2 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	row := struct {
+		Name string
+		Cnt  int
+	}{}
+	total := 0
+	err = client.JobResultScan(jobId, &row, func() error {
+		total += row.Cnt
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if total != 3 {
+		t.Fatalf("unexpected total: %d", total)
+	}
+	_, err = client.RunQuery("db", td_client.Query{Type: "presto", Query: "SELECT broken"}, func(interface{}) error {
+		return nil
+	}, polling)
+	if jobErr, ok := err.(*td_client.JobError); !ok || jobErr.StdErr != "syntax error" {
+		t.Fatalf("expected *JobError, got %v", err)
+	}
+	jobId, err = client.SubmitQuery("db", td_client.Query{Type: "hive", Query: "SELECT 1", DomainKey: "key"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	_, err = client.SubmitQuery("db", td_client.Query{Type: "hive", Query: "SELECT 1", DomainKey: "key"})
+	if apiErr, ok := err.(*td_client.APIError); !ok || apiErr.Type != td_client.AlreadyExistsError {
+		t.Fatalf("expected AlreadyExistsError, got %v", err)
+	}
+	err = client.KillJob(jobId)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	status, err := client.JobStatus(jobId)
+	if err != nil || status != "killed" {
+		t.Fatalf("unexpected status: %s, %v", status, err)
+	}
+	jobs, err := client.ListJobs()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(jobs.ListJobsResultElements) != 3 || jobs.ListJobsResultElements[0].Id != jobId {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	jobs, err = client.ListJobsWithOptions((&td_client.ListJobsOptions{}).WithStatus("killed"))
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if len(jobs.ListJobsResultElements) != 1 || jobs.ListJobsResultElements[0].Id != jobId || jobs.ListJobsResultElements[0].UserName == "" {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+}
+
+func TestSchedulesAndResults(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := newTestClient(t, server)
+	err := client.CreateResult("out", "td://@/db/out")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	results, err := client.ListResults()
+	if err != nil || len(*results) != 1 || (*results)[0].Url != "td://@/db/out" {
+		t.Fatalf("unexpected results: %v, %v", results, err)
+	}
+	err = client.DeleteResult("out")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	created, err := client.CreateSchedule("daily", map[string]string{"cron": "@daily", "query": "SELECT 1", "database": "db", "type": "presto"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if created.ID != "1" || created.Cron != "@daily" {
+		t.Fatalf("unexpected schedule: %+v", created)
+	}
+	_, err = client.UpdateSchedule("daily", map[string]string{"cron": "@hourly"})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	schedules, err := client.ListSchedules()
+	if err != nil || len(*schedules) != 1 || (*schedules)[0].Cron != "@hourly" {
+		t.Fatalf("unexpected schedules: %v, %v", schedules, err)
+	}
+	jobs, err := client.RunSchedule("daily", "2016-07-26 00:00:00 UTC", map[string]string{"num": "2"})
+	if err != nil || len(*jobs) != 2 {
+		t.Fatalf("unexpected jobs: %v, %v", jobs, err)
+	}
+	history, err := client.ScheduleHistory("daily", nil)
+	if err != nil || len(history.History) != 2 || history.History[0].Type != "presto" {
+		t.Fatalf("unexpected history: %v, %v", history, err)
+	}
+	_, err = client.DeleteSchedule("daily")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+}
+
+func TestBulkImport(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := newTestClient(t, server)
+	err := client.CreateDatabase("db", nil)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	err = client.CreateLogTable("db", "tbl")
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	parts := []td_client.BulkImportPart{}
+	w := client.NewRecordWriter(&td_client.RecordWriterOptions{MaxRecords: 2}, func(part td_client.Blob, n int) error {
+		parts = append(parts, td_client.BulkImportPart{Name: "part" + strconv.Itoa(len(parts)), Blob: part})
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		err = w.Write(map[string]interface{}{"time": i})
+		if err != nil {
+			t.Fatalf("failed to write: %s", err.Error())
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close: %s", err.Error())
+	}
+	session := client.NewBulkImportSession("session", "db", "tbl", &td_client.BulkImportSessionOptions{Polling: &td_client.ConstantPolling{Interval: time.Millisecond}})
+	bi, err := session.Run(context.Background(), parts)
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if bi.Status != "committed" || bi.ValidRecords != 5 || bi.ValidParts != 3 {
+		t.Fatalf("unexpected bulk import: %+v", bi)
+	}
+	if len(server.Records("db", "tbl")) != 5 {
+		t.Fatalf("unexpected records: %v", server.Records("db", "tbl"))
+	}
+}
+
+func TestApiKey(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.ApiKey = "secret"
+	settings := server.Settings()
+	settings.ApiKey = "wrong"
+	client, err := td_client.NewTDClient(settings)
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.ListDatabases()
+	if apiErr, ok := err.(*td_client.APIError); !ok || apiErr.Type != td_client.AuthError {
+		t.Fatalf("expected AuthError, got %v", err)
+	}
+	_, err = newTestClient(t, server).ListDatabases()
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+}
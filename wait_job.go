@@ -0,0 +1,159 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PollingStrategy decides how long WaitJob waits before polling the job status.
+type PollingStrategy interface {
+	// Next returns the wait before the n-th poll, n starting from 1.
+	Next(n int) time.Duration
+}
+
+// ConstantPolling polls the job status at a fixed interval.
+type ConstantPolling struct {
+	Interval time.Duration
+}
+
+func (p *ConstantPolling) Next(_ int) time.Duration {
+	return p.Interval
+}
+
+// ExponentialPolling starts polling at Initial and multiplies the interval by Multiplier on every poll, up to Max.
+type ExponentialPolling struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+func (p *ExponentialPolling) Next(n int) time.Duration {
+	d := float64(p.Initial)
+	for i := 1; i < n && (p.Max <= 0 || d < float64(p.Max)); i++ {
+		d *= p.Multiplier
+	}
+	if p.Max > 0 && d > float64(p.Max) {
+		return p.Max
+	}
+	return time.Duration(d)
+}
+
+// DefaultPolling is the PollingStrategy used when WaitJobOptions does not specify one.
+var DefaultPolling = ExponentialPolling{
+	Initial:    time.Second,
+	Max:        30 * time.Second,
+	Multiplier: 1.5,
+}
+
+// WaitJobOptions stores the optional parameters of WaitJob and RunQuery.
+type WaitJobOptions struct {
+	Polling  PollingStrategy                                          // (Optional) Polling schedule. DefaultPolling is used if nil.
+	Progress func(jobId string, status string, elapsed time.Duration) // (Optional) Called after every poll of the job status.
+}
+
+// JobError is returned by WaitJob when the job has finished with `error` or `killed` status.
+type JobError struct {
+	JobId  string
+	Status string
+	StdErr string
+	Job    *ShowJobResult
+}
+
+func (e *JobError) Error() string {
+	retval := fmt.Sprintf("job %s finished with status %s", e.JobId, e.Status)
+	if e.StdErr != "" {
+		retval += ": " + e.StdErr
+	}
+	return retval
+}
+
+// JobFinished tells whether the job status denotes that the job is no longer queued or running.
+func JobFinished(status string) bool {
+	return status == "success" || status == "error" || status == "killed"
+}
+
+// WaitJob polls the status of the job until it finishes and returns its details.
+// A job that finished with `error` or `killed` status is reported as *JobError along with the details.
+func (client *TDClient) WaitJob(jobId string, options *WaitJobOptions) (*ShowJobResult, error) {
+	return client.WaitJobContext(context.Background(), jobId, options)
+}
+
+func (client *TDClient) WaitJobContext(ctx context.Context, jobId string, options *WaitJobOptions) (*ShowJobResult, error) {
+	if options == nil {
+		options = &WaitJobOptions{}
+	}
+	polling := options.Polling
+	if polling == nil {
+		polling = &DefaultPolling
+	}
+	startedAt := time.Now()
+	for n := 1; ; n++ {
+		status, err := client.JobStatusContext(ctx, jobId)
+		if err != nil {
+			return nil, err
+		}
+		if options.Progress != nil {
+			options.Progress(jobId, status, time.Since(startedAt))
+		}
+		if JobFinished(status) {
+			break
+		}
+		err = sleepContext(ctx, polling.Next(n))
+		if err != nil {
+			return nil, err
+		}
+	}
+	job, err := client.ShowJobContext(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != "success" {
+		return job, &JobError{
+			JobId:  jobId,
+			Status: job.Status,
+			StdErr: job.Debug.StdErr,
+			Job:    job,
+		}
+	}
+	return job, nil
+}
+
+// RunQuery submits the query, waits for the job to finish and passes each row of the result to reader.
+func (client *TDClient) RunQuery(db string, q Query, reader func(interface{}) error, options *WaitJobOptions) (*ShowJobResult, error) {
+	return client.RunQueryContext(context.Background(), db, q, reader, options)
+}
+
+func (client *TDClient) RunQueryContext(ctx context.Context, db string, q Query, reader func(interface{}) error, options *WaitJobOptions) (*ShowJobResult, error) {
+	jobId, err := client.SubmitQueryContext(ctx, db, q)
+	if err != nil {
+		return nil, err
+	}
+	job, err := client.WaitJobContext(ctx, jobId, options)
+	if err != nil {
+		return job, err
+	}
+	err = client.JobResultEachContext(ctx, jobId, reader)
+	if err != nil {
+		return job, err
+	}
+	return job, nil
+}
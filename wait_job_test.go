@@ -0,0 +1,154 @@
+//
+// Treasure Data API client for Go
+//
+// Copyright (C) 2014 Treasure Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package td_client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// SequenceTransport returns the given responses one by one and records the requested paths.
+type SequenceTransport struct {
+	Responses [][]byte
+	Paths     []string
+}
+
+func (t *SequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Paths = append(t.Paths, req.URL.Path)
+	body := t.Responses[0]
+	t.Responses = t.Responses[1:]
+	return &http.Response{
+		Status: "200 OK", StatusCode: 200,
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func jobStatusResponse(status string) []byte {
+	return []byte(`{"status":"` + status + `","cpu_time":null,"result_size":null,"duration":2,"job_id":"9999999","created_at":"2016-07-26 08:36:49 UTC","updated_at":"2016-07-26 08:36:52 UTC","start_at":null,"end_at":null,"num_records":null}`)
+}
+
+func showJobResponse(status string, stderr string) []byte {
+	return []byte(`{"query":"SELECT 1","type":"presto","priority":0,"retry_limit":0,"duration":1,"status":"` + status + `","cpu_time":null,"result_size":24,"job_id":"9999999","created_at":"2016-07-26 08:29:33 UTC","updated_at":"2016-07-26 08:29:34 UTC","start_at":"2016-07-26 08:29:33 UTC","end_at":"2016-07-26 08:29:34 UTC","num_records":1,"database":"sample_datasets","user_name":"hogehoge@hoge.co.jp","result":"","url":"https://console.treasuredata.com/jobs/9999999","hive_result_schema":"[[\"_col0\", \"bigint\"]]","organization":null,"debug":{"cmdout":"","stderr":"` + stderr + `"}}`)
+}
+
+var testPolling = &ConstantPolling{Interval: time.Millisecond}
+
+func TestWaitJob(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		jobStatusResponse("queued"),
+		jobStatusResponse("running"),
+		jobStatusResponse("success"),
+		showJobResponse("success", ""),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	statuses := []string{}
+	job, err := client.WaitJob("9999999", &WaitJobOptions{
+		Polling: testPolling,
+		Progress: func(jobId string, status string, elapsed time.Duration) {
+			statuses = append(statuses, status)
+		},
+	})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if job.Status != "success" {
+		t.Fatalf("unexpected status: %s", job.Status)
+	}
+	if len(statuses) != 3 || statuses[2] != "success" {
+		t.Fatalf("unexpected progress: %v", statuses)
+	}
+}
+
+func TestWaitJobError(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		jobStatusResponse("error"),
+		showJobResponse("error", "syntax error"),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	_, err = client.WaitJob("9999999", &WaitJobOptions{Polling: testPolling})
+	jobErr, ok := err.(*JobError)
+	if !ok {
+		t.Fatalf("expected *JobError, got %v", err)
+	}
+	if jobErr.Status != "error" || jobErr.StdErr != "syntax error" {
+		t.Fatalf("unexpected error: %s", jobErr.Error())
+	}
+}
+
+func TestWaitJobCanceled(t *testing.T) {
+	transport := &SequenceTransport{Responses: [][]byte{
+		jobStatusResponse("running"),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.WaitJobContext(ctx, "9999999", &WaitJobOptions{Polling: &ConstantPolling{Interval: time.Hour}})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	result := bytes.Buffer{}
+	enc := codec.NewEncoder(&result, &codec.MsgpackHandle{})
+	enc.Encode([]interface{}{1})
+	enc.Encode([]interface{}{2})
+	transport := &SequenceTransport{Responses: [][]byte{
+		[]byte(`{"job":"9999999","job_id":"9999999","database":"sample_datasets"}`),
+		jobStatusResponse("success"),
+		showJobResponse("success", ""),
+		result.Bytes(),
+	}}
+	client, err := NewTDClient(Settings{Transport: transport})
+	if err != nil {
+		t.Fatalf("failed create client: %s", err.Error())
+	}
+	rows := 0
+	_, err = client.RunQuery("sample_datasets", Query{Type: "presto", Query: "SELECT 1"}, func(v interface{}) error {
+		rows++
+		return nil
+	}, &WaitJobOptions{Polling: testPolling})
+	if err != nil {
+		t.Fatalf("bad request: %s", err.Error())
+	}
+	if rows != 2 {
+		t.Fatalf("expected 2 rows, got %d", rows)
+	}
+	if transport.Paths[3] != "/v3/job/result/9999999" {
+		t.Fatalf("unexpected request: %s", transport.Paths[3])
+	}
+}